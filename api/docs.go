@@ -249,12 +249,61 @@ var doc = `{
                         "schema": {
                             "$ref": "#/definitions/server.APIEvent"
                         }
+                    },
+                    "409": {
+                        "description": "a job of the event is in progress",
+                        "schema": {
+                            "$ref": "#/definitions/server.APIReply"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/events/{id}/accounts/{name}/bundle": {
+            "get": {
+                "description": "The tar.gz archive with the mnemonic, the address and the keyring of the account and the chain endpoints. If the X-LCTRLD-PASSPHRASE header is set the archive is encrypted with it, as openssl enc -aes-256-cbc -pbkdf2 -iter 100000 does.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "event"
+                ],
+                "summary": "Download the key bundle of an account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Account name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Passphrase encrypting the bundle",
+                        "name": "X-LCTRLD-PASSPHRASE",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
                     }
                 }
             }
         },
         "/v1/events/{id}/deploy": {
             "put": {
+                "description": "The deployment runs in the background, poll the returned job for progress",
                 "consumes": [
                     "application/json"
                 ],
@@ -274,11 +323,241 @@ var doc = `{
                         "required": true
                     }
                 ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/server.Job"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "The containers and the node configuration are removed from the machines, which stay provisioned. The undeployment runs in the background, poll the returned job for progress",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "event"
+                ],
+                "summary": "Stop and remove the containers of the event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/server.Job"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/events/{id}/health": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "event"
+                ],
+                "summary": "Check the health of the chain of a deployed event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/server.APIEvent"
+                            "$ref": "#/definitions/lctrld.EventHealth"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/events/{id}/jobs": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "event"
+                ],
+                "summary": "Retrieve the jobs of an event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.Job"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/events/{id}/jobs/{jobID}": {
+            "get": {
+                "description": "The job has the journal entries of the commands it has run so far, with their output.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "event"
+                ],
+                "summary": "Retrieve the status, progress and logs of a job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/server.Job"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "event"
+                ],
+                "summary": "Cancel a running job, the command in progress is stopped",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "jobID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "API Reply",
+                        "schema": {
+                            "$ref": "#/definitions/server.APIReply"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/events/{id}/journal": {
+            "get": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "event"
+                ],
+                "summary": "Retrieve the journal of the commands run for an event",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/cmdrunner.JournalEntry"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/payloads": {
+            "get": {
+                "description": "The payloads an event request can choose, by name",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "payload"
+                ],
+                "summary": "List the payloads of the catalog",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/server.APIPayload"
+                            }
                         }
                     }
                 }
@@ -286,6 +565,186 @@ var doc = `{
         }
     },
     "definitions": {
+        "cmdrunner.JournalEntry": {
+            "type": "object",
+            "properties": {
+                "command": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "duration_ms": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "exit_code": {
+                    "type": "integer"
+                },
+                "machine": {
+                    "type": "string"
+                },
+                "output": {
+                    "type": "string"
+                },
+                "secret_output": {
+                    "description": "SecretOutput is set when the output is not recorded because it\ncarries secrets",
+                    "type": "boolean"
+                },
+                "step": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
+        "config.ServiceSpec": {
+            "type": "object",
+            "properties": {
+                "command": {
+                    "description": "Command and Env are Go templates, see ProfileArgs",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "cpus": {
+                    "description": "CPUs and Memory are the docker run resource limits, i.e. 1.5 and 512m",
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "env": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "image": {
+                    "description": "Image defaults to the docker image of the payload",
+                    "type": "string"
+                },
+                "memory": {
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Name is the key of the service in the payload services",
+                    "type": "string"
+                },
+                "nodes": {
+                    "description": "Nodes are where the service runs: all, services or node roles. It\ndefaults to every node.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ports": {
+                    "description": "Ports are docker run port mappings, i.e. 26656:26656",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "restart": {
+                    "description": "Restart is the docker restart policy",
+                    "type": "string"
+                },
+                "volumes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "lctrld.EndpointHealth": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "reachable": {
+                    "type": "boolean"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "lctrld.EventHealth": {
+            "type": "object",
+            "properties": {
+                "checked_on": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "string"
+                },
+                "faucet": {
+                    "$ref": "#/definitions/lctrld.EndpointHealth"
+                },
+                "healthy": {
+                    "type": "boolean"
+                },
+                "light_client": {
+                    "$ref": "#/definitions/lctrld.EndpointHealth"
+                },
+                "nodes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/lctrld.NodeHealth"
+                    }
+                }
+            }
+        },
+        "lctrld.NodeHealth": {
+            "type": "object",
+            "properties": {
+                "account": {
+                    "type": "string"
+                },
+                "catching_up": {
+                    "type": "boolean"
+                },
+                "latest_block_height": {
+                    "type": "integer"
+                },
+                "latest_block_time": {
+                    "type": "string"
+                },
+                "machine": {
+                    "type": "string"
+                },
+                "peers": {
+                    "type": "integer"
+                },
+                "role": {
+                    "type": "string"
+                },
+                "rpc": {
+                    "$ref": "#/definitions/lctrld.EndpointHealth"
+                }
+            }
+        },
+        "model.ConfigOverrides": {
+            "type": "object",
+            "properties": {
+                "app": {
+                    "description": "App overrides app.toml",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "config": {
+                    "description": "Config overrides config.toml",
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
         "model.EventRequest": {
             "type": "object",
             "properties": {
@@ -295,15 +754,37 @@ var doc = `{
                         "$ref": "#/definitions/model.GenesisAccount"
                     }
                 },
+                "genesis_params": {
+                    "$ref": "#/definitions/model.GenesisParams"
+                },
+                "node_config": {
+                    "$ref": "#/definitions/model.NodeConfig"
+                },
+                "nodes": {
+                    "description": "Nodes are the nodes of the event other than the validators",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.NodeRequest"
+                    }
+                },
                 "owner": {
                     "type": "string"
                 },
                 "payload": {
-                    "$ref": "#/definitions/model.PayloadLocation"
+                    "description": "Payload is the name of the payload in the catalog, empty for the\ndefault payload",
+                    "type": "string",
+                    "example": "launchpayload"
                 },
                 "provider": {
                     "type": "string"
                 },
+                "services": {
+                    "description": "Services override the ports, env, resource limits and restart policy\nof the services of the payload, by name",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/config.ServiceSpec"
+                    }
+                },
                 "token_symbol": {
                     "type": "string"
                 }
@@ -312,36 +793,122 @@ var doc = `{
         "model.GenesisAccount": {
             "type": "object",
             "properties": {
+                "address": {
+                    "description": "Address is an existing address that gets a genesis balance, there are\nno keys for it, so it cannot be a validator or the faucet",
+                    "type": "string"
+                },
                 "faucet": {
                     "type": "boolean"
                 },
                 "genesis_balance": {
+                    "type": "string",
+                    "example": "500drop,100000000stake"
+                },
+                "mnemonic": {
+                    "description": "Mnemonic recovers the key of the account instead of creating a new one",
                     "type": "string"
                 },
                 "name": {
                     "type": "string"
                 },
+                "self_delegation": {
+                    "description": "SelfDelegation is the amount a validator stakes, it defaults to the\nwhole bond denom balance",
+                    "type": "string",
+                    "example": "100000000stake"
+                },
                 "validator": {
                     "type": "boolean"
                 }
             }
         },
-        "model.PayloadLocation": {
+        "model.GenesisParams": {
             "type": "object",
             "properties": {
-                "binary_path": {
+                "block_max_gas": {
+                    "description": "BlockMaxGas is the maximum gas of a block, -1 means no limit",
+                    "type": "integer"
+                },
+                "chain_id": {
+                    "description": "ChainID replaces the event ID as chain id",
                     "type": "string"
                 },
-                "binary_url": {
+                "genesis_time": {
+                    "description": "GenesisTime is the RFC3339 time the chain starts producing blocks",
                     "type": "string"
                 },
-                "cli_path": {
+                "inflation": {
+                    "description": "Inflation is the fixed yearly inflation rate, i.e. \"0.05\"",
                     "type": "string"
                 },
-                "daemon_path": {
+                "max_validators": {
+                    "description": "MaxValidators is the maximum number of bonded validators",
+                    "type": "integer"
+                },
+                "unbonding_time": {
+                    "description": "UnbondingTime is the staking unbonding time, i.e. \"10m\"",
                     "type": "string"
                 },
-                "docker_image": {
+                "voting_period": {
+                    "description": "VotingPeriod is the governance proposals voting period, i.e. \"5m\"",
+                    "type": "string"
+                }
+            }
+        },
+        "model.NodeConfig": {
+            "type": "object",
+            "properties": {
+                "app": {
+                    "description": "App overrides app.toml",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "config": {
+                    "description": "Config overrides config.toml",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "nodes": {
+                    "description": "Nodes are the overrides of specific nodes, by node name",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/model.ConfigOverrides"
+                    }
+                }
+            }
+        },
+        "model.NodeRequest": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "full",
+                        "seed",
+                        "sentry"
+                    ]
+                },
+                "validator": {
+                    "description": "Validator is the validator shielded by a sentry",
+                    "type": "string"
+                }
+            }
+        },
+        "model.StatusTransition": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "to": {
                     "type": "string"
                 }
             }
@@ -388,6 +955,10 @@ var doc = `{
                     "description": "email address of the owner",
                     "type": "string"
                 },
+                "payload": {
+                    "description": "name of the payload in the catalog",
+                    "type": "string"
+                },
                 "provider": {
                     "description": "provider for provisioning",
                     "type": "string"
@@ -401,6 +972,16 @@ var doc = `{
                         "$ref": "#/definitions/server.APIMachineConfig"
                     }
                 },
+                "status": {
+                    "description": "lifecycle of the event",
+                    "type": "string"
+                },
+                "status_history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.StatusTransition"
+                    }
+                },
                 "token_symbol": {
                     "description": "token symbool",
                     "type": "string"
@@ -416,11 +997,41 @@ var doc = `{
                 "MachineName": {
                     "type": "string"
                 },
+                "role": {
+                    "type": "string"
+                },
                 "tendermint_node_id": {
                     "type": "string"
                 }
             }
         },
+        "server.APIPayload": {
+            "type": "object",
+            "properties": {
+                "default": {
+                    "type": "boolean"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "docker_image": {
+                    "type": "string",
+                    "example": "apeunit/launchpayload:v1.0.0"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "launchpayload"
+                },
+                "profile": {
+                    "type": "string",
+                    "example": "legacy"
+                },
+                "version": {
+                    "type": "string",
+                    "example": "v0.0.0"
+                }
+            }
+        },
         "server.APIReply": {
             "type": "object",
             "properties": {
@@ -446,6 +1057,71 @@ var doc = `{
                 }
             }
         },
+        "server.Job": {
+            "type": "object",
+            "properties": {
+                "commands": {
+                    "description": "Commands are the journal entries of the commands run by the job, with\ntheir output. They are read from the event journal, not stored.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/cmdrunner.JournalEntry"
+                    }
+                },
+                "created_on": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "string"
+                },
+                "finished_on": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "logs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/server.JobLog"
+                    }
+                },
+                "result": {
+                    "type": "object"
+                },
+                "started_on": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "step": {
+                    "type": "string"
+                },
+                "steps_done": {
+                    "type": "integer"
+                },
+                "steps_total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "server.JobLog": {
+            "type": "object",
+            "properties": {
+                "at": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
         "server.UserCredentials": {
             "type": "object",
             "properties": {
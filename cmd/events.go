@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
@@ -24,7 +29,8 @@ func init() {
 	rootCmd.AddCommand(eventsCmd)
 
 	eventsCmd.AddCommand(setupEventCmd)
-	setupEventCmd.Flags().StringVar(&provider, "provider", "hetzner", "Provider for provisioning the insfrastructure")
+	addPlanFlags(setupEventCmd)
+	setupEventCmd.Flags().StringVar(&provider, "provider", "hetzner", "Provider for provisioning the insfrastructure, a docker-machine driver or \"local-docker\" to run the machines as containers on this host")
 
 	eventsCmd.AddCommand(tearDownEventCmd)
 
@@ -32,9 +38,26 @@ func init() {
 	listEventCmd.Flags().BoolVar(&verbose, "verbose", false, "Print more details")
 
 	eventsCmd.AddCommand(retryEventCmd)
+
+	eventsCmd.AddCommand(statusEventCmd)
+
+	eventsCmd.AddCommand(journalEventCmd)
+	journalEventCmd.Flags().StringVar(&journalStep, "step", "", "Only show the commands of a step")
+	journalEventCmd.Flags().BoolVar(&verbose, "verbose", false, "Print the output of the commands")
+
+	eventsCmd.AddCommand(exportKeysCmd)
+	exportKeysCmd.Flags().StringVar(&exportDir, "output", ".", "Directory where the bundles are written")
+	exportKeysCmd.Flags().StringVar(&exportAccount, "account", "", "Only export the bundle of an account")
+	exportKeysCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "Encrypt the bundles with the passphrase in the file")
 }
 
-var verbose bool
+var (
+	verbose        bool
+	journalStep    string
+	exportDir      string
+	exportAccount  string
+	passphraseFile string
+)
 
 // setupEventCmd represents the setupEvent command
 var setupEventCmd = &cobra.Command{
@@ -52,24 +75,48 @@ func setupEvent(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
-	evtRequest.PayloadLocation = model.NewDefaultPayloadLocation()
+	evtRequest.Provider = provider
+	// only the payloads of the catalog can be chosen
+	if err = evtRequest.SetPayload(settings); err != nil {
+		return
+	}
+	// the addresses are checked with the prefix of the payload
+	if err = evtRequest.Validate(); err != nil {
+		return
+	}
 
-	evt := model.NewEvent(evtRequest.TokenSymbol, evtRequest.Owner, provider, evtRequest.GenesisAccounts, evtRequest.PayloadLocation)
+	evt := model.NewEventFromRequest(evtRequest)
 	vc := evt.ValidatorsCount()
 
-	log.Debugf("%#v\n", settings)
 	log.Debugf("%#v\n", evtRequest)
 	log.Debugf("%#v\n", evt)
+	if planOutput {
+		ctx, cancel := commandContext()
+		defer cancel()
+		plan, err := lctrld.PlanProvisionEvent(ctx, settings, evt)
+		if err != nil {
+			return err
+		}
+		return printPlan(plan)
+	}
 	fmt.Println("Summary:")
+	var supply, staked model.Coins
 	_, validatorAccounts := evt.Validators()
 	for _, acc := range validatorAccounts {
-		fmt.Printf("Validator %s has initial balance of %+v\n", acc.Name, acc.GenesisBalance)
+		fmt.Printf("Validator %s has initial balance of %s and self delegates %s\n", acc.Name, acc.GenesisBalance, acc.Stake())
+		supply = supply.Add(acc.GenesisBalance...)
+		staked = staked.Add(acc.Stake())
 	}
 	fmt.Printf("Including other accounts, the genesis account state is:\n")
-	for k, v := range evt.Accounts {
-		fmt.Printf("%s: %+v\n", k, v)
+	for _, acc := range evt.ExtraAccounts() {
+		fmt.Printf("Account %s has initial balance of %s (faucet: %v)\n", acc.Name, acc.GenesisBalance, acc.Faucet)
+		supply = supply.Add(acc.GenesisBalance...)
+	}
+	fmt.Printf("The genesis supply is %s, of which %s is staked\n", supply, staked)
+	for _, name := range evt.NodeNames()[vc:] {
+		fmt.Printf("Node %s is a %s node\n", name, evt.NodeRole(name))
 	}
-	fmt.Printf("Finally will be deploying %v servers+nodes (1 for each validators) on %s\n", vc, evt.Provider)
+	fmt.Printf("Finally will be deploying %v servers+nodes (1 for each validators and other nodes) on %s\n", len(evt.NodeNames()), evt.Provider)
 	fmt.Print("Shall we proceed? [Y/n]:")
 	proceed := "Y"
 	fmt.Scanln(&proceed)
@@ -84,7 +131,9 @@ func setupEvent(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
-	err = lctrld.ProvisionEvent(settings, evt, cmdrunner.RunCommand)
+	ctx, cancel := commandContext()
+	defer cancel()
+	err = lctrld.ProvisionEvent(ctx, settings, evt, cmdrunner.NewRunner(settings))
 	if err != nil {
 		log.Error("There was an error, run the command with --debug for more info:", err)
 		return err
@@ -116,7 +165,9 @@ func tearDownEvent(cmd *cobra.Command, args []string) (err error) {
 		log.Error("There was an error shutting down the event: ", err)
 		return err
 	}
-	err = lctrld.DestroyEvent(settings, evt, cmdrunner.RunCommand)
+	ctx, cancel := commandContext()
+	defer cancel()
+	err = lctrld.DestroyEvent(ctx, settings, evt, cmdrunner.NewRunner(settings))
 	if err != nil {
 		log.Error("There was an error shutting down the event: ", err)
 		return err
@@ -136,19 +187,186 @@ var listEventCmd = &cobra.Command{
 func listEvent(cmd *cobra.Command, args []string) {
 	fmt.Println("List events")
 	start := time.Now()
+	ctx, cancel := commandContext()
+	defer cancel()
 	events, err := lctrld.ListEvents(settings)
 	if err != nil {
 		fmt.Println("There was an error shutting down the event: ", err)
 	}
 	for _, evt := range events {
-		fmt.Println("Event", evt.ID(), "owner:", evt.Owner, "with", evt.ValidatorsCount(), "validators")
+		fmt.Println("Event", evt.ID(), "owner:", evt.Owner, "with", evt.ValidatorsCount(), "validators", "status:", evt.CurrentStatus())
+		if t := evt.LastTransition(); t != nil && t.To == model.StatusFailed {
+			fmt.Println("  failed on", t.At.Format(time.RFC3339), "with:", t.Reason)
+		}
+		if next := nextCommand(&evt); next != "" {
+			fmt.Println("  next step:", next)
+		}
 		if verbose {
-			lctrld.InspectEvent(settings, &evt, cmdrunner.RunCommand)
+			lctrld.InspectEvent(ctx, settings, &evt, cmdrunner.NewRunner(settings))
 		}
 	}
 	fmt.Println("Operation completed in", time.Since(start))
 }
 
+// statusEventCmd represents the status command
+var statusEventCmd = &cobra.Command{
+	Use:   "status EVENTID",
+	Short: "Check the health of the chain of a deployed event",
+	Long: `Queries the Tendermint RPC of every node of the event, reporting the latest
+block height, whenever the node is catching up and the number of peers,
+and checks that the light client and the faucet are reachable.`,
+	Args: cobra.ExactArgs(1),
+	RunE: statusEvent,
+}
+
+func statusEvent(cmd *cobra.Command, args []string) (err error) {
+	evt, err := lctrld.LoadEvent(settings, args[0])
+	if err != nil {
+		return
+	}
+	ctx, cancel := commandContext()
+	defer cancel()
+	health, err := lctrld.CheckEventHealth(ctx, settings, evt)
+	if err != nil {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tACCOUNT\tROLE\tRPC\tHEIGHT\tLAST BLOCK\tCATCHING UP\tPEERS")
+	for _, n := range health.Nodes {
+		rpc := "ok"
+		if !n.RPC.Reachable {
+			rpc = n.RPC.Error
+		}
+		lastBlock := "-"
+		if !n.LatestBlockTime.IsZero() {
+			lastBlock = n.LatestBlockTime.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%v\t%d\n", n.Machine, n.Account, n.Role, rpc, n.LatestBlockHeight, lastBlock, n.CatchingUp, n.Peers)
+	}
+	w.Flush()
+	for name, e := range map[string]lctrld.EndpointHealth{"light client": health.LightClient, "faucet": health.Faucet} {
+		switch {
+		case e.URL == "":
+			fmt.Printf("%s: not deployed\n", name)
+		case e.Reachable:
+			fmt.Printf("%s %s: ok\n", name, e.URL)
+		default:
+			fmt.Printf("%s %s: %s\n", name, e.URL, e.Error)
+		}
+	}
+	if health.Healthy {
+		fmt.Println("Event", evt.ID(), "is healthy")
+	} else {
+		fmt.Println("Event", evt.ID(), "is NOT healthy")
+	}
+	return
+}
+
+// journalEventCmd represents the journal command
+var journalEventCmd = &cobra.Command{
+	Use:   "journal EVENTID",
+	Short: "Show the commands run for an event",
+	Long: `Prints the journal of the commands run for an event, with the step and the
+machine they were run for, their duration and exit code.`,
+	Args: cobra.ExactArgs(1),
+	RunE: journalEvent,
+}
+
+func journalEvent(cmd *cobra.Command, args []string) (err error) {
+	entries, err := lctrld.EventJournal(settings, args[0])
+	if err != nil {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSTEP\tMACHINE\tEXIT\tDURATION\tCOMMAND")
+	for _, e := range entries {
+		if journalStep != "" && e.Step != journalStep {
+			continue
+		}
+		machine := e.Machine
+		if machine == "" {
+			machine = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Step, machine, e.ExitCode, time.Duration(e.DurationMs)*time.Millisecond, strings.Join(e.Command, " "))
+		if verbose && e.Output != "" {
+			w.Flush()
+			fmt.Println(e.Output)
+		}
+		if e.Error != "" {
+			w.Flush()
+			fmt.Println("error:", e.Error)
+		}
+	}
+	w.Flush()
+	return
+}
+
+// exportKeysCmd represents the export-keys command
+var exportKeysCmd = &cobra.Command{
+	Use:   "export-keys EVENTID",
+	Short: "Export the keys of the accounts of an event, one bundle per account",
+	Long: `Writes a tar.gz bundle for each account of the event with its mnemonic, its
+address, its keyring and the endpoints of the chain, to hand it over to the
+participant. External accounts have no keys and are skipped.
+
+With --passphrase-file the bundles are encrypted, they can be decrypted with:
+  openssl enc -d -aes-256-cbc -pbkdf2 -iter 100000 -in BUNDLE | tar xz`,
+	Args: cobra.ExactArgs(1),
+	RunE: exportKeys,
+}
+
+func exportKeys(cmd *cobra.Command, args []string) (err error) {
+	evt, err := lctrld.LoadEvent(settings, args[0])
+	if err != nil {
+		return
+	}
+	var passphrase string
+	if passphraseFile != "" {
+		data, err := ioutil.ReadFile(passphraseFile)
+		if err != nil {
+			return err
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+	if exportAccount == "" {
+		files, err := lctrld.ExportKeys(settings, evt, exportDir, passphrase)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			fmt.Println(f)
+		}
+		return nil
+	}
+	if err = os.MkdirAll(exportDir, 0700); err != nil {
+		return
+	}
+	var bundle bytes.Buffer
+	if err = lctrld.WriteKeyBundle(&bundle, settings, evt, exportAccount, passphrase); err != nil {
+		return
+	}
+	file := filepath.Join(exportDir, lctrld.KeyBundleName(evt, exportAccount, passphrase != ""))
+	if err = ioutil.WriteFile(file, bundle.Bytes(), 0600); err != nil {
+		return
+	}
+	fmt.Println(file)
+	return
+}
+
+// nextCommand suggests the command to run to move the event forward in its lifecycle
+func nextCommand(evt *model.Event) string {
+	switch evt.EffectiveStatus() {
+	case model.StatusCreated:
+		return fmt.Sprintf("lctrld events retry %s once the machines are fixed, or tear it down", evt.ID())
+	case model.StatusProvisioned:
+		return fmt.Sprintf("lctrld payload setup %s", evt.ID())
+	case model.StatusConfigured:
+		return fmt.Sprintf("lctrld payload deploy %s", evt.ID())
+	}
+	return ""
+}
+
 // listEventCmd represents the tearDownEvent command
 var retryEventCmd = &cobra.Command{
 	Use:   "retry",
@@ -172,8 +390,7 @@ func retryEvent(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return
 	}
-	validatorNames, _ := evt2.Validators()
-	for _, v := range validatorNames {
+	for _, v := range evt2.NodeNames() {
 		log.Infof("Updated info for %s: %#v\n", v, evt2.State[v])
 	}
 	if err != nil {
@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
 	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
 	"github.com/apeunit/LaunchControlD/pkg/lctrld"
 	"github.com/spf13/cobra"
@@ -15,11 +21,23 @@ var payloadCmd = &cobra.Command{
 var setupChainCmd = &cobra.Command{
 	Use:   "setup EVENTID",
 	Short: "Does everything to initialize a Cosmos-SDK based payload for EVENTID",
-	Long:  ``,
-	Args:  cobra.ExactArgs(1),
-	RunE:  setupChain,
+	Long: fmt.Sprintf(`Does everything to initialize a Cosmos-SDK based payload for EVENTID.
+
+Without flags the configuration is generated from scratch. Each completed step
+is recorded in the event, so a failed setup can be continued with --resume, or
+rerun from any step with --from-step. Rerunning the keys step recreates the
+keyrings, the existing keys are recovered from their mnemonics, and rerunning
+the genesis-accounts step starts again from the genesis written by init.
+The steps are: %s`, strings.Join(lctrld.PayloadSteps(), ", ")),
+	Args: cobra.ExactArgs(1),
+	RunE: setupChain,
 }
 
+var (
+	resume   bool
+	fromStep string
+)
+
 var deployCmd = &cobra.Command{
 	Use:   "deploy EVENTID",
 	Short: "Tells the provisioned machines to run the dockerized payload for EVENTID",
@@ -28,10 +46,65 @@ var deployCmd = &cobra.Command{
 	RunE:  deploy,
 }
 
+var undeployCmd = &cobra.Command{
+	Use:   "undeploy EVENTID",
+	Short: "Stops and removes the payload containers and node configs of EVENTID",
+	Long: `Stops and removes the containers of EVENTID and the node configuration copied
+on the machines, the machines stay provisioned. The event is configured again
+and can be deployed with payload deploy.`,
+	Args: cobra.ExactArgs(1),
+	RunE: undeploy,
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify EVENTID",
+	Short: "Checks the generated genesis.json of EVENTID against the event",
+	Long: `Checks that node 0's genesis.json has the chain id of the event, every account
+with its genesis balance and one genesis transaction for each validator, and
+that all the nodes have the same genesis. The same check runs at the end of
+the setup and before the deploy.`,
+	Args: cobra.ExactArgs(1),
+	RunE: verify,
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the cache of the payload binaries",
+	Long: `The payload binaries are downloaded once for each release and shared by the
+events using it, an entry of the cache is pinned while an event uses it.`,
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the cached payload releases and the events using them",
+	Args:  cobra.NoArgs,
+	RunE:  cacheList,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove the cached payload releases not used by any event",
+	Long: `Removes the cached payload releases not used by any event. The releases used
+by an event setup in the last hour are kept, the setup may not have stored
+its event yet.`,
+	Args: cobra.NoArgs,
+	RunE: cachePrune,
+}
+
 func init() {
 	rootCmd.AddCommand(payloadCmd)
 	payloadCmd.AddCommand(setupChainCmd)
+	setupChainCmd.Flags().BoolVar(&resume, "resume", false, "Continue the setup from the first step that did not complete")
+	setupChainCmd.Flags().StringVar(&fromStep, "from-step", "", "Rerun the setup starting from the named step")
+	addPlanFlags(setupChainCmd)
 	payloadCmd.AddCommand(deployCmd)
+	addPlanFlags(deployCmd)
+	payloadCmd.AddCommand(undeployCmd)
+	addPlanFlags(undeployCmd)
+	payloadCmd.AddCommand(verifyCmd)
+	payloadCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
 }
 
 func setupChain(cmd *cobra.Command, args []string) (err error) {
@@ -39,7 +112,19 @@ func setupChain(cmd *cobra.Command, args []string) (err error) {
 	if err != nil {
 		return err
 	}
-	return lctrld.ConfigurePayload(settings, evt, cmdrunner.RunCommand)
+	ctx, cancel := commandContext()
+	defer cancel()
+	if planOutput {
+		plan, err := lctrld.PlanConfigurePayload(ctx, settings, evt, fromStep, resume || fromStep != "")
+		if err != nil {
+			return err
+		}
+		return printPlan(plan)
+	}
+	if resume || fromStep != "" {
+		return lctrld.ResumeConfigurePayload(ctx, settings, evt, fromStep, cmdrunner.NewRunner(settings))
+	}
+	return lctrld.ConfigurePayload(ctx, settings, evt, cmdrunner.NewRunner(settings))
 }
 
 func deploy(cmd *cobra.Command, args []string) (err error) {
@@ -48,6 +133,78 @@ func deploy(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
-	err = lctrld.DeployPayload(settings, evt, cmdrunner.RunCommand)
+	ctx, cancel := commandContext()
+	defer cancel()
+	if planOutput {
+		plan, err := lctrld.PlanDeployPayload(ctx, settings, evt)
+		if err != nil {
+			return err
+		}
+		return printPlan(plan)
+	}
+	err = lctrld.DeployPayload(ctx, settings, evt, cmdrunner.NewRunner(settings))
+	return
+}
+
+func undeploy(cmd *cobra.Command, args []string) (err error) {
+	evt, err := lctrld.LoadEvent(settings, args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	if planOutput {
+		plan, err := lctrld.PlanUndeployPayload(ctx, settings, evt)
+		if err != nil {
+			return err
+		}
+		return printPlan(plan)
+	}
+	if err = lctrld.UndeployPayload(ctx, settings, evt, cmdrunner.NewRunner(settings)); err != nil {
+		return
+	}
+	fmt.Println("The payload of event", evt.ID(), "has been undeployed")
+	return
+}
+
+func verify(cmd *cobra.Command, args []string) (err error) {
+	evt, err := lctrld.LoadEvent(settings, args[0])
+	if err != nil {
+		return err
+	}
+	if err = lctrld.VerifyGenesis(settings, evt); err != nil {
+		return
+	}
+	fmt.Println("The genesis of event", evt.ID(), "matches the event")
+	return
+}
+
+func cacheList(cmd *cobra.Command, args []string) (err error) {
+	entries, err := lctrld.ListPayloadCache(settings)
+	if err != nil {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVERSION\tURL\tSIZE\tCREATED\tUSED\tEVENTS")
+	for _, e := range entries {
+		events := "-"
+		if len(e.Events) > 0 {
+			events = strings.Join(e.Events, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", e.Key, e.Version, e.URL, e.Size, e.CreatedOn.Format(time.RFC3339), e.UsedOn.Format(time.RFC3339), events)
+	}
+	w.Flush()
+	return
+}
+
+func cachePrune(cmd *cobra.Command, args []string) (err error) {
+	removed, err := lctrld.PrunePayloadCache(settings)
+	for _, e := range removed {
+		fmt.Println("removed", e.Key, e.URL)
+	}
+	if err == nil {
+		fmt.Println(len(removed), "payload releases removed from the cache")
+	}
 	return
 }
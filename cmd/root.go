@@ -2,11 +2,16 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/lctrld"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
@@ -61,11 +66,16 @@ func initConfig() {
 		// Only log the warning severity or above.
 		log.SetLevel(log.DebugLevel)
 	}
-	fmt.Printf(`
+	// the JSON plans are read by tools, the banner goes out of the way
+	banner := os.Stdout
+	if planJSON {
+		banner = os.Stderr
+	}
+	fmt.Fprintf(banner, `
 ┌─┐┬  ┬┌┬┐┬  ┬┌─┐╔╦╗
 ├┤ └┐┌┘ │ └┐┌┘┌─┘ ║║
 └─┘ └┘  ┴  └┘ └─┘═╩╝ %s`, rootCmd.Version)
-	fmt.Println()
+	fmt.Fprintln(banner)
 
 	if cfgFile != "" {
 		// Use config file from the flag.
@@ -80,9 +90,9 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err != nil {
-		fmt.Println("Error loading config file:", viper.ConfigFileUsed(), ":", err)
+		fmt.Fprintln(banner, "Error loading config file:", viper.ConfigFileUsed(), ":", err)
 	} else {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(banner, "Using config file:", viper.ConfigFileUsed())
 		settingsParseError := viper.UnmarshalExact(&settings)
 		if settingsParseError != nil {
 			log.Debugf("Errors encountered while parsing %s: %s", viper.ConfigFileUsed(), settingsParseError)
@@ -92,3 +102,46 @@ func initConfig() {
 	settings.RuntimeVersion = rootCmd.Version
 	settings.RuntimeStartedAt = time.Now()
 }
+
+// planOutput tells the commands to print what they would do instead of doing it,
+// planJSON prints the plan as JSON
+var planOutput, planJSON bool
+
+// addPlanFlags adds the --plan and --json flags to a command
+func addPlanFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&planOutput, "plan", false, "Print what the command would do, without doing it")
+	cmd.Flags().BoolVar(&planJSON, "json", false, "Print the plan as JSON (with --plan)")
+}
+
+// printPlan prints a plan in the format requested with the flags
+func printPlan(plan *lctrld.Plan) (err error) {
+	if !planJSON {
+		plan.WriteText(os.Stdout)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(plan)
+}
+
+// commandContext returns a context that is cancelled on the first interrupt,
+// so that the running commands are stopped; a second interrupt exits at once
+func commandContext() (ctx context.Context, cancel context.CancelFunc) {
+	ctx, cancel = context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			log.Warn("interrupted, stopping the running commands (interrupt again to exit immediately)")
+			cancel()
+		case <-ctx.Done():
+			signal.Stop(signals)
+			return
+		}
+		<-signals
+		os.Exit(1)
+	}()
+	return
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/apeunit/LaunchControlD/pkg/lctrld"
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the encryption of the secrets stored in the events",
+	Long:  ``,
+}
+
+var rotateSecretsCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Re-encrypts the secrets of all the events with a new master key",
+	Long: `Re-encrypts the secrets of all the events with the master key in --new-key-file,
+the file is created with a random key if it does not exist. The secrets are
+decrypted with the configured master key, plaintext secrets are encrypted.
+Once done, configure the new key in secrets.key_file or LCTRLD_MASTER_KEY.`,
+	Args: cobra.NoArgs,
+	RunE: rotateSecrets,
+}
+
+var newKeyFile string
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(rotateSecretsCmd)
+	rotateSecretsCmd.Flags().StringVar(&newKeyFile, "new-key-file", "", "File holding the new base64 encoded master key")
+	rotateSecretsCmd.MarkFlagRequired("new-key-file")
+}
+
+func rotateSecrets(cmd *cobra.Command, args []string) (err error) {
+	if !utils.FileExists(newKeyFile) {
+		encoded, err := secrets.GenerateKey()
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(newKeyFile, []byte(encoded+"\n"), 0600); err != nil {
+			return err
+		}
+		fmt.Println("Generated a new master key in", newKeyFile)
+	}
+	encoded, err := secrets.ReadKeyFile(newKeyFile)
+	if err != nil {
+		return
+	}
+	key, err := secrets.DecodeKey(encoded)
+	if err != nil {
+		return
+	}
+	rotated, err := lctrld.RotateSecrets(settings, key)
+	if err != nil {
+		return
+	}
+	fmt.Printf("Re-encrypted the secrets of %d events\n", len(rotated))
+	fmt.Printf("Set secrets.key_file to %s (or LCTRLD_MASTER_KEY to its content) to use the new key\n", newKeyFile)
+	return
+}
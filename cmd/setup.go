@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"text/tabwriter"
 	"time"
 
 	"github.com/apeunit/LaunchControlD/pkg/lctrld"
@@ -12,18 +14,48 @@ import (
 var setupCmd = &cobra.Command{
 	Use:   "setup",
 	Short: "Setup the LaunchControlD daemon",
-	Long:  ``,
-	Run:   setup,
+	Long: `Setup the workspace and download the docker-machine binaries, the
+downloads are checked against the sha256 in the configuration.
+
+With --verify the installed binaries are checked again instead.`,
+	RunE: setup,
 }
 
+var verifyBinaries bool
+
 func init() {
+	setupCmd.Flags().BoolVar(&verifyBinaries, "verify", false, "Verify the installed binaries against the expected sha256")
 	rootCmd.AddCommand(setupCmd)
 }
 
-func setup(cmd *cobra.Command, args []string) {
+func setup(cmd *cobra.Command, args []string) (err error) {
+	if verifyBinaries {
+		return verifySetup()
+	}
 	fmt.Println("Setup LaunchControlD started")
 	start := time.Now()
-	lctrld.SetupWorkspace(settings)
-	lctrld.InstallDockerMachine(settings)
+	if err = lctrld.SetupWorkspace(settings); err != nil {
+		return
+	}
+	if err = lctrld.InstallDockerMachine(settings); err != nil {
+		return
+	}
 	fmt.Println("Setup completed in ", time.Since(start))
+	return
+}
+
+// verifySetup prints the verification of the installed binaries
+func verifySetup() (err error) {
+	checks, err := lctrld.VerifyBinaries(settings)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BINARY\tSHA256\tRESULT")
+	for _, c := range checks {
+		result := "ok"
+		if c.Error != "" {
+			result = c.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.File, c.Actual, result)
+	}
+	w.Flush()
+	return
 }
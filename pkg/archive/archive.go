@@ -0,0 +1,259 @@
+// Package archive extracts the release files of the binaries installed by
+// lctrld: zip, tar.gz and tar.xz archives or plain binaries
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Format is the format of a release file
+type Format string
+
+// Supported formats
+const (
+	Zip    Format = "zip"
+	TarGz  Format = "tar.gz"
+	TarXz  Format = "tar.xz"
+	Binary Format = "binary"
+)
+
+var (
+	// ErrorUnsupportedFormat is returned for files that are neither a known
+	// archive nor a binary
+	ErrorUnsupportedFormat = errors.New("unsupported file format")
+	// ErrorUnsafePath is returned for archive entries that would be
+	// extracted outside of the destination folder
+	ErrorUnsafePath = errors.New("unsafe path in archive")
+	// ErrorUnsupportedEntry is returned for archive entries that are neither
+	// files nor folders, like links, the releases do not need them
+	ErrorUnsupportedEntry = errors.New("unsupported archive entry")
+)
+
+// Extractor extracts the archives of a format to a folder, returning the
+// paths of the extracted files relative to the folder
+type Extractor struct {
+	Format Format
+	// Magic is the prefix of the files of the format
+	Magic   []byte
+	Extract func(src, dir string) (files []string, err error)
+}
+
+// extractors are the supported archive formats
+var extractors = []Extractor{
+	{Format: Zip, Magic: []byte("PK\x03\x04"), Extract: extractZip},
+	{Format: TarGz, Magic: []byte{0x1f, 0x8b}, Extract: extractTarGz},
+	{Format: TarXz, Magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, Extract: extractTarXz},
+}
+
+// Register adds an archive format, the formats registered later take
+// precedence when their magic overlaps
+func Register(e Extractor) {
+	extractors = append([]Extractor{e}, extractors...)
+}
+
+// Detect returns the format of a file from its content
+func Detect(src string) (format Format, err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("cannot read %s: %w", src, err)
+	}
+	header = header[:n]
+	for _, e := range extractors {
+		if bytes.HasPrefix(header, e.Magic) {
+			return e.Format, nil
+		}
+	}
+	// executables and scripts are the only files installed as they are
+	if bytes.HasPrefix(header, []byte("#!")) || http.DetectContentType(header) == "application/octet-stream" {
+		return Binary, nil
+	}
+	return "", fmt.Errorf("%w: %s is %s", ErrorUnsupportedFormat, src, http.DetectContentType(header))
+}
+
+// Extract extracts the archive src to dir, a plain binary is copied to
+// dir/name. It returns the paths of the extracted files relative to dir.
+func Extract(src, dir, name string) (files []string, err error) {
+	format, err := Detect(src)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	if format == Binary {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err = writeFile(filepath.Join(dir, name), f, 0755); err != nil {
+			return nil, err
+		}
+		return []string{name}, nil
+	}
+	for _, e := range extractors {
+		if e.Format == format {
+			if files, err = e.Extract(src, dir); err != nil {
+				return nil, fmt.Errorf("cannot extract %s: %w", src, err)
+			}
+			return
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrorUnsupportedFormat, format)
+}
+
+// Find returns the path of the first extracted file named name
+func Find(dir string, files []string, name string) (string, error) {
+	for _, f := range files {
+		if filepath.Base(f) == name {
+			return filepath.Join(dir, f), nil
+		}
+	}
+	return "", fmt.Errorf("file %s was not found in the archive", name)
+}
+
+// target returns the path of an archive entry in dir, it fails if the entry
+// is outside of dir
+func target(dir, entry string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(entry))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrorUnsafePath, entry)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+// writeFile writes a file with the permission bits of the archive entry
+func writeFile(path string, r io.Reader, mode os.FileMode) (err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	// the umask does not apply to the archive modes
+	return os.Chmod(path, mode.Perm())
+}
+
+// extractZip extracts a zip archive
+func extractZip(src, dir string) (files []string, err error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		path, err := target(dir, f.Name)
+		if err != nil {
+			return nil, err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err = os.MkdirAll(path, 0755); err != nil {
+				return nil, err
+			}
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = writeFile(path, rc, mode)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, filepath.ToSlash(filepath.Clean(f.Name)))
+		default:
+			return nil, fmt.Errorf("%w: %s has type %v", ErrorUnsupportedEntry, f.Name, mode.Type())
+		}
+	}
+	return
+}
+
+// extractTarGz extracts a gzip compressed tar archive
+func extractTarGz(src, dir string) (files []string, err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return
+	}
+	defer gr.Close()
+	return extractTar(gr, dir)
+}
+
+// extractTarXz extracts a xz compressed tar archive
+func extractTarXz(src, dir string) (files []string, err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	xr, err := xz.NewReader(f)
+	if err != nil {
+		return
+	}
+	return extractTar(xr, dir)
+}
+
+// extractTar extracts the files and folders of a tar stream
+func extractTar(r io.Reader, dir string) (files []string, err error) {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		path, err := target(dir, header.Name)
+		if err != nil {
+			return nil, err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(path, 0755); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err = writeFile(path, tr, header.FileInfo().Mode()); err != nil {
+				return nil, err
+			}
+			files = append(files, filepath.ToSlash(filepath.Clean(header.Name)))
+		case tar.TypeXGlobalHeader:
+		default:
+			// links are refused, a chain of them could point outside of dir
+			return nil, fmt.Errorf("%w: %s has type %c", ErrorUnsupportedEntry, header.Name, header.Typeflag)
+		}
+	}
+}
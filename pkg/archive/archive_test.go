@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+type entry struct {
+	name string
+	mode int64
+	body string
+	// link makes the entry a symbolic link to link
+	link string
+}
+
+var release = []entry{
+	{name: "release/", mode: 0755},
+	{name: "release/bin/launchpayloadd", mode: 0755, body: "daemon"},
+	{name: "release/README.md", mode: 0644, body: "readme"},
+}
+
+func writeTar(t *testing.T, w io.Writer, entries []entry) {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: e.mode, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.name[len(e.name)-1] == '/' {
+			h.Typeflag = tar.TypeDir
+		}
+		if e.link != "" {
+			h.Typeflag, h.Linkname = tar.TypeSymlink, e.link
+		}
+		require.Nil(t, tw.WriteHeader(h))
+		_, err := tw.Write([]byte(e.body))
+		require.Nil(t, err)
+	}
+	require.Nil(t, tw.Close())
+}
+
+func writeArchive(t *testing.T, format Format, entries []entry) string {
+	var b bytes.Buffer
+	switch format {
+	case Zip:
+		zw := zip.NewWriter(&b)
+		for _, e := range entries {
+			h := &zip.FileHeader{Name: e.name}
+			h.SetMode(os.FileMode(e.mode))
+			if e.name[len(e.name)-1] == '/' {
+				h.SetMode(os.ModeDir | os.FileMode(e.mode))
+			}
+			w, err := zw.CreateHeader(h)
+			require.Nil(t, err)
+			_, err = w.Write([]byte(e.body))
+			require.Nil(t, err)
+		}
+		require.Nil(t, zw.Close())
+	case TarGz:
+		gw := gzip.NewWriter(&b)
+		writeTar(t, gw, entries)
+		require.Nil(t, gw.Close())
+	case TarXz:
+		xw, err := xz.NewWriter(&b)
+		require.Nil(t, err)
+		writeTar(t, xw, entries)
+		require.Nil(t, xw.Close())
+	case Binary:
+		b.WriteString("\x7fELF\x02\x01\x01\x00")
+	}
+	src := filepath.Join(t.TempDir(), "download")
+	require.Nil(t, ioutil.WriteFile(src, b.Bytes(), 0600))
+	return src
+}
+
+func TestExtract(t *testing.T) {
+	for _, format := range []Format{Zip, TarGz, TarXz} {
+		src := writeArchive(t, format, release)
+		detected, err := Detect(src)
+		require.Nil(t, err)
+		assert.Equal(t, format, detected)
+
+		dir := t.TempDir()
+		files, err := Extract(src, dir, "launchpayloadd")
+		require.Nil(t, err, format)
+		assert.Equal(t, []string{"release/bin/launchpayloadd", "release/README.md"}, files, format)
+		path, err := Find(dir, files, "launchpayloadd")
+		require.Nil(t, err)
+		info, err := os.Stat(path)
+		require.Nil(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm(), format)
+		info, err = os.Stat(filepath.Join(dir, "release", "README.md"))
+		require.Nil(t, err)
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm(), format)
+		_, err = Find(dir, files, "launchpayloadcli")
+		assert.NotNil(t, err)
+
+		// entries outside of the destination are rejected
+		src = writeArchive(t, format, []entry{{name: "../evil", mode: 0755, body: "evil"}})
+		_, err = Extract(src, t.TempDir(), "")
+		assert.True(t, errors.Is(err, ErrorUnsafePath), format)
+	}
+
+	// a chain of links that each stay inside the destination ends outside
+	// of it, the links are refused
+	for _, format := range []Format{TarGz, TarXz} {
+		root := t.TempDir()
+		dir := filepath.Join(root, "a", "b")
+		src := writeArchive(t, format, []entry{
+			{name: "d/", mode: 0755},
+			{name: "d/s", link: ".."},
+			{name: "d/s/t", link: ".."},
+			{name: "d/s/t/evil", mode: 0755, body: "evil"},
+		})
+		_, err := Extract(src, dir, "")
+		assert.True(t, errors.Is(err, ErrorUnsupportedEntry), format)
+		_, err = os.Stat(filepath.Join(root, "a", "evil"))
+		assert.True(t, os.IsNotExist(err), format)
+		_, err = os.Lstat(filepath.Join(dir, "d", "s"))
+		assert.True(t, os.IsNotExist(err), format)
+	}
+
+	// a plain binary is installed under the name given
+	dir := t.TempDir()
+	files, err := Extract(writeArchive(t, Binary, nil), dir, "docker-machine")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"docker-machine"}, files)
+	info, err := os.Stat(filepath.Join(dir, "docker-machine"))
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// i.e. the error page of a wrong download url
+	src := filepath.Join(t.TempDir(), "download")
+	require.Nil(t, ioutil.WriteFile(src, []byte("<html><body>Not Found</body></html>"), 0600))
+	_, err = Extract(src, dir, "docker-machine")
+	assert.True(t, errors.Is(err, ErrorUnsupportedFormat))
+}
@@ -0,0 +1,299 @@
+package cmdrunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRecordedFileSize is the size above which the files written by a
+// command are not recorded (e.g. VM disk images)
+const maxRecordedFileSize = 1 << 20
+
+// secretEnv matches the names of environment variables whose value must not
+// end up in a cassette
+var secretEnv = regexp.MustCompile(`(?i)(token|secret|password|key)`)
+
+// Cassette holds the recorded invocations of a CommandRunner
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded command invocation
+type Interaction struct {
+	Command []string                `json:"command"`
+	Env     []string                `json:"env,omitempty"`
+	Output  string                  `json:"output"`
+	Error   *RecordedError          `json:"error,omitempty"`
+	Files   map[string]RecordedFile `json:"files,omitempty"`
+}
+
+// RecordedError is a recorded command failure
+type RecordedError struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	Message  string `json:"message"`
+}
+
+// RecordedFile is a file written by a command, text files are stored as such
+// to keep the cassettes readable
+type RecordedFile struct {
+	Text string      `json:"text,omitempty"`
+	Data []byte      `json:"data,omitempty"`
+	Mode os.FileMode `json:"mode"`
+}
+
+// LoadCassette reads a cassette from a file
+func LoadCassette(path string) (c *Cassette, err error) {
+	c = new(Cassette)
+	err = utils.LoadJSON(path, c)
+	return
+}
+
+// placeholders replaces values in recorded data with their placeholders and
+// the other way around, so that cassettes do not depend on e.g. the
+// workspace path of the machine they were recorded on
+type placeholders map[string]string
+
+// hide replaces the values with their placeholders
+func (p placeholders) hide(s string) string {
+	// longest values first, in case one contains another
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(p[keys[i]]) > len(p[keys[j]]) })
+	for _, k := range keys {
+		s = strings.ReplaceAll(s, p[k], k)
+	}
+	return s
+}
+
+// reveal replaces the placeholders with their values
+func (p placeholders) reveal(s string) string {
+	for k, v := range p {
+		s = strings.ReplaceAll(s, k, v)
+	}
+	return s
+}
+
+func (p placeholders) hideAll(items []string) (out []string) {
+	for _, s := range items {
+		out = append(out, p.hide(s))
+	}
+	return
+}
+
+// Recorder is a CommandRunner that runs commands with another runner and
+// records the invocations, their output and the files they write under Root
+type Recorder struct {
+	Runner       CommandRunner
+	Root         string
+	Replacements map[string]string // placeholder -> value
+	cassette     Cassette
+	sync.Mutex
+}
+
+// NewRecorder creates a Recorder, replacements map placeholders to the
+// values they stand for in the recorded data
+func NewRecorder(runner CommandRunner, root string, replacements map[string]string) *Recorder {
+	return &Recorder{
+		Runner:       runner,
+		Root:         root,
+		Replacements: replacements,
+	}
+}
+
+// fileState identifies a version of a file
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshot lists the files under the recorder root
+func (r *Recorder) snapshot() (files map[string]fileState) {
+	files = make(map[string]fileState)
+	filepath.Walk(r.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		files[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return
+}
+
+// Run runs and records a command
+func (r *Recorder) Run(ctx context.Context, command, envVars []string) (out string, err error) {
+	before := r.snapshot()
+	out, err = r.Runner(ctx, command, envVars)
+	after := r.snapshot()
+
+	p := placeholders(r.Replacements)
+	i := Interaction{
+		Command: p.hideAll(command),
+		Output:  p.hide(out),
+	}
+	for _, e := range envVars {
+		if kv := strings.SplitN(e, "=", 2); len(kv) == 2 && secretEnv.MatchString(kv[0]) {
+			e = kv[0] + "=REDACTED"
+		}
+		i.Env = append(i.Env, p.hide(e))
+	}
+	if err != nil {
+		i.Error = &RecordedError{ExitCode: -1, Message: p.hide(err.Error())}
+		if cErr, ok := err.(*CommandError); ok {
+			i.Error.ExitCode = cErr.ExitCode
+			i.Error.Stdout = p.hide(cErr.Stdout)
+			i.Error.Stderr = p.hide(cErr.Stderr)
+		}
+	}
+	for path, state := range after {
+		if prev, found := before[path]; found && prev == state {
+			continue
+		}
+		if state.size > maxRecordedFileSize {
+			log.Warnf("recorder: %s is too big to be recorded, skipped", path)
+			continue
+		}
+		data, rErr := ioutil.ReadFile(path)
+		if rErr != nil {
+			continue
+		}
+		info, rErr := os.Stat(path)
+		if rErr != nil {
+			continue
+		}
+		rel, _ := filepath.Rel(r.Root, path)
+		f := RecordedFile{Mode: info.Mode().Perm()}
+		if utf8.Valid(data) {
+			f.Text = p.hide(string(data))
+		} else {
+			f.Data = data
+		}
+		if i.Files == nil {
+			i.Files = make(map[string]RecordedFile)
+		}
+		i.Files[rel] = f
+	}
+
+	r.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.Unlock()
+	return
+}
+
+// Save writes the recorded interactions to a cassette file
+func (r *Recorder) Save(path string) (err error) {
+	r.Lock()
+	defer r.Unlock()
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	// cassettes are checked in, keep them readable in diffs
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Replayer is a CommandRunner that serves the responses recorded in a
+// cassette without running anything. Commands are matched regardless of the
+// order in which they are run, each recorded invocation is served only once.
+type Replayer struct {
+	Root         string
+	Replacements map[string]string // placeholder -> value
+	cassette     *Cassette
+	used         []bool
+	sync.Mutex
+}
+
+// NewReplayer loads a cassette for replaying, files recorded by the commands
+// are written under root
+func NewReplayer(path, root string, replacements map[string]string) (r *Replayer, err error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return
+	}
+	r = &Replayer{
+		Root:         root,
+		Replacements: replacements,
+		cassette:     c,
+		used:         make([]bool, len(c.Interactions)),
+	}
+	return
+}
+
+// Run serves the recorded response of a command, unexpected commands fail
+func (r *Replayer) Run(ctx context.Context, command, envVars []string) (out string, err error) {
+	p := placeholders(r.Replacements)
+	recorded := p.hideAll(command)
+
+	r.Lock()
+	var i *Interaction
+	for n := range r.cassette.Interactions {
+		if !r.used[n] && reflect.DeepEqual(r.cassette.Interactions[n].Command, recorded) {
+			r.used[n] = true
+			i = &r.cassette.Interactions[n]
+			break
+		}
+	}
+	r.Unlock()
+	if i == nil {
+		return "", fmt.Errorf("replayer: unexpected command %s", strings.Join(recorded, " "))
+	}
+	if err = ctx.Err(); err != nil {
+		return "", &CommandError{Command: command, ExitCode: -1, Err: err}
+	}
+
+	for rel, f := range i.Files {
+		path := filepath.Join(r.Root, rel)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return
+		}
+		data := f.Data
+		if f.Text != "" {
+			data = []byte(p.reveal(f.Text))
+		}
+		if err = ioutil.WriteFile(path, data, f.Mode); err != nil {
+			return
+		}
+	}
+	if i.Error != nil {
+		return "", &CommandError{
+			Command:  command,
+			ExitCode: i.Error.ExitCode,
+			Stdout:   p.reveal(i.Error.Stdout),
+			Stderr:   p.reveal(i.Error.Stderr),
+			Err:      fmt.Errorf("%s", p.reveal(i.Error.Message)),
+		}
+	}
+	return p.reveal(i.Output), nil
+}
+
+// Unused returns the recorded commands that have not been replayed
+func (r *Replayer) Unused() (commands []string) {
+	r.Lock()
+	defer r.Unlock()
+	for n, i := range r.cassette.Interactions {
+		if !r.used[n] {
+			commands = append(commands, strings.Join(i.Command, " "))
+		}
+	}
+	return
+}
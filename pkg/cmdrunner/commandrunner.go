@@ -1,29 +1,157 @@
 package cmdrunner
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/apeunit/LaunchControlD/pkg/config"
 	log "github.com/sirupsen/logrus"
 )
 
+// killWait is how long RunCommand waits for the output of a killed command,
+// a process that escaped the kill may keep it open
+var killWait = 5 * time.Second
+
 // CommandRunner func type allows for mocking out RunCommand()
-type CommandRunner func([]string, []string) (string, error)
+type CommandRunner func(context.Context, []string, []string) (string, error)
+
+// CommandError is returned by RunCommand when a command fails
+type CommandError struct {
+	Command  []string
+	ExitCode int
+	Stdout   string
+	Stderr   string
+	Duration time.Duration
+	// Err is the underlying error, it is the context error when the
+	// command has been stopped because of a timeout or a cancellation
+	Err error
+}
+
+func (e *CommandError) Error() string {
+	out := strings.TrimSpace(e.Stderr)
+	if out == "" {
+		out = strings.TrimSpace(e.Stdout)
+	}
+	if out == "" {
+		out = e.Err.Error()
+	}
+	return fmt.Sprintf("%s exited with code %d after %s: %s", filepath.Base(e.Command[0]), e.ExitCode, e.Duration.Round(time.Millisecond), out)
+}
+
+// Unwrap returns the underlying error
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// syncBuffer is a bytes.Buffer that can be written from multiple goroutines
+type syncBuffer struct {
+	b bytes.Buffer
+	sync.Mutex
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.b.String()
+}
+
+type stdinKey struct{}
+
+// WithStdin sets the input of the commands run with the context, it keeps
+// secrets like mnemonics out of the command line
+func WithStdin(ctx context.Context, stdin string) context.Context {
+	return context.WithValue(ctx, stdinKey{}, stdin)
+}
+
+// StdinFrom returns the input set in the context, ok is false if there is none
+func StdinFrom(ctx context.Context) (stdin string, ok bool) {
+	stdin, ok = ctx.Value(stdinKey{}).(string)
+	return
+}
 
-// RunCommand runs a command
-func RunCommand(command, envVars []string) (out string, err error) {
+// RunCommand runs a command. When the context is done the command and all
+// the processes it started are killed.
+func RunCommand(ctx context.Context, command, envVars []string) (out string, err error) {
 	cmd := exec.Command(command[0], command[1:]...)
 	// add the binary folder to the exec path
 	cmd.Env = envVars
+	if stdin, ok := StdinFrom(ctx); ok {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	setProcessGroup(cmd)
+	var stdout, stderr, combined syncBuffer
+	cmd.Stdout = io.MultiWriter(&stdout, &combined)
+	cmd.Stderr = io.MultiWriter(&stderr, &combined)
 	log.Debug("Running command ", command, cmd.Env)
 	// execute the command
-	o, err := cmd.CombinedOutput()
+	start := time.Now()
+	if err = cmd.Start(); err == nil {
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+			select {
+			case <-done:
+			case <-time.After(killWait):
+				log.Warnf("%s has been killed but its output is still open", command)
+			}
+			err = ctx.Err()
+		}
+	}
+	out = strings.TrimSpace(combined.String())
 	if err != nil {
-		log.Errorf("%s failed with %s, %s\n", command, err, string(o))
-		return "", errors.New(strings.TrimSpace(string(o)))
+		cErr := &CommandError{
+			Command:  command,
+			ExitCode: -1,
+			Stdout:   stdout.String(),
+			Stderr:   stderr.String(),
+			Duration: time.Since(start),
+			Err:      err,
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			cErr.ExitCode = exitErr.ExitCode()
+		}
+		log.Errorf("%s failed with %s, %s\n", command, err, out)
+		return "", cErr
 	}
-	out = strings.TrimSpace(string(o))
 	log.Debug("Command stdout: ", out)
 	return
 }
+
+// NewRunner returns a CommandRunner that stops commands running longer than
+// the timeouts configured in the settings
+func NewRunner(settings *config.Schema) CommandRunner {
+	return WithTimeouts(RunCommand, settings.Commands)
+}
+
+// WithTimeouts wraps a CommandRunner to apply a timeout to each command. The
+// timeout is looked up by "<binary> <subcommand>" first, then by "<binary>",
+// falling back to the default timeout. A zero timeout means no timeout.
+func WithTimeouts(runner CommandRunner, timeouts config.Commands) CommandRunner {
+	return func(ctx context.Context, command, envVars []string) (string, error) {
+		timeout := timeouts.Timeout(command)
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return runner(ctx, command, envVars)
+	}
+}
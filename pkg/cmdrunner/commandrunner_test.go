@@ -0,0 +1,66 @@
+package cmdrunner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCommand(t *testing.T) {
+	out, err := RunCommand(context.Background(), []string{"sh", "-c", "echo hello"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", out)
+
+	_, err = RunCommand(context.Background(), []string{"sh", "-c", "echo out; echo oops >&2; exit 3"}, nil)
+	var cErr *CommandError
+	assert.True(t, errors.As(err, &cErr))
+	assert.Equal(t, 3, cErr.ExitCode)
+	assert.Equal(t, "out\n", cErr.Stdout)
+	assert.Equal(t, "oops\n", cErr.Stderr)
+	assert.Contains(t, err.Error(), "oops")
+
+	out, err = RunCommand(WithStdin(context.Background(), "secret words\n"), []string{"sh", "-c", "read w; echo $w"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret words", out)
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	runner := WithTimeouts(RunCommand, config.Commands{
+		DefaultTimeout: time.Minute,
+		Timeouts:       map[string]time.Duration{"sh": 100 * time.Millisecond},
+	})
+	start := time.Now()
+	// the child sleep keeps the output open, it must be killed as well
+	_, err := runner(context.Background(), []string{"sh", "-c", "sleep 30 & sleep 30"}, nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+}
+
+func TestRunCommandEscapedChild(t *testing.T) {
+	defer func(w time.Duration) { killWait = w }(killWait)
+	killWait = 100 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// the child in its own session is not killed and keeps the output open
+	_, err := RunCommand(ctx, []string{"sh", "-c", "setsid sleep 3 & sleep 30"}, nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+}
+
+func TestCommandsTimeout(t *testing.T) {
+	c := config.Commands{
+		DefaultTimeout: time.Minute,
+		Timeouts: map[string]time.Duration{
+			"docker-machine create": time.Hour,
+			"docker-machine":        2 * time.Minute,
+		},
+	}
+	assert.Equal(t, time.Hour, c.Timeout([]string{"/bin/docker-machine", "--debug", "create", "m-0"}))
+	assert.Equal(t, 2*time.Minute, c.Timeout([]string{"docker-machine", "ip", "m-0"}))
+	assert.Equal(t, time.Minute, c.Timeout([]string{"docker", "ps"}))
+}
@@ -0,0 +1,194 @@
+package cmdrunner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxJournalOutput is the number of bytes of output kept in a journal entry,
+// the end of the output is kept since that is where errors are reported
+const MaxJournalOutput = 4096
+
+// secretFlag matches the command line flags whose value must not end up in a
+// journal
+var secretFlag = regexp.MustCompile(`(?i)^--?[\w-]*(token|secret|password|passphrase|mnemonic)[\w-]*$`)
+
+// JournalEntry is a command run on behalf of an event
+type JournalEntry struct {
+	Time       time.Time `json:"time"`
+	Step       string    `json:"step,omitempty"`
+	Machine    string    `json:"machine,omitempty"`
+	Command    []string  `json:"command"`
+	DurationMs int64     `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	Output     string    `json:"output,omitempty"`
+	// SecretOutput is set when the output is not recorded because it
+	// carries secrets
+	SecretOutput bool `json:"secret_output,omitempty"`
+}
+
+type stepKey struct{}
+
+type machineKey struct{}
+
+type secretOutputKey struct{}
+
+// WithStep sets the pipeline step the commands run with the context belong to
+func WithStep(ctx context.Context, step string) context.Context {
+	return context.WithValue(ctx, stepKey{}, step)
+}
+
+// StepFrom returns the pipeline step of a context
+func StepFrom(ctx context.Context) string {
+	s, _ := ctx.Value(stepKey{}).(string)
+	return s
+}
+
+// WithMachine sets the machine the commands run with the context target
+func WithMachine(ctx context.Context, machineName string) context.Context {
+	return context.WithValue(ctx, machineKey{}, machineName)
+}
+
+// MachineFrom returns the machine of a context
+func MachineFrom(ctx context.Context) string {
+	m, _ := ctx.Value(machineKey{}).(string)
+	return m
+}
+
+// WithSecretOutput marks the commands run with the context as printing
+// secrets, like the mnemonics of new keys, their output is not journaled
+func WithSecretOutput(ctx context.Context) context.Context {
+	return context.WithValue(ctx, secretOutputKey{}, true)
+}
+
+// SecretOutputFrom tells if the output of the commands run with a context
+// carries secrets
+func SecretOutputFrom(ctx context.Context) bool {
+	s, _ := ctx.Value(secretOutputKey{}).(bool)
+	return s
+}
+
+// RedactCommand returns a copy of a command line where the values of the
+// flags carrying secrets are replaced by REDACTED
+func RedactCommand(command []string) []string {
+	redacted := make([]string, len(command))
+	copy(redacted, command)
+	for i, a := range redacted {
+		if kv := strings.SplitN(a, "=", 2); len(kv) == 2 && secretFlag.MatchString(kv[0]) {
+			redacted[i] = kv[0] + "=REDACTED"
+		} else if secretFlag.MatchString(a) && i+1 < len(redacted) {
+			redacted[i+1] = "REDACTED"
+		}
+	}
+	return redacted
+}
+
+// truncateOutput keeps the last MaxJournalOutput bytes of an output
+func truncateOutput(out string) string {
+	if len(out) <= MaxJournalOutput {
+		return out
+	}
+	return "..." + out[len(out)-MaxJournalOutput:]
+}
+
+// Journal appends the commands run by a CommandRunner to a JSONL file
+type Journal struct {
+	path string
+	sync.Mutex
+}
+
+// NewJournal creates a journal writing to the file at path, the file is
+// created with the first entry
+func NewJournal(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Append writes an entry at the end of the journal
+func (j *Journal) Append(e JournalEntry) (err error) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	j.Lock()
+	defer j.Unlock()
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return
+}
+
+// Wrap returns a CommandRunner that records every command run by runner in
+// the journal, together with the step and the machine set in the context.
+// Failing to write the journal does not fail the command.
+func (j *Journal) Wrap(runner CommandRunner) CommandRunner {
+	return func(ctx context.Context, command, envVars []string) (out string, err error) {
+		start := time.Now()
+		out, err = runner(ctx, command, envVars)
+		e := JournalEntry{
+			Time:       start,
+			Step:       StepFrom(ctx),
+			Machine:    MachineFrom(ctx),
+			Command:    RedactCommand(command),
+			DurationMs: time.Since(start).Milliseconds(),
+			Output:     truncateOutput(out),
+		}
+		if err != nil {
+			e.ExitCode = -1
+			e.Error = err.Error()
+			if cErr, ok := err.(*CommandError); ok {
+				e.ExitCode = cErr.ExitCode
+				e.Output = truncateOutput(cErr.Stdout + cErr.Stderr)
+			}
+		}
+		if SecretOutputFrom(ctx) {
+			// the error message of a command may repeat its output
+			e.Output, e.SecretOutput = "", true
+			if err != nil {
+				e.Error = fmt.Sprintf("%s exited with code %d, the output is secret", filepath.Base(command[0]), e.ExitCode)
+			}
+		}
+		if jErr := j.Append(e); jErr != nil {
+			log.Warnf("cannot write the journal %s: %v", j.path, jErr)
+		}
+		return
+	}
+}
+
+// ReadJournal reads the entries of a journal file, a missing file is an
+// empty journal
+func ReadJournal(path string) (entries []JournalEntry, err error) {
+	entries = []JournalEntry{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e JournalEntry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return
+		}
+		entries = append(entries, e)
+	}
+	err = scanner.Err()
+	return
+}
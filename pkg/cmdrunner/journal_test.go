@@ -0,0 +1,68 @@
+package cmdrunner
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "journal.jsonl")
+	runner := NewJournal(p).Wrap(RunCommand)
+	ctx := WithMachine(WithStep(context.Background(), "deploy"), "evt-0")
+
+	_, err := runner(ctx, []string{"sh", "-c", "echo done", "--password", "hunter2"}, nil)
+	assert.Nil(t, err)
+	_, err = runner(context.Background(), []string{"sh", "-c", "echo " + strings.Repeat("x", 2*MaxJournalOutput) + "; exit 2"}, nil)
+	assert.NotNil(t, err)
+
+	entries, err := ReadJournal(p)
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "deploy", entries[0].Step)
+	assert.Equal(t, "evt-0", entries[0].Machine)
+	assert.Equal(t, []string{"sh", "-c", "echo done", "--password", "REDACTED"}, entries[0].Command)
+	assert.Equal(t, "done", entries[0].Output)
+	assert.Equal(t, 0, entries[0].ExitCode)
+	assert.Equal(t, 2, entries[1].ExitCode)
+	assert.Len(t, entries[1].Output, MaxJournalOutput+3)
+
+	entries, err = ReadJournal(filepath.Join(t.TempDir(), "missing.jsonl"))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestJournalSecretOutput(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "journal.jsonl")
+	runner := NewJournal(p).Wrap(RunCommand)
+	ctx := WithSecretOutput(WithStep(context.Background(), "keys"))
+
+	out, err := runner(ctx, []string{"sh", "-c", `echo '{"mnemonic":"word word"}'`}, nil)
+	assert.Nil(t, err)
+	// the caller still gets the output
+	assert.Contains(t, out, "word word")
+	_, err = runner(ctx, []string{"sh", "-c", "echo word word; exit 3"}, nil)
+	assert.NotNil(t, err)
+
+	entries, err := ReadJournal(p)
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	for _, e := range entries {
+		assert.True(t, e.SecretOutput)
+		assert.Empty(t, e.Output)
+		assert.NotContains(t, e.Error, "word")
+	}
+	assert.Equal(t, 3, entries[1].ExitCode)
+	assert.Equal(t, "sh exited with code 3, the output is secret", entries[1].Error)
+}
+
+func TestRedactCommand(t *testing.T) {
+	c := []string{"cli", "keys", "add", "--keyring-backend", "test", "--mnemonic=a b c", "--api-token", "t"}
+	assert.Equal(t, []string{"cli", "keys", "add", "--keyring-backend", "test", "--mnemonic=REDACTED", "--api-token", "REDACTED"}, RedactCommand(c))
+	// the original command is untouched
+	assert.Equal(t, "t", c[7])
+}
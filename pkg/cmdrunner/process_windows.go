@@ -0,0 +1,19 @@
+package cmdrunner
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// setProcessGroup is a no-op on windows, the process tree is killed by pid
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command and its children with taskkill
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		cmd.Process.Kill()
+	}
+}
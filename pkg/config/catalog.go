@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultPayload is the payload of the built-in catalog
+const DefaultPayload = "launchpayload"
+
+// DefaultAddressPrefix is the bech32 prefix of the account addresses of the
+// payloads that do not set one
+const DefaultAddressPrefix = "cosmos"
+
+// addressPrefixPattern matches the bech32 human readable parts
+var addressPrefixPattern = regexp.MustCompile(`^[a-z0-9]{1,83}$`)
+
+// builtinCatalog is the payload catalog used when none is configured
+var builtinCatalog = map[string]CatalogPayload{
+	DefaultPayload: {
+		Description: "LaunchPayload, a Cosmos SDK 0.39 chain with a faucet",
+		DockerImage: "apeunit/launchpayload:v1.0.0",
+		Version:     "v0.0.0",
+		BinaryURL:   "https://github.com/apeunit/LaunchPayload/releases/download/v0.0.0/launchpayload-v0.0.0.zip",
+		Daemon:      "launchpayloadd",
+		CLI:         "launchpayloadcli",
+		Profile:     ProfileLegacy,
+	},
+}
+
+// PayloadCatalog lists the payloads the events can run, approved by the
+// operator
+type PayloadCatalog struct {
+	// Default is the payload of the event requests that do not choose one
+	Default string `mapstructure:"default"`
+	// Catalog are the payloads by name, when it is empty the built-in
+	// launchpayload is the only payload available
+	Catalog map[string]CatalogPayload `mapstructure:"catalog"`
+}
+
+// CatalogPayload is a payload of the catalog
+type CatalogPayload struct {
+	// Name is the key of the payload in the catalog
+	Name        string `mapstructure:"-" json:"name"`
+	Description string `mapstructure:"description" json:"description,omitempty"`
+	DockerImage string `mapstructure:"docker_image" json:"docker_image"`
+	Version     string `mapstructure:"version" json:"version,omitempty"`
+	BinaryURL   string `mapstructure:"binary_url" json:"binary_url"`
+	// SHA256 is the checksum of the file at BinaryURL
+	SHA256 string `mapstructure:"sha256" json:"sha256,omitempty"`
+	// Daemon and CLI are the names of the binaries in the release, the CLI
+	// is not needed by single binary payloads
+	Daemon string `mapstructure:"daemon" json:"daemon"`
+	CLI    string `mapstructure:"cli" json:"cli,omitempty"`
+	// Profile is the payload profile of the payload, see PayloadProfile.
+	// It defaults to DefaultPayloadProfile.
+	Profile string `mapstructure:"profile" json:"profile"`
+	// AddressPrefix is the bech32 prefix of the account addresses of the
+	// chain. It defaults to DefaultAddressPrefix.
+	AddressPrefix string `mapstructure:"address_prefix" json:"address_prefix"`
+	// Services are added to or override the default services of the
+	// deployment, by name, see DefaultServices
+	Services map[string]ServiceSpec `mapstructure:"services" json:"-"`
+}
+
+// catalog returns the payloads available
+func (s *Schema) catalog() map[string]CatalogPayload {
+	if len(s.Payloads.Catalog) == 0 {
+		return builtinCatalog
+	}
+	return s.Payloads.Catalog
+}
+
+// CatalogPayloads returns the payloads of the catalog sorted by name
+func (s *Schema) CatalogPayloads() (payloads []CatalogPayload) {
+	for name, p := range s.catalog() {
+		p.Name = name
+		payloads = append(payloads, p.withDefaults())
+	}
+	sort.Slice(payloads, func(i, j int) bool { return payloads[i].Name < payloads[j].Name })
+	return
+}
+
+// DefaultCatalogPayload returns the name of the default payload
+func (s *Schema) DefaultCatalogPayload() string {
+	if s.Payloads.Default == "" {
+		return DefaultPayload
+	}
+	return s.Payloads.Default
+}
+
+// CatalogPayload returns a payload of the catalog, an empty name is the
+// default payload. The payloads that are not in the catalog are refused.
+func (s *Schema) CatalogPayload(name string) (p CatalogPayload, err error) {
+	if name == "" {
+		name = s.DefaultCatalogPayload()
+	}
+	p, found := s.catalog()[name]
+	if !found {
+		names := make([]string, 0)
+		for _, c := range s.CatalogPayloads() {
+			names = append(names, c.Name)
+		}
+		return p, fmt.Errorf("the payload %s is not in the catalog, the available payloads are: %s", name, strings.Join(names, ", "))
+	}
+	p.Name = name
+	p = p.withDefaults()
+	if err = p.validate(s); err != nil {
+		return p, fmt.Errorf("payload %s of the catalog: %w", name, err)
+	}
+	return
+}
+
+// withDefaults returns the payload with the default profile and address
+// prefix when they are not set
+func (p CatalogPayload) withDefaults() CatalogPayload {
+	if p.Profile == "" {
+		p.Profile = DefaultPayloadProfile
+	}
+	if p.AddressPrefix == "" {
+		p.AddressPrefix = DefaultAddressPrefix
+	}
+	return p
+}
+
+// validate checks that the payload can be deployed
+func (p CatalogPayload) validate(s *Schema) (err error) {
+	if p.DockerImage == "" || p.BinaryURL == "" || p.Daemon == "" {
+		return fmt.Errorf("the docker_image, the binary_url and the daemon are required")
+	}
+	if !addressPrefixPattern.MatchString(p.AddressPrefix) {
+		return fmt.Errorf("invalid address_prefix %s, the prefixes are made of lowercase letters and digits", p.AddressPrefix)
+	}
+	profile, err := s.PayloadProfile(p.Profile)
+	if err != nil {
+		return
+	}
+	if !profile.SingleBinary && p.CLI == "" {
+		return fmt.Errorf("the cli is required by the %s profile", p.Profile)
+	}
+	return
+}
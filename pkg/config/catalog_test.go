@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogPayload(t *testing.T) {
+	// without a catalog only the built-in payload is available
+	s := &Schema{}
+	p, err := s.CatalogPayload("")
+	require.Nil(t, err)
+	assert.Equal(t, DefaultPayload, p.Name)
+	assert.Equal(t, "launchpayloadd", p.Daemon)
+	assert.Equal(t, DefaultAddressPrefix, p.AddressPrefix)
+	_, err = s.CatalogPayload("gaia")
+	require.NotNil(t, err)
+
+	s = &Schema{Payloads: PayloadCatalog{
+		Default: "mychain",
+		Catalog: map[string]CatalogPayload{
+			"mychain": {DockerImage: "mychain:v1", BinaryURL: "https://example.com/mychain.tar.gz", Daemon: "mychaind", Profile: ProfileStargate, AddressPrefix: "mychain"},
+			"prefix":  {DockerImage: "prefix:v1", BinaryURL: "https://example.com/prefix.zip", Daemon: "prefixd", Profile: ProfileStargate, AddressPrefix: "My-Chain"},
+			"nocli":   {DockerImage: "nocli:v1", BinaryURL: "https://example.com/nocli.zip", Daemon: "nocli"},
+			"noimage": {BinaryURL: "https://example.com/noimage.zip", Daemon: "noimaged", CLI: "noimagecli"},
+			"orphan":  {DockerImage: "orphan:v1", BinaryURL: "https://example.com/orphan.zip", Daemon: "orphand", Profile: "gaia"},
+		},
+	}}
+	var names []string
+	for _, p := range s.CatalogPayloads() {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"mychain", "nocli", "noimage", "orphan", "prefix"}, names)
+
+	p, err = s.CatalogPayload("")
+	require.Nil(t, err)
+	assert.Equal(t, "mychain", p.Name)
+	assert.Equal(t, "mychaind", p.Daemon)
+	assert.Equal(t, "mychain", p.AddressPrefix)
+
+	for name, msg := range map[string]string{
+		DefaultPayload: "the payload launchpayload is not in the catalog, the available payloads are: mychain, nocli",
+		"nocli":        "payload nocli of the catalog: the cli is required by the legacy profile",
+		"noimage":      "payload noimage of the catalog: the docker_image",
+		"orphan":       "payload orphan of the catalog: unknown payload profile gaia",
+		"prefix":       "payload prefix of the catalog: invalid address_prefix My-Chain",
+	} {
+		_, err = s.CatalogPayload(name)
+		require.NotNil(t, err, name)
+		assert.Contains(t, err.Error(), msg)
+	}
+}
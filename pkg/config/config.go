@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"path"
 	"path/filepath"
@@ -15,7 +16,9 @@ const (
 	BinDir            = "bin"
 	TmpDir            = "tmp"
 	EvtsDir           = "evts"
+	CacheDir          = "cache"
 	EvtDescriptorFile = "event.json"
+	EvtJournalFile    = "journal.jsonl"
 )
 
 // set configuration defaults
@@ -23,7 +26,20 @@ func init() {
 	// web
 	viper.SetDefault("web.listen_address", ":2012")
 	viper.SetDefault("web.users_db_file", "users.json")
+	viper.SetDefault("web.jobs_db_file", "jobs.json")
 	viper.SetDefault("web.default_provider", "virtualbox")
+	// provisioning
+	viper.SetDefault("provisioning.workers", 4)
+	// local docker provider
+	viper.SetDefault("local_docker.image", "docker:19.03-dind")
+	viper.SetDefault("local_docker.ready_timeout", "2m")
+	// commands
+	viper.SetDefault("commands.default_timeout", "15m")
+	viper.SetDefault("commands.timeouts", map[string]string{
+		"docker-machine create": "30m",
+	})
+	// payloads
+	viper.SetDefault("payloads.default", DefaultPayload)
 	// sentry
 	viper.SetDefault("sentry.dsn", "https://17c93719b0a94e139ec731d306648ca1@o413394.ingest.sentry.io/5627329")
 	viper.SetDefault("sentry.environment", "develop")
@@ -34,8 +50,16 @@ func init() {
 type Schema struct {
 	Workspace     string        `mapstructure:"workspace"`
 	DockerMachine DockerMachine `mapstructure:"docker_machine"`
+	LocalDocker   LocalDocker   `mapstructure:"local_docker"`
+	Provisioning  Provisioning  `mapstructure:"provisioning"`
+	Commands      Commands      `mapstructure:"commands"`
 	Web           WebSchema     `mapstructure:"web"`
 	Sentry        SentrySchema  `mapstructure:"sentry"`
+	Secrets       Secrets       `mapstructure:"secrets"`
+	// Payloads is the catalog of the payloads the events can run
+	Payloads PayloadCatalog `mapstructure:"payloads"`
+	// Profiles are the custom payload profiles, by name
+	Profiles map[string]PayloadProfile `mapstructure:"payload_profiles"`
 	// the following are used at runtime
 	RuntimeStartedAt time.Time `mapstructure:"-"`
 	RuntimeVersion   string    `mapstructure:"-"`
@@ -51,6 +75,11 @@ func (s *Schema) Bin(file string) string {
 	return filepath.Join(s.Workspace, BinDir, file)
 }
 
+// PayloadCache returns /tmp/workspace/cache/payloads/<ENTRY>
+func (s *Schema) PayloadCache(entry string) string {
+	return filepath.Join(s.Workspace, CacheDir, "payloads", entry)
+}
+
 // Tmp returns /Tmp/workspace/tmp
 func (s *Schema) Tmp() (string, error) {
 	return ioutil.TempDir(filepath.Join(s.Workspace, TmpDir), "")
@@ -71,6 +100,16 @@ func (s *Schema) EvtFile(evtID string) (path string, err error) {
 	return
 }
 
+// JournalFile returns "/tmp/workspace/evts/<EVTID>/journal.jsonl", i.e. the absolute path to the journal of the commands run for the event
+func (s *Schema) JournalFile(evtID string) (path string, err error) {
+	path, err = s.Evts(evtID)
+	if err != nil {
+		return
+	}
+	path = filepath.Join(path, EvtJournalFile)
+	return
+}
+
 // ConfigDir returns /tmp/workspace/evts/drop-28b10d4eff415a7b0b2c/nodeconfig
 func (s *Schema) ConfigDir(eventID string) (finalPath string, err error) {
 	p, err := s.Evts(eventID)
@@ -111,6 +150,71 @@ type WebSchema struct {
 	ListenAddress   string `mapstructure:"listen_address"`
 	DefaultProvider string `mapstructure:"default_provider"`
 	UsersDbFile     string `mapstructure:"users_db_file"`
+	JobsDbFile      string `mapstructure:"jobs_db_file"`
+}
+
+// Secrets configures the master key encrypting the secrets in the workspace,
+// the LCTRLD_MASTER_KEY environment variable takes precedence
+type Secrets struct {
+	// MasterKey is the base64 encoded 32 bytes master key
+	MasterKey string `mapstructure:"master_key"`
+	// KeyFile is a file holding the base64 encoded master key
+	KeyFile string `mapstructure:"key_file"`
+}
+
+// GoString redacts the master key when the settings are printed with %#v
+func (s Secrets) GoString() string {
+	masterKey := ""
+	if s.MasterKey != "" {
+		masterKey = "REDACTED"
+	}
+	return fmt.Sprintf("config.Secrets{MasterKey:%q, KeyFile:%q}", masterKey, s.KeyFile)
+}
+
+// Provisioning configures how the machines of an event are created
+type Provisioning struct {
+	// Workers is the maximum number of machines created at the same time
+	Workers int `mapstructure:"workers"`
+}
+
+// LocalDocker configures the provider that runs the machines of an event as
+// docker-in-docker containers on the lctrld host
+type LocalDocker struct {
+	// Image is the docker-in-docker image used for the machines
+	Image string `mapstructure:"image"`
+	// ReadyTimeout is how long to wait for the docker daemon of a machine
+	ReadyTimeout time.Duration `mapstructure:"ready_timeout"`
+}
+
+// Commands configures the execution of external commands
+type Commands struct {
+	// DefaultTimeout applies to the commands without a specific timeout
+	DefaultTimeout time.Duration `mapstructure:"default_timeout"`
+	// Timeouts maps "<binary> <subcommand>" or "<binary>" to a timeout,
+	// e.g. "docker-machine create" or "docker"
+	Timeouts map[string]time.Duration `mapstructure:"timeouts"`
+}
+
+// Timeout returns the timeout for a command line, the most specific
+// configured timeout wins
+func (c Commands) Timeout(command []string) time.Duration {
+	if len(command) == 0 {
+		return c.DefaultTimeout
+	}
+	bin := filepath.Base(command[0])
+	for _, arg := range command[1:] {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if t, found := c.Timeouts[fmt.Sprintf("%s %s", bin, arg)]; found {
+			return t
+		}
+		break
+	}
+	if t, found := c.Timeouts[bin]; found {
+		return t
+	}
+	return c.DefaultTimeout
 }
 
 // DockerMachine describes the host's docker-machine binary
@@ -118,6 +222,7 @@ type DockerMachine struct {
 	Version   string                         `mapstructure:"version"`
 	BinaryURL string                         `mapstructure:"binary_url"`
 	Binary    string                         `mapstructure:"binary"`
+	SHA256    string                         `mapstructure:"sha256"`
 	Drivers   map[string]DockerMachineDriver `mapstructure:"drivers"`
 	Env       []string                       `mapstructure:"env"`
 }
@@ -128,6 +233,7 @@ type DockerMachineDriver struct {
 	Version   string   `mapstructure:"version"`
 	BinaryURL string   `mapstructure:"binary_url"`
 	Binary    string   `mapstructure:"binary"`
+	SHA256    string   `mapstructure:"sha256"`
 	Params    []string `mapstructure:"params"`
 	Env       []string `mapstructure:"env"`
 }
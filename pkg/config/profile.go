@@ -0,0 +1,277 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Built-in payload profiles
+const (
+	// ProfileLegacy is the launchpayload and gaia 0.39 syntax, with separate
+	// daemon and CLI binaries and homes
+	ProfileLegacy = "legacy"
+	// ProfileStargate is the Cosmos SDK 0.40+ syntax, with a single binary
+	// and the keyring in the daemon home
+	ProfileStargate = "stargate"
+	// DefaultPayloadProfile is used by the payloads without a profile
+	DefaultPayloadProfile = ProfileLegacy
+)
+
+// Genesis layouts of the payloads
+const (
+	// GenesisLegacy is the Cosmos SDK 0.39 genesis, with the balances in the
+	// auth accounts, amino genesis transactions and durations in nanoseconds
+	GenesisLegacy = "legacy"
+	// GenesisStargate is the Cosmos SDK 0.40+ genesis, with the balances in
+	// the bank module, protobuf genesis transactions and durations like 600s
+	GenesisStargate = "stargate"
+)
+
+// PayloadProfile describes how to run the commands of a payload and how its
+// containers are started. The commands and entrypoints are lists of
+// text/template arguments rendered with ProfileArgs, the arguments rendered
+// empty are dropped.
+type PayloadProfile struct {
+	// Extends is the built-in profile providing the settings left empty
+	Extends string `mapstructure:"extends"`
+	// SingleBinary payloads run the CLI commands with the daemon binary
+	SingleBinary bool `mapstructure:"single_binary"`
+	// DaemonHome and CLIHome are the folders of the node configuration
+	// folder used as daemon and CLI home, they can be the same
+	DaemonHome string `mapstructure:"daemon_home"`
+	CLIHome    string `mapstructure:"cli_home"`
+	// GenesisLayout is the layout of the genesis written by the payload,
+	// GenesisLegacy or GenesisStargate. It defaults to GenesisLegacy.
+	GenesisLayout string `mapstructure:"genesis_layout"`
+	// Commands are the command lines run to configure the payload
+	Commands ProfileCommands `mapstructure:"commands"`
+	// Entrypoints are the commands run in the payload containers
+	Entrypoints ProfileEntrypoints `mapstructure:"entrypoints"`
+}
+
+// ProfileCommands are the command line templates of a payload profile
+type ProfileCommands struct {
+	Init              []string `mapstructure:"init"`
+	ShowNodeID        []string `mapstructure:"show_node_id"`
+	KeysAdd           []string `mapstructure:"keys_add"`
+	AddGenesisAccount []string `mapstructure:"add_genesis_account"`
+	Gentx             []string `mapstructure:"gentx"`
+	CollectGentxs     []string `mapstructure:"collect_gentxs"`
+}
+
+// ProfileEntrypoints are the container command templates of a payload
+// profile, an empty Node entrypoint runs the default command of the image
+type ProfileEntrypoints struct {
+	Node         []string `mapstructure:"node"`
+	LightClient  []string `mapstructure:"light_client"`
+	Faucet       []string `mapstructure:"faucet"`
+	FaucetConfig []string `mapstructure:"faucet_config"`
+}
+
+// ProfileArgs are the values available to the payload profile templates
+type ProfileArgs struct {
+	// Daemon and CLI are the paths of the payload binaries
+	Daemon string
+	CLI    string
+	// Home and CLIHome are the daemon and CLI home of the node
+	Home    string
+	CLIHome string
+	ChainID string
+	Moniker string
+	// Name is the name of the account
+	Name    string
+	Address string
+	// Coins is the genesis balance of the account
+	Coins string
+	// Amount is the self delegation of a validator
+	Amount string
+	// IP is the address of the node
+	IP string
+	// Output is the file the genesis transaction is written to
+	Output string
+	// GentxDir is the folder with the genesis transactions
+	GentxDir string
+	// Recover is set when a key is recovered from a mnemonic
+	Recover bool
+	// Symbol is the token symbol of the event
+	Symbol string
+}
+
+// builtinProfiles are the payload profiles shipped with lctrld
+var builtinProfiles = map[string]PayloadProfile{
+	ProfileLegacy: {
+		DaemonHome:    "daemon",
+		CLIHome:       "cli",
+		GenesisLayout: GenesisLegacy,
+		Commands: ProfileCommands{
+			Init:              []string{"{{.Daemon}}", "init", "{{.Moniker}}", "--home", "{{.Home}}", "--chain-id", "{{.ChainID}}"},
+			ShowNodeID:        []string{"{{.Daemon}}", "tendermint", "show-node-id", "--home", "{{.Home}}"},
+			KeysAdd:           []string{"{{.CLI}}", "keys", "add", "{{.Name}}", "-o", "json", "--keyring-backend", "test", "--home", "{{.CLIHome}}", "{{if .Recover}}--recover{{end}}"},
+			AddGenesisAccount: []string{"{{.Daemon}}", "add-genesis-account", "{{.Address}}", "{{.Coins}}", "--home", "{{.Home}}"},
+			Gentx:             []string{"{{.Daemon}}", "gentx", "--name", "{{.Name}}", "--ip", "{{.IP}}", "--amount", "{{.Amount}}", "--home-client", "{{.CLIHome}}", "--keyring-backend", "test", "--home", "{{.Home}}", "--output-document", "{{.Output}}"},
+			CollectGentxs:     []string{"{{.Daemon}}", "collect-gentxs", "--gentx-dir", "{{.GentxDir}}", "--home", "{{.Home}}"},
+		},
+		Entrypoints: ProfileEntrypoints{
+			LightClient:  []string{"/payload/runlightclient.sh", "{{.IP}}", "{{.ChainID}}"},
+			Faucet:       []string{"/payload/runfaucet.sh"},
+			FaucetConfig: []string{"/payload/configurefaucet.sh", "{{.ChainID}}", "{{.Address}}", "{{.Symbol}}", "{{.IP}}"},
+		},
+	},
+	ProfileStargate: {
+		SingleBinary:  true,
+		DaemonHome:    "daemon",
+		CLIHome:       "daemon",
+		GenesisLayout: GenesisStargate,
+		Commands: ProfileCommands{
+			Init:              []string{"{{.Daemon}}", "init", "{{.Moniker}}", "--home", "{{.Home}}", "--chain-id", "{{.ChainID}}"},
+			ShowNodeID:        []string{"{{.Daemon}}", "tendermint", "show-node-id", "--home", "{{.Home}}"},
+			KeysAdd:           []string{"{{.Daemon}}", "keys", "add", "{{.Name}}", "--output", "json", "--keyring-backend", "test", "--home", "{{.CLIHome}}", "{{if .Recover}}--recover{{end}}"},
+			AddGenesisAccount: []string{"{{.Daemon}}", "add-genesis-account", "{{.Address}}", "{{.Coins}}", "--home", "{{.Home}}"},
+			Gentx:             []string{"{{.Daemon}}", "gentx", "{{.Name}}", "{{.Amount}}", "--chain-id", "{{.ChainID}}", "--ip", "{{.IP}}", "--keyring-backend", "test", "--home", "{{.Home}}", "--output-document", "{{.Output}}"},
+			CollectGentxs:     []string{"{{.Daemon}}", "collect-gentxs", "--gentx-dir", "{{.GentxDir}}", "--home", "{{.Home}}"},
+		},
+		Entrypoints: ProfileEntrypoints{
+			LightClient:  []string{"/payload/runlightclient.sh", "{{.IP}}", "{{.ChainID}}"},
+			Faucet:       []string{"/payload/runfaucet.sh"},
+			FaucetConfig: []string{"/payload/configurefaucet.sh", "{{.ChainID}}", "{{.Address}}", "{{.Symbol}}", "{{.IP}}"},
+		},
+	},
+}
+
+// PayloadProfiles returns the names of the available payload profiles, the
+// built-in ones and the ones in the configuration
+func (s *Schema) PayloadProfiles() (names []string) {
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	for name := range s.Profiles {
+		if _, builtin := builtinProfiles[name]; !builtin {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// PayloadProfile returns a payload profile by name, the profiles in the
+// configuration take precedence over the built-in ones. An empty name is the
+// DefaultPayloadProfile.
+func (s *Schema) PayloadProfile(name string) (p PayloadProfile, err error) {
+	if name == "" {
+		name = DefaultPayloadProfile
+	}
+	p, found := s.Profiles[name]
+	if !found {
+		if p, found = builtinProfiles[name]; !found {
+			return p, fmt.Errorf("unknown payload profile %s, the available profiles are: %s", name, strings.Join(s.PayloadProfiles(), ", "))
+		}
+		return
+	}
+	if p.Extends != "" {
+		base, found := builtinProfiles[p.Extends]
+		if !found {
+			return p, fmt.Errorf("payload profile %s extends %s, which is not a built-in profile", name, p.Extends)
+		}
+		p = p.extend(base)
+	}
+	if err = p.Validate(); err != nil {
+		return p, fmt.Errorf("payload profile %s: %w", name, err)
+	}
+	return
+}
+
+// extend fills the empty settings of the profile with the ones of base
+func (p PayloadProfile) extend(base PayloadProfile) PayloadProfile {
+	p.SingleBinary = p.SingleBinary || base.SingleBinary
+	for _, f := range []struct{ value, base *string }{
+		{&p.DaemonHome, &base.DaemonHome},
+		{&p.CLIHome, &base.CLIHome},
+		{&p.GenesisLayout, &base.GenesisLayout},
+	} {
+		if *f.value == "" {
+			*f.value = *f.base
+		}
+	}
+	for _, f := range []struct{ value, base *[]string }{
+		{&p.Commands.Init, &base.Commands.Init},
+		{&p.Commands.ShowNodeID, &base.Commands.ShowNodeID},
+		{&p.Commands.KeysAdd, &base.Commands.KeysAdd},
+		{&p.Commands.AddGenesisAccount, &base.Commands.AddGenesisAccount},
+		{&p.Commands.Gentx, &base.Commands.Gentx},
+		{&p.Commands.CollectGentxs, &base.Commands.CollectGentxs},
+		{&p.Entrypoints.Node, &base.Entrypoints.Node},
+		{&p.Entrypoints.LightClient, &base.Entrypoints.LightClient},
+		{&p.Entrypoints.Faucet, &base.Entrypoints.Faucet},
+		{&p.Entrypoints.FaucetConfig, &base.Entrypoints.FaucetConfig},
+	} {
+		if len(*f.value) == 0 {
+			*f.value = *f.base
+		}
+	}
+	return p
+}
+
+// Validate checks that the profile defines all the commands and that the
+// templates are valid
+func (p PayloadProfile) Validate() (err error) {
+	if p.DaemonHome == "" || p.CLIHome == "" {
+		return fmt.Errorf("the daemon_home and the cli_home are required")
+	}
+	if p.GenesisLayout != "" && p.GenesisLayout != GenesisLegacy && p.GenesisLayout != GenesisStargate {
+		return fmt.Errorf("unknown genesis_layout %s, the layouts are %s and %s", p.GenesisLayout, GenesisLegacy, GenesisStargate)
+	}
+	for name, command := range map[string][]string{
+		"init":                p.Commands.Init,
+		"show_node_id":        p.Commands.ShowNodeID,
+		"keys_add":            p.Commands.KeysAdd,
+		"add_genesis_account": p.Commands.AddGenesisAccount,
+		"gentx":               p.Commands.Gentx,
+		"collect_gentxs":      p.Commands.CollectGentxs,
+		"light_client":        p.Entrypoints.LightClient,
+		"faucet":              p.Entrypoints.Faucet,
+		"faucet_config":       p.Entrypoints.FaucetConfig,
+	} {
+		if len(command) == 0 {
+			return fmt.Errorf("the %s command is missing", name)
+		}
+		if _, err = p.Render(command, ProfileArgs{}); err != nil {
+			return fmt.Errorf("invalid %s command: %w", name, err)
+		}
+	}
+	_, err = p.Render(p.Entrypoints.Node, ProfileArgs{})
+	return
+}
+
+// Genesis returns the genesis layout of the profile
+func (p PayloadProfile) Genesis() string {
+	if p.GenesisLayout == "" {
+		return GenesisLegacy
+	}
+	return p.GenesisLayout
+}
+
+// Render renders a command template of the profile, the CLI defaults to the
+// daemon for single binary payloads
+func (p PayloadProfile) Render(command []string, args ProfileArgs) (rendered []string, err error) {
+	if p.SingleBinary {
+		args.CLI = args.Daemon
+	}
+	rendered = make([]string, 0, len(command))
+	for _, arg := range command {
+		t, err := template.New("arg").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err = t.Execute(&b, args); err != nil {
+			return nil, err
+		}
+		if b.Len() > 0 {
+			rendered = append(rendered, b.String())
+		}
+	}
+	return
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadProfile(t *testing.T) {
+	s := &Schema{Profiles: map[string]PayloadProfile{
+		"mychain": {
+			Extends:     ProfileStargate,
+			Entrypoints: ProfileEntrypoints{Node: []string{"mychaind", "start", "--home", "/payload/config/daemon"}},
+		},
+		"broken":  {Extends: ProfileLegacy, Commands: ProfileCommands{Init: []string{"{{.Nope}}"}}},
+		"orphan":  {Extends: "gaia"},
+		"partial": {DaemonHome: "daemon", CLIHome: "cli"},
+		"layout":  {Extends: ProfileLegacy, GenesisLayout: "amino"},
+	}}
+	assert.Equal(t, []string{"broken", "layout", ProfileLegacy, "mychain", "orphan", "partial", ProfileStargate}, s.PayloadProfiles())
+
+	// the default profile
+	p, err := s.PayloadProfile("")
+	require.Nil(t, err)
+	assert.Equal(t, GenesisLegacy, p.Genesis())
+	command, err := p.Render(p.Commands.KeysAdd, ProfileArgs{CLI: "launchpayloadcli", Name: "alice", CLIHome: "/cli"})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"launchpayloadcli", "keys", "add", "alice", "-o", "json", "--keyring-backend", "test", "--home", "/cli"}, command)
+	command, err = p.Render(p.Commands.KeysAdd, ProfileArgs{CLI: "launchpayloadcli", Name: "alice", CLIHome: "/cli", Recover: true})
+	require.Nil(t, err)
+	assert.Equal(t, "--recover", command[len(command)-1])
+
+	// a custom profile extending a built-in one
+	p, err = s.PayloadProfile("mychain")
+	require.Nil(t, err)
+	assert.True(t, p.SingleBinary)
+	assert.Equal(t, p.DaemonHome, p.CLIHome)
+	assert.Equal(t, GenesisStargate, p.Genesis())
+	command, err = p.Render(p.Commands.KeysAdd, ProfileArgs{Daemon: "mychaind", CLI: "mychaincli", Name: "alice", CLIHome: "/daemon"})
+	require.Nil(t, err)
+	assert.Equal(t, "mychaind", command[0])
+	command, err = p.Render(p.Commands.Gentx, ProfileArgs{Daemon: "mychaind", Name: "alice", Amount: "100stake", ChainID: "drop", IP: "10.0.0.1", Home: "/daemon", Output: "/gentx.json"})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"mychaind", "gentx", "alice", "100stake", "--chain-id", "drop", "--ip", "10.0.0.1", "--keyring-backend", "test", "--home", "/daemon", "--output-document", "/gentx.json"}, command)
+	command, err = p.Render(p.Entrypoints.Node, ProfileArgs{})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"mychaind", "start", "--home", "/payload/config/daemon"}, command)
+
+	for name, msg := range map[string]string{
+		"broken":  "payload profile broken: invalid init command",
+		"orphan":  "payload profile orphan extends gaia, which is not a built-in profile",
+		"partial": "payload profile partial: the",
+		"layout":  "payload profile layout: unknown genesis_layout amino",
+		"gaia":    "unknown payload profile gaia, the available profiles are: broken, layout, legacy",
+	} {
+		_, err = s.PayloadProfile(name)
+		require.NotNil(t, err, name)
+		assert.Contains(t, err.Error(), msg)
+	}
+}
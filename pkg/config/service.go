@@ -0,0 +1,224 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Services of the default payload deployment
+const (
+	ServiceDaemon      = "daemon"
+	ServiceLightClient = "lightclient"
+	ServiceFaucet      = "faucet"
+)
+
+// Placements of the services
+const (
+	// NodesAll runs a service on every node of the event
+	NodesAll = "all"
+	// NodesServices runs a service on the node running the light client and
+	// the faucet
+	NodesServices = "services"
+)
+
+// NodeConfigVolume mounts the node configuration copied on the machines in
+// the payload containers
+const NodeConfigVolume = "/home/docker/nodeconfig:/payload/config"
+
+var (
+	// portPattern matches the docker run port mappings, [[ip:]host:]container[/protocol]
+	portPattern = regexp.MustCompile(`^(([0-9.]+:)?[0-9]+(-[0-9]+)?:)?[0-9]+(-[0-9]+)?(/(tcp|udp))?$`)
+	// serviceNamePattern matches the names that can be part of a container name
+	serviceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	// restartPattern matches the docker restart policies
+	restartPattern = regexp.MustCompile(`^(no|always|unless-stopped|on-failure(:[0-9]+)?)$`)
+)
+
+// ServiceSpec describes a container run on the nodes of an event
+type ServiceSpec struct {
+	// Name is the key of the service in the payload services
+	Name string `mapstructure:"-" yaml:"-" json:"name"`
+	// Image defaults to the docker image of the payload
+	Image string `mapstructure:"image" yaml:"image" json:"image,omitempty"`
+	// Command and Env are Go templates, see ProfileArgs
+	Command []string `mapstructure:"command" yaml:"command" json:"command,omitempty"`
+	Env     []string `mapstructure:"env" yaml:"env" json:"env,omitempty"`
+	// Ports are docker run port mappings, i.e. 26656:26656
+	Ports   []string `mapstructure:"ports" yaml:"ports" json:"ports,omitempty"`
+	Volumes []string `mapstructure:"volumes" yaml:"volumes" json:"volumes,omitempty"`
+	// CPUs and Memory are the docker run resource limits, i.e. 1.5 and 512m
+	CPUs   string `mapstructure:"cpus" yaml:"cpus" json:"cpus,omitempty"`
+	Memory string `mapstructure:"memory" yaml:"memory" json:"memory,omitempty"`
+	// Restart is the docker restart policy
+	Restart string `mapstructure:"restart" yaml:"restart" json:"restart,omitempty"`
+	// Nodes are where the service runs: all, services or node roles. It
+	// defaults to every node.
+	Nodes    []string `mapstructure:"nodes" yaml:"nodes" json:"nodes,omitempty"`
+	Disabled bool     `mapstructure:"disabled" yaml:"disabled" json:"disabled,omitempty"`
+}
+
+// DefaultServices returns the services of a payload deployment: the daemon on
+// every node, the light client and the faucet on the services node
+func DefaultServices(profile PayloadProfile) map[string]ServiceSpec {
+	return map[string]ServiceSpec{
+		ServiceDaemon: {
+			Command: profile.Entrypoints.Node,
+			Ports:   []string{"26656:26656", "26657:26657", "26658:26658"},
+			Volumes: []string{NodeConfigVolume},
+			Nodes:   []string{NodesAll},
+		},
+		ServiceLightClient: {
+			Command: profile.Entrypoints.LightClient,
+			Ports:   []string{"1317:1317"},
+			Volumes: []string{NodeConfigVolume},
+			Nodes:   []string{NodesServices},
+		},
+		ServiceFaucet: {
+			Command: profile.Entrypoints.Faucet,
+			Ports:   []string{"8000:8000"},
+			Volumes: []string{NodeConfigVolume},
+			Nodes:   []string{NodesServices},
+		},
+	}
+}
+
+// PayloadServices returns the services deployed for a payload of the
+// catalog: the default services, merged with the services of the payload and
+// then with the overrides of the event request. The overrides can only
+// change the ports, env, resource limits and restart policy of the services
+// or disable them; the images, commands, volumes and placements are approved
+// by the operator in the catalog. The default services come first, the other
+// services are sorted by name.
+func (s *Schema) PayloadServices(p CatalogPayload, overrides map[string]ServiceSpec) (services []ServiceSpec, err error) {
+	profile, err := s.PayloadProfile(p.Profile)
+	if err != nil {
+		return
+	}
+	specs := DefaultServices(profile)
+	for name, spec := range p.Services {
+		specs[name] = specs[name].merge(spec)
+	}
+	for name, o := range overrides {
+		spec, found := specs[name]
+		if !found {
+			return nil, fmt.Errorf("the service %s is not a service of the payload %s", name, p.Name)
+		}
+		if o.Image != "" || len(o.Command) > 0 || len(o.Volumes) > 0 || len(o.Nodes) > 0 {
+			return nil, fmt.Errorf("service %s: the image, command, volumes and nodes can only be set in the payload catalog", name)
+		}
+		specs[name] = spec.merge(o)
+	}
+	if specs[ServiceDaemon].Disabled {
+		return nil, fmt.Errorf("the %s service cannot be disabled", ServiceDaemon)
+	}
+	for name, spec := range specs {
+		spec.Name = name
+		if spec.Disabled {
+			continue
+		}
+		if err = spec.validate(profile); err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		services = append(services, spec)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		oi, oj := serviceOrder(services[i].Name), serviceOrder(services[j].Name)
+		if oi != oj {
+			return oi < oj
+		}
+		return services[i].Name < services[j].Name
+	})
+	return
+}
+
+// serviceOrder returns the rank of a service in the deployment, the default
+// services come first
+func serviceOrder(name string) int {
+	for i, s := range []string{ServiceDaemon, ServiceLightClient, ServiceFaucet} {
+		if s == name {
+			return i
+		}
+	}
+	return 3
+}
+
+// merge returns the spec with the settings of o that are not empty
+func (s ServiceSpec) merge(o ServiceSpec) ServiceSpec {
+	if o.Image != "" {
+		s.Image = o.Image
+	}
+	if len(o.Command) > 0 {
+		s.Command = o.Command
+	}
+	if len(o.Env) > 0 {
+		s.Env = o.Env
+	}
+	if len(o.Ports) > 0 {
+		s.Ports = o.Ports
+	}
+	if len(o.Volumes) > 0 {
+		s.Volumes = o.Volumes
+	}
+	if o.CPUs != "" {
+		s.CPUs = o.CPUs
+	}
+	if o.Memory != "" {
+		s.Memory = o.Memory
+	}
+	if o.Restart != "" {
+		s.Restart = o.Restart
+	}
+	if len(o.Nodes) > 0 {
+		s.Nodes = o.Nodes
+	}
+	s.Disabled = s.Disabled || o.Disabled
+	return s
+}
+
+// validate checks the templates and the settings that docker would refuse
+func (s ServiceSpec) validate(profile PayloadProfile) error {
+	if _, err := profile.Render(s.Command, ProfileArgs{}); err != nil {
+		return fmt.Errorf("invalid command: %w", err)
+	}
+	if _, err := profile.Render(s.Env, ProfileArgs{}); err != nil {
+		return fmt.Errorf("invalid env: %w", err)
+	}
+	if !serviceNamePattern.MatchString(s.Name) {
+		return fmt.Errorf("invalid name, the names are made of letters, digits, _, . and -")
+	}
+	for _, p := range s.Ports {
+		if !portPattern.MatchString(p) {
+			return fmt.Errorf("invalid port %s", p)
+		}
+	}
+	for _, e := range s.Env {
+		if strings.HasPrefix(e, "=") || !strings.Contains(e, "=") {
+			return fmt.Errorf("invalid env %s, the format is KEY=value", e)
+		}
+	}
+	for _, v := range s.Volumes {
+		if len(strings.Split(v, ":")) < 2 {
+			return fmt.Errorf("invalid volume %s, the format is host:container[:options]", v)
+		}
+	}
+	if s.Restart != "" && !restartPattern.MatchString(s.Restart) {
+		return fmt.Errorf("invalid restart policy %s", s.Restart)
+	}
+	return nil
+}
+
+// RunsOn tells if a service runs on a node with a role, services is true for
+// the node running the light client and the faucet
+func (s ServiceSpec) RunsOn(role string, services bool) bool {
+	if len(s.Nodes) == 0 {
+		return true
+	}
+	for _, n := range s.Nodes {
+		if n == NodesAll || n == role || (n == NodesServices && services) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadServices(t *testing.T) {
+	s := &Schema{}
+	p, err := s.CatalogPayload("")
+	require.Nil(t, err)
+
+	// the default services
+	services, err := s.PayloadServices(p, nil)
+	require.Nil(t, err)
+	require.Len(t, services, 3)
+	assert.Equal(t, ServiceDaemon, services[0].Name)
+	assert.Equal(t, ServiceLightClient, services[1].Name)
+	assert.Equal(t, ServiceFaucet, services[2].Name)
+	assert.True(t, services[0].RunsOn("seed", false))
+	assert.False(t, services[1].RunsOn("validator", false))
+	assert.True(t, services[1].RunsOn("full", true))
+
+	// the services of the payload and the overrides of the request
+	p.Services = map[string]ServiceSpec{
+		"explorer":         {Image: "example/explorer:v1", Ports: []string{"8080:80"}, Nodes: []string{"full"}},
+		ServiceLightClient: {Disabled: true},
+	}
+	services, err = s.PayloadServices(p, map[string]ServiceSpec{
+		ServiceDaemon: {Ports: []string{"26656:26656", "9090:9090/tcp"}, CPUs: "1.5", Restart: "on-failure:3"},
+	})
+	require.Nil(t, err)
+	require.Len(t, services, 3)
+	assert.Equal(t, []string{ServiceDaemon, ServiceFaucet, "explorer"}, []string{services[0].Name, services[1].Name, services[2].Name})
+	assert.Equal(t, []string{"26656:26656", "9090:9090/tcp"}, services[0].Ports)
+	assert.Equal(t, []string{NodeConfigVolume}, services[0].Volumes)
+	assert.Equal(t, "1.5", services[0].CPUs)
+
+	for msg, overrides := range map[string]map[string]ServiceSpec{
+		"the service miner is not a service of the payload launchpayload": {"miner": {}},
+		"service explorer: the image, command, volumes and nodes":         {"explorer": {Volumes: []string{"/:/host"}}},
+		"the daemon service cannot be disabled":                           {ServiceDaemon: {Disabled: true}},
+		"service faucet: invalid port 80:http":                            {ServiceFaucet: {Ports: []string{"80:http"}}},
+		"service faucet: invalid env DEBUG":                               {ServiceFaucet: {Env: []string{"DEBUG"}}},
+		"service faucet: invalid env: ":                                   {ServiceFaucet: {Env: []string{"NODE={{.Nope}}"}}},
+		"service faucet: invalid restart policy sometimes":                {ServiceFaucet: {Restart: "sometimes"}},
+	} {
+		_, err = s.PayloadServices(p, overrides)
+		require.NotNil(t, err, msg)
+		assert.Contains(t, err.Error(), msg)
+	}
+}
@@ -0,0 +1,218 @@
+package lctrld
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
+)
+
+// KeyBundleFile is the descriptor of the account in a key bundle
+const KeyBundleFile = "account.json"
+
+// ErrorNoKeys is returned when exporting an account that has no keys
+var ErrorNoKeys = errors.New("the account has no keys")
+
+// KeyBundle describes an account and how to connect to the chain of its event
+type KeyBundle struct {
+	EventID     string       `json:"event_id"`
+	ChainID     string       `json:"chain_id"`
+	Name        string       `json:"name"`
+	Address     string       `json:"address"`
+	Mnemonic    string       `json:"mnemonic"`
+	Nodes       []BundleNode `json:"nodes"`
+	LightClient string       `json:"light_client,omitempty"`
+	Faucet      string       `json:"faucet,omitempty"`
+	CreatedOn   time.Time    `json:"created_on"`
+}
+
+// BundleNode is the Tendermint RPC endpoint of a node
+type BundleNode struct {
+	Account string         `json:"account"`
+	Role    model.NodeRole `json:"role"`
+	RPC     string         `json:"rpc"`
+}
+
+// KeyBundleName returns the file name of the key bundle of an account
+func KeyBundleName(evt *model.Event, name string, encrypted bool) string {
+	fileName := fmt.Sprintf("%s-%s.tar.gz", evt.ID(), name)
+	if encrypted {
+		fileName += ".enc"
+	}
+	return fileName
+}
+
+// NewKeyBundle collects the key of an account, the mnemonic is decrypted
+func NewKeyBundle(settings *config.Schema, evt *model.Event, name string) (b *KeyBundle, err error) {
+	acc, found := evt.Accounts[name]
+	if !found {
+		return nil, fmt.Errorf("event %s has no account %s", evt.ID(), name)
+	}
+	if acc.External {
+		return nil, fmt.Errorf("%w: %s is external", ErrorNoKeys, name)
+	}
+	if acc.Address == "" || acc.Mnemonic == "" || acc.ConfigLocation.CLIConfigDir == "" {
+		return nil, fmt.Errorf("%w: the keys of %s have not been generated yet", ErrorNoKeys, name)
+	}
+	keeper, err := secrets.FromSettings(settings)
+	if err != nil {
+		return
+	}
+	mnemonic, err := keeper.Open(acc.Mnemonic)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt the mnemonic of %s: %w", name, err)
+	}
+	b = &KeyBundle{
+		EventID:   evt.ID(),
+		ChainID:   evt.ChainID(),
+		Name:      acc.Name,
+		Address:   acc.Address,
+		Mnemonic:  mnemonic,
+		Nodes:     make([]BundleNode, 0, len(evt.State)),
+		CreatedOn: time.Now(),
+	}
+	endpoints, err := eventEndpoints(settings, evt)
+	if err != nil {
+		return nil, err
+	}
+	// the validators shielded by sentries are not listed
+	for _, node := range evt.NodeNames() {
+		rpc, found := endpoints.RPC[node]
+		if !found || (evt.NodeRole(node) == model.RoleValidator && len(evt.Sentries(node)) > 0) {
+			continue
+		}
+		b.Nodes = append(b.Nodes, BundleNode{Account: node, Role: evt.NodeRole(node), RPC: "tcp://" + rpc})
+	}
+	if endpoints.LightClient != "" {
+		b.LightClient = "http://" + endpoints.LightClient
+	}
+	if endpoints.Faucet != "" && evt.FaucetAccount() != nil {
+		b.Faucet = "http://" + endpoints.Faucet
+	}
+	return
+}
+
+// WriteKeyBundle writes the tar.gz archive with the key bundle of an account
+// and the keyring directories of its CLI home, under cli/. If passphrase is
+// not empty the archive is encrypted as openssl enc does, see
+// secrets.EncryptWithPassphrase.
+func WriteKeyBundle(w io.Writer, settings *config.Schema, evt *model.Event, name, passphrase string) (err error) {
+	b, err := NewKeyBundle(settings, evt, name)
+	if err != nil {
+		return
+	}
+	descriptor, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return
+	}
+	var archive bytes.Buffer
+	gw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gw)
+	root := fmt.Sprintf("%s-%s", evt.ID(), name)
+	if err = tw.WriteHeader(&tar.Header{Name: root + "/" + KeyBundleFile, Mode: 0600, Size: int64(len(descriptor)), ModTime: b.CreatedOn}); err != nil {
+		return
+	}
+	if _, err = tw.Write(descriptor); err != nil {
+		return
+	}
+	// only the keyring is exported, the CLI home is the daemon home of the
+	// single binary payloads and holds the consensus keys of the node
+	keyrings, err := filepath.Glob(filepath.Join(evt.Accounts[name].ConfigLocation.CLIConfigDir, "keyring-*"))
+	if err != nil {
+		return
+	}
+	if len(keyrings) == 0 {
+		return fmt.Errorf("%w: the keyring of %s was not found", ErrorNoKeys, name)
+	}
+	for _, k := range keyrings {
+		if err = addDirToTar(tw, k, root+"/cli/"+filepath.Base(k)); err != nil {
+			return fmt.Errorf("cannot add the keyring of %s: %w", name, err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return
+	}
+	if err = gw.Close(); err != nil {
+		return
+	}
+	data := archive.Bytes()
+	if passphrase != "" {
+		if data, err = secrets.EncryptWithPassphrase(data, passphrase); err != nil {
+			return
+		}
+	}
+	_, err = w.Write(data)
+	return
+}
+
+// addDirToTar adds the files in dir to the archive under prefix
+func addDirToTar(tw *tar.Writer, dir, prefix string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+}
+
+// ExportKeys writes the key bundle of every account of the event having keys
+// in dir, external accounts are skipped. It returns the paths of the bundles.
+func ExportKeys(settings *config.Schema, evt *model.Event, dir, passphrase string) (files []string, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	names := make([]string, 0, len(evt.Accounts))
+	for name, acc := range evt.Accounts {
+		if !acc.External {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var bundle bytes.Buffer
+		if err = WriteKeyBundle(&bundle, settings, evt, name, passphrase); err != nil {
+			return
+		}
+		file := filepath.Join(dir, KeyBundleName(evt, name, passphrase != ""))
+		if err = ioutil.WriteFile(file, bundle.Bytes(), 0600); err != nil {
+			return
+		}
+		files = append(files, file)
+	}
+	return
+}
@@ -0,0 +1,99 @@
+package lctrld
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readBundle returns the files of a key bundle by name
+func readBundle(t *testing.T, data []byte) map[string][]byte {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	require.Nil(t, err)
+	tr := tar.NewReader(gr)
+	files := make(map[string][]byte)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		files[h.Name], err = ioutil.ReadAll(tr)
+		require.Nil(t, err)
+	}
+	return files
+}
+
+func TestWriteKeyBundle(t *testing.T) {
+	os.Unsetenv(secrets.MasterKeyEnv)
+	key, _ := secrets.GenerateKey()
+	settings := &config.Schema{Workspace: t.TempDir(), Secrets: config.Secrets{MasterKey: key}}
+	evt := model.NewEvent("drop", "owner@apeunit.com", "virtualbox", []model.GenesisAccount{
+		{Name: "alice", GenesisBalance: model.MustParseCoins("100stake"), Validator: true},
+		{Name: "sponsor", GenesisBalance: model.MustParseCoins("100drop"), Address: "cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0p"},
+	}, model.PayloadLocation{})
+	evt.State["alice"] = &model.Machine{N: "0", EventID: evt.ID(), Instance: model.MachineNetworkConfig{IPAddress: "192.168.99.100"}}
+
+	// the keys are not generated yet
+	var bundle bytes.Buffer
+	err := WriteKeyBundle(&bundle, settings, evt, "alice", "")
+	assert.True(t, errors.Is(err, ErrorNoKeys))
+
+	alice := evt.Accounts["alice"]
+	alice.Address = "cosmos1tnets25l2wx0w48ml092vl588zsnhg57lm7a0y"
+	alice.Mnemonic = "abandon abandon about"
+	alice.ConfigLocation.CLIConfigDir = t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(alice.ConfigLocation.CLIConfigDir, "keyring-test"), 0700))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(alice.ConfigLocation.CLIConfigDir, "keyring-test", "alice.info"), []byte("key"), 0600))
+	// the CLI home is the daemon home of the stargate payloads
+	require.Nil(t, os.MkdirAll(filepath.Join(alice.ConfigLocation.CLIConfigDir, "config"), 0700))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(alice.ConfigLocation.CLIConfigDir, "config", "priv_validator_key.json"), []byte("{}"), 0600))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(alice.ConfigLocation.CLIConfigDir, "config", "node_key.json"), []byte("{}"), 0600))
+	// the mnemonic is encrypted in the event
+	require.Nil(t, CreateEvent(settings, evt))
+	assert.True(t, alice.Mnemonic.IsSealed())
+
+	require.Nil(t, WriteKeyBundle(&bundle, settings, evt, "alice", ""))
+	files := readBundle(t, bundle.Bytes())
+	root := evt.ID() + "-alice/"
+	assert.Equal(t, []byte("key"), files[root+"cli/keyring-test/alice.info"])
+	for f := range files {
+		assert.NotContains(t, f, "priv_validator_key.json")
+		assert.NotContains(t, f, "node_key.json")
+	}
+	var b KeyBundle
+	require.Nil(t, json.Unmarshal(files[root+KeyBundleFile], &b))
+	assert.Equal(t, "abandon abandon about", b.Mnemonic)
+	assert.Equal(t, alice.Address, b.Address)
+	assert.Equal(t, evt.ChainID(), b.ChainID)
+	assert.Equal(t, []BundleNode{{Account: "alice", Role: model.RoleValidator, RPC: "tcp://192.168.99.100:26657"}}, b.Nodes)
+	assert.Equal(t, "http://192.168.99.100:1317", b.LightClient)
+
+	// encrypted with a passphrase
+	bundle.Reset()
+	require.Nil(t, WriteKeyBundle(&bundle, settings, evt, "alice", "secret"))
+	data, err := secrets.DecryptWithPassphrase(bundle.Bytes(), "secret")
+	require.Nil(t, err)
+	assert.Contains(t, readBundle(t, data), root+KeyBundleFile)
+
+	// external accounts have no keys and are not exported
+	err = WriteKeyBundle(&bundle, settings, evt, "sponsor", "")
+	assert.True(t, errors.Is(err, ErrorNoKeys))
+	exported, err := ExportKeys(settings, evt, t.TempDir(), "secret")
+	require.Nil(t, err)
+	require.Len(t, exported, 1)
+	assert.Equal(t, KeyBundleName(evt, "alice", true), filepath.Base(exported[0]))
+}
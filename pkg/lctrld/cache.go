@@ -0,0 +1,300 @@
+package lctrld
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/archive"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	"github.com/melbahja/got"
+	log "github.com/sirupsen/logrus"
+)
+
+// PayloadCacheManifest describes an entry of the payload cache
+const PayloadCacheManifest = "payload.json"
+
+// PayloadCacheGracePeriod is how long a cache entry is kept by prune after an
+// event setup resolved its binaries to it, the setup stores the event with
+// the path of the binaries only later
+const PayloadCacheGracePeriod = time.Hour
+
+// CachedPayload is a payload release in the cache, the entries are named
+// after the sha256 of the downloaded file
+type CachedPayload struct {
+	Key     string `json:"key"`
+	URL     string `json:"url"`
+	Version string `json:"version,omitempty"`
+	// SHA256 is the checksum of the downloaded file
+	SHA256 string `json:"sha256"`
+	// Binaries are the checksums of the binaries in the entry, by name
+	Binaries  map[string]string `json:"binaries"`
+	CreatedOn time.Time         `json:"created_on"`
+	// the following are set when listing the cache
+	Size   int64    `json:"size,omitempty"`
+	Events []string `json:"events,omitempty"`
+	// UsedOn is the last time an event setup resolved its binaries to the
+	// entry, the modification time of the manifest
+	UsedOn time.Time `json:"used_on,omitempty"`
+}
+
+// Dir returns the folder of the cache entry
+func (c *CachedPayload) Dir(settings *config.Schema) string {
+	return settings.PayloadCache(c.Key)
+}
+
+// payloadCacheKey returns the name of the cache entry of a download
+func payloadCacheKey(sha256 string) string {
+	return "sha256-" + strings.ToLower(sha256)
+}
+
+// payloadBinaries returns the names of the binaries of a payload
+func payloadBinaries(payload model.PayloadLocation, profile config.PayloadProfile) (binaries []string) {
+	binaries = []string{filepath.Base(payload.DaemonPath)}
+	if !profile.SingleBinary {
+		binaries = append(binaries, filepath.Base(payload.CLIPath))
+	}
+	return
+}
+
+// loadPayloadCache reads the entries of the payload cache, newest first
+func loadPayloadCache(settings *config.Schema) (entries []*CachedPayload, err error) {
+	dirs, err := ioutil.ReadDir(settings.PayloadCache(""))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	for _, d := range dirs {
+		manifest := filepath.Join(settings.PayloadCache(d.Name()), PayloadCacheManifest)
+		info, sErr := os.Stat(manifest)
+		if !d.IsDir() || sErr != nil {
+			continue
+		}
+		entry := new(CachedPayload)
+		if err = utils.LoadJSON(manifest, entry); err != nil {
+			return nil, fmt.Errorf("invalid payload cache entry %s: %w", d.Name(), err)
+		}
+		entry.UsedOn = info.ModTime()
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedOn.After(entries[j].CreatedOn) })
+	return
+}
+
+// findCachedPayload returns the cache entry of a payload, nil if there is
+// none: with the sha256 of the payload if it is set, otherwise the newest
+// download of its url. The entry must have all the binaries.
+func findCachedPayload(settings *config.Schema, payload model.PayloadLocation, binaries []string) (found *CachedPayload, err error) {
+	entries, err := loadPayloadCache(settings)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if payload.SHA256 != "" && e.Key != payloadCacheKey(payload.SHA256) {
+			continue
+		}
+		if payload.SHA256 == "" && e.URL != payload.BinaryURL {
+			continue
+		}
+		complete := true
+		for _, b := range binaries {
+			if _, ok := e.Binaries[b]; !ok || !utils.FileExists(filepath.Join(e.Dir(settings), b)) {
+				complete = false
+			}
+		}
+		if complete {
+			return e, nil
+		}
+	}
+	return
+}
+
+// cachePayload downloads a payload release, verifies it and adds its
+// binaries to the cache
+func cachePayload(ctx context.Context, settings *config.Schema, payload model.PayloadLocation, binaries []string) (entry *CachedPayload, err error) {
+	td, err := settings.Tmp()
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(td)
+	download := filepath.Join(td, "download")
+	log.Infof("downloading payload binaries from %s to %s", payload.BinaryURL, download)
+	if err = got.NewWithContext(ctx).Download(payload.BinaryURL, download); err != nil {
+		return
+	}
+	// nothing gets in the cache before the verification
+	sum, err := verifyDownload(download, payload.BinaryURL, payload.SHA256)
+	if err != nil {
+		return
+	}
+	entry = &CachedPayload{
+		Key:       payloadCacheKey(sum),
+		URL:       payload.BinaryURL,
+		Version:   payload.Version,
+		SHA256:    sum,
+		Binaries:  make(map[string]string),
+		CreatedOn: time.Now(),
+	}
+	staging := filepath.Join(td, entry.Key)
+	files, err := archive.Extract(download, filepath.Join(td, "extracted"), binaries[0])
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(staging, 0755); err != nil {
+		return
+	}
+	for _, b := range binaries {
+		extracted, err := archive.Find(filepath.Join(td, "extracted"), files, b)
+		if err != nil {
+			return nil, err
+		}
+		if err = os.Rename(extracted, filepath.Join(staging, b)); err != nil {
+			return nil, err
+		}
+		if entry.Binaries[b], err = utils.SHA256File(filepath.Join(staging, b)); err != nil {
+			return nil, err
+		}
+	}
+	if err = utils.StoreJSON(filepath.Join(staging, PayloadCacheManifest), entry); err != nil {
+		return
+	}
+	if err = os.MkdirAll(settings.PayloadCache(""), 0700); err != nil {
+		return
+	}
+	if err = os.Rename(staging, entry.Dir(settings)); err == nil || !utils.FileExists(entry.Dir(settings)) {
+		return
+	}
+	// the same file has been cached in the meantime, maybe with other
+	// binaries, the ones it has may be in use and are kept
+	return mergeCachedPayload(settings, entry, staging)
+}
+
+// mergeCachedPayload adds the binaries of a staging entry that an existing
+// entry of the cache is missing, the manifest is replaced in one rename
+func mergeCachedPayload(settings *config.Schema, entry *CachedPayload, staging string) (merged *CachedPayload, err error) {
+	manifest := filepath.Join(entry.Dir(settings), PayloadCacheManifest)
+	merged = new(CachedPayload)
+	if err = utils.LoadJSON(manifest, merged); err != nil {
+		return nil, fmt.Errorf("invalid payload cache entry %s: %w", entry.Key, err)
+	}
+	if merged.Binaries == nil {
+		merged.Binaries = make(map[string]string)
+	}
+	for b, sum := range entry.Binaries {
+		if _, ok := merged.Binaries[b]; ok && utils.FileExists(filepath.Join(merged.Dir(settings), b)) {
+			continue
+		}
+		if err = os.Rename(filepath.Join(staging, b), filepath.Join(merged.Dir(settings), b)); err != nil {
+			return nil, err
+		}
+		merged.Binaries[b] = sum
+	}
+	staged := filepath.Join(staging, PayloadCacheManifest)
+	if err = utils.StoreJSON(staged, merged); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(staged, manifest); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// resolvePayload sets the paths of the payload binaries of an event to a
+// cache entry, downloading the payload if it is not in the cache yet
+func resolvePayload(ctx context.Context, settings *config.Schema, evt *model.Event) (err error) {
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return
+	}
+	binaries := payloadBinaries(evt.Payload, profile)
+	entry, err := findCachedPayload(settings, evt.Payload, binaries)
+	if err != nil {
+		return
+	}
+	switch {
+	case entry != nil:
+		log.Infof("using the payload binaries of %s from the cache entry %s", entry.URL, entry.Key)
+		if plannerFrom(ctx) == nil {
+			// prune keeps the entry until the event is stored with its binaries
+			now := time.Now()
+			if err = os.Chtimes(filepath.Join(entry.Dir(settings), PayloadCacheManifest), now, now); err != nil {
+				return
+			}
+		}
+	case plannerFrom(ctx) != nil:
+		plannerFrom(ctx).download(evt.Payload.BinaryURL, settings.PayloadCache(""))
+		entry = &CachedPayload{Key: "<sha256 of the download>"}
+	default:
+		if entry, err = cachePayload(ctx, settings, evt.Payload, binaries); err != nil {
+			return
+		}
+	}
+	evt.Payload.BinaryPath = entry.Dir(settings)
+	evt.Payload.DaemonPath = filepath.Join(evt.Payload.BinaryPath, binaries[0])
+	evt.Payload.CLIPath = evt.Payload.DaemonPath
+	if len(binaries) > 1 {
+		evt.Payload.CLIPath = filepath.Join(evt.Payload.BinaryPath, binaries[1])
+	}
+	return
+}
+
+// ListPayloadCache returns the entries of the payload cache, newest first,
+// with their size and the events using them
+func ListPayloadCache(settings *config.Schema) (entries []*CachedPayload, err error) {
+	if entries, err = loadPayloadCache(settings); err != nil {
+		return
+	}
+	events, err := ListEvents(settings)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		for _, evt := range events {
+			if filepath.Clean(evt.Payload.BinaryPath) == e.Dir(settings) {
+				e.Events = append(e.Events, evt.ID())
+			}
+		}
+		sort.Strings(e.Events)
+		filepath.Walk(e.Dir(settings), func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				e.Size += info.Size()
+			}
+			return nil
+		})
+	}
+	return
+}
+
+// PrunePayloadCache removes the cache entries that are not used by any
+// event, nor by an event setup in the last PayloadCacheGracePeriod, it
+// returns the removed entries
+func PrunePayloadCache(settings *config.Schema) (removed []*CachedPayload, err error) {
+	entries, err := ListPayloadCache(settings)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if len(e.Events) > 0 {
+			log.Debugf("payload cache entry %s is used by %s", e.Key, strings.Join(e.Events, ", "))
+			continue
+		}
+		if time.Since(e.UsedOn) < PayloadCacheGracePeriod {
+			log.Debugf("payload cache entry %s has been used on %s, it may be used by an event setup", e.Key, e.UsedOn.Format(time.RFC3339))
+			continue
+		}
+		if err = os.RemoveAll(e.Dir(settings)); err != nil {
+			return
+		}
+		removed = append(removed, e)
+	}
+	return
+}
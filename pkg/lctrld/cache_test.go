@@ -0,0 +1,150 @@
+package lctrld
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadCache(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		var b bytes.Buffer
+		zw := zip.NewWriter(&b)
+		for _, name := range []string{"launchpayloadd", "launchpayloadcli"} {
+			h := &zip.FileHeader{Name: "release/" + name, Method: zip.Deflate}
+			h.SetMode(0755)
+			f, err := zw.CreateHeader(h)
+			require.Nil(t, err)
+			f.Write([]byte(name + " " + r.URL.Path))
+		}
+		require.Nil(t, zw.Close())
+		http.ServeContent(w, r, "release.zip", time.Time{}, bytes.NewReader(b.Bytes()))
+	}))
+	defer server.Close()
+
+	settings := &config.Schema{Workspace: t.TempDir()}
+	require.Nil(t, SetupWorkspace(settings))
+	newEvent := func(owner, version string) *model.Event {
+		payload := model.NewDefaultPayloadLocation()
+		payload.Version = version
+		payload.BinaryURL = server.URL + "/" + version + "/launchpayload.zip"
+		evt := model.NewEvent("drop", owner, "virtualbox", []model.GenesisAccount{
+			{Name: "alice", GenesisBalance: model.MustParseCoins("100stake"), Validator: true},
+		}, payload)
+		require.Nil(t, CreateEvent(settings, evt))
+		return evt
+	}
+	ctx := context.Background()
+
+	// the events on different releases get their own binaries
+	v1, v2 := newEvent("one@apeunit.com", "v1"), newEvent("two@apeunit.com", "v2")
+	for _, evt := range []*model.Event{v1, v2} {
+		require.Nil(t, DownloadPayloadBinary(ctx, settings, evt, nil))
+		require.Nil(t, StoreEvent(settings, evt))
+	}
+	assert.NotEqual(t, v1.Payload.DaemonPath, v2.Payload.DaemonPath)
+	assert.Equal(t, filepath.Dir(v1.Payload.DaemonPath), filepath.Dir(v1.Payload.CLIPath))
+	assert.FileExists(t, v1.Payload.CLIPath)
+
+	// the same release is downloaded once
+	requests := downloads
+	again := newEvent("three@apeunit.com", "v1")
+	require.Nil(t, DownloadPayloadBinary(ctx, settings, again, nil))
+	assert.Equal(t, v1.Payload.DaemonPath, again.Payload.DaemonPath)
+	assert.Equal(t, requests, downloads)
+
+	entries, err := ListPayloadCache(settings)
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	for _, e := range entries {
+		assert.Len(t, e.Events, 1)
+		assert.NotZero(t, e.Size)
+	}
+	checks, err := VerifyBinaries(settings)
+	require.Nil(t, err)
+	assert.Len(t, checks, 4)
+
+	// the releases in use are pinned
+	removed, err := PrunePayloadCache(settings)
+	require.Nil(t, err)
+	assert.Len(t, removed, 0)
+	evtDir, err := settings.Evts(v2.ID())
+	require.Nil(t, err)
+	require.Nil(t, os.RemoveAll(evtDir))
+	// an entry just used may belong to a setup that has not stored its event
+	removed, err = PrunePayloadCache(settings)
+	require.Nil(t, err)
+	assert.Len(t, removed, 0)
+	used := time.Now().Add(-PayloadCacheGracePeriod)
+	require.Nil(t, os.Chtimes(filepath.Join(filepath.Dir(v2.Payload.DaemonPath), PayloadCacheManifest), used, used))
+	removed, err = PrunePayloadCache(settings)
+	require.Nil(t, err)
+	require.Len(t, removed, 1)
+	assert.Equal(t, "v2", removed[0].Version)
+	assert.False(t, utils.FileExists(filepath.Dir(v2.Payload.DaemonPath)))
+	assert.FileExists(t, v1.Payload.DaemonPath)
+}
+
+func TestCachePayloadMerge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b bytes.Buffer
+		zw := zip.NewWriter(&b)
+		for _, name := range []string{"gaiad", "gaiacli"} {
+			h := &zip.FileHeader{Name: name, Method: zip.Deflate}
+			h.SetMode(0755)
+			f, err := zw.CreateHeader(h)
+			require.Nil(t, err)
+			f.Write([]byte(name))
+		}
+		require.Nil(t, zw.Close())
+		http.ServeContent(w, r, "release.zip", time.Time{}, bytes.NewReader(b.Bytes()))
+	}))
+	defer server.Close()
+	settings := &config.Schema{Workspace: t.TempDir()}
+	require.Nil(t, SetupWorkspace(settings))
+	payload := model.PayloadLocation{BinaryURL: server.URL + "/gaia.zip"}
+	ctx := context.Background()
+
+	// a legacy event pinned to both binaries
+	legacy, err := cachePayload(ctx, settings, payload, []string{"gaiad", "gaiacli"})
+	require.Nil(t, err)
+	cli := filepath.Join(legacy.Dir(settings), "gaiacli")
+	info, err := os.Stat(cli)
+	require.Nil(t, err)
+
+	// caching the daemon alone keeps the cli
+	single, err := cachePayload(ctx, settings, payload, []string{"gaiad"})
+	require.Nil(t, err)
+	assert.Equal(t, legacy.Key, single.Key)
+	assert.Len(t, single.Binaries, 2)
+	again, err := os.Stat(cli)
+	require.Nil(t, err)
+	assert.True(t, os.SameFile(info, again))
+
+	// the missing binaries are added to an entry
+	require.Nil(t, os.RemoveAll(legacy.Dir(settings)))
+	_, err = cachePayload(ctx, settings, payload, []string{"gaiad"})
+	require.Nil(t, err)
+	merged, err := cachePayload(ctx, settings, payload, []string{"gaiad", "gaiacli"})
+	require.Nil(t, err)
+	assert.Len(t, merged.Binaries, 2)
+	assert.FileExists(t, cli)
+	found, err := findCachedPayload(settings, payload, []string{"gaiad", "gaiacli"})
+	require.Nil(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, merged.Key, found.Key)
+}
@@ -0,0 +1,163 @@
+package lctrld
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// ChecksumsFile is the manifest of the binaries installed in the bin folder
+const ChecksumsFile = "checksums.json"
+
+// InstalledBinary records where an installed binary comes from
+type InstalledBinary struct {
+	URL string `json:"url"`
+	// ArtifactSHA256 is the checksum of the downloaded file, it differs from
+	// SHA256 when the binary was extracted from an archive
+	ArtifactSHA256 string `json:"artifact_sha256"`
+	// SHA256 is the checksum of the installed binary
+	SHA256 string `json:"sha256"`
+}
+
+// BinaryCheck is the result of the verification of an installed binary
+type BinaryCheck struct {
+	File     string `json:"file"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Error    string `json:"error,omitempty"`
+}
+
+// checksumsLock serializes the updates of the manifest
+var checksumsLock sync.Mutex
+
+// verifyDownload checks a downloaded file against its expected sha256, an
+// empty checksum skips the verification. It returns the sha256 of the file.
+func verifyDownload(filePath, url, expected string) (sum string, err error) {
+	if expected == "" {
+		log.Warnf("there is no sha256 for %s, the download is not verified", url)
+		return utils.SHA256File(filePath)
+	}
+	if sum, err = utils.VerifySHA256(filePath, expected); err != nil {
+		log.Errorf("the download of %s is corrupted or has been tampered with: %v", url, err)
+		return
+	}
+	log.Debugf("%s matches sha256 %s", url, sum)
+	return
+}
+
+// loadChecksums reads the manifest of the installed binaries
+func loadChecksums(settings *config.Schema) (installed map[string]InstalledBinary, err error) {
+	installed = make(map[string]InstalledBinary)
+	manifest := settings.Bin(ChecksumsFile)
+	if !utils.FileExists(manifest) {
+		return
+	}
+	err = utils.LoadJSON(manifest, &installed)
+	return
+}
+
+// recordInstall adds installed binaries to the manifest, files are the
+// names of the binaries in the bin folder
+func recordInstall(settings *config.Schema, url, artifactSum string, files ...string) (err error) {
+	checksumsLock.Lock()
+	defer checksumsLock.Unlock()
+	installed, err := loadChecksums(settings)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		sum, err := utils.SHA256File(settings.Bin(file))
+		if err != nil {
+			return err
+		}
+		installed[file] = InstalledBinary{URL: url, ArtifactSHA256: artifactSum, SHA256: sum}
+	}
+	return utils.StoreJSON(settings.Bin(ChecksumsFile), installed)
+}
+
+// VerifyBinaries checks the installed binaries: docker-machine and the
+// drivers against the sha256 in the configuration, every binary in the
+// manifest and in the payload cache against the checksum recorded when it
+// was installed. A binary extracted from an archive matches when the
+// configured sha256 is the one of the archive it was installed from.
+func VerifyBinaries(settings *config.Schema) (checks []BinaryCheck, err error) {
+	installed, err := loadChecksums(settings)
+	if err != nil {
+		return
+	}
+	expected := make(map[string]string)
+	if settings.DockerMachine.SHA256 != "" {
+		expected[settings.DockerMachine.Binary] = settings.DockerMachine.SHA256
+	}
+	for _, driver := range settings.DockerMachine.Drivers {
+		if driver.BinaryURL != "" && driver.SHA256 != "" {
+			expected[driver.Binary] = driver.SHA256
+		}
+	}
+	files := make([]string, 0, len(expected)+len(installed))
+	for file := range expected {
+		files = append(files, file)
+	}
+	for file := range installed {
+		if _, found := expected[file]; !found {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	var failed []string
+	for _, file := range files {
+		check := BinaryCheck{File: file, Expected: expected[file]}
+		record, recorded := installed[file]
+		if check.Expected == "" {
+			check.Expected = record.SHA256
+		}
+		sum, err := utils.SHA256File(settings.Bin(file))
+		switch {
+		case err != nil:
+			check.Error = err.Error()
+		case strings.EqualFold(sum, check.Expected):
+		case recorded && strings.EqualFold(record.ArtifactSHA256, check.Expected) && sum == record.SHA256:
+			// extracted from the expected archive
+		default:
+			check.Error = fmt.Sprintf("%v: expected %s", utils.ErrorChecksumMismatch, check.Expected)
+		}
+		check.Actual = sum
+		if check.Error != "" {
+			failed = append(failed, file)
+		}
+		checks = append(checks, check)
+	}
+
+	cached, err := loadPayloadCache(settings)
+	if err != nil {
+		return
+	}
+	for _, e := range cached {
+		names := make([]string, 0, len(e.Binaries))
+		for name := range e.Binaries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			check := BinaryCheck{File: filepath.Join(config.CacheDir, "payloads", e.Key, name), Expected: e.Binaries[name]}
+			sum, err := utils.VerifySHA256(filepath.Join(e.Dir(settings), name), check.Expected)
+			if err != nil {
+				check.Error = err.Error()
+				failed = append(failed, check.File)
+			}
+			check.Actual = sum
+			checks = append(checks, check)
+		}
+	}
+	if len(failed) > 0 {
+		err = fmt.Errorf("%w: %s failed the verification", utils.ErrorChecksumMismatch, strings.Join(failed, ", "))
+	}
+	return
+}
@@ -0,0 +1,54 @@
+package lctrld
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallVerified(t *testing.T) {
+	binary := append([]byte("\x7fELF"), make([]byte, 600)...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer server.Close()
+	sum := sha256.Sum256(binary)
+
+	settings := &config.Schema{
+		Workspace: t.TempDir(),
+		DockerMachine: config.DockerMachine{
+			Binary:    "docker-machine",
+			BinaryURL: server.URL + "/docker-machine",
+			SHA256:    "0000000000000000000000000000000000000000000000000000000000000000",
+		},
+	}
+	require.Nil(t, SetupWorkspace(settings))
+
+	// a mismatch installs nothing
+	err := InstallDockerMachine(settings)
+	assert.True(t, errors.Is(err, utils.ErrorChecksumMismatch))
+	assert.False(t, utils.FileExists(settings.DmBin()))
+
+	settings.DockerMachine.SHA256 = hex.EncodeToString(sum[:])
+	require.Nil(t, InstallDockerMachine(settings))
+	assert.True(t, utils.FileExists(settings.DmBin()))
+	checks, err := VerifyBinaries(settings)
+	require.Nil(t, err)
+	assert.Equal(t, []BinaryCheck{{File: "docker-machine", Expected: settings.DockerMachine.SHA256, Actual: settings.DockerMachine.SHA256}}, checks)
+
+	// the installed binary has been changed
+	require.Nil(t, ioutil.WriteFile(settings.DmBin(), []byte("tampered"), 0700))
+	checks, err = VerifyBinaries(settings)
+	assert.True(t, errors.Is(err, utils.ErrorChecksumMismatch))
+	require.Len(t, checks, 1)
+	assert.Contains(t, checks[0].Error, "checksum mismatch")
+}
@@ -1,9 +1,12 @@
 package lctrld
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
 	"github.com/apeunit/LaunchControlD/pkg/config"
@@ -13,18 +16,18 @@ import (
 )
 
 // InspectEvent inspect status of the infrastructure for an event
-func InspectEvent(settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
+func InspectEvent(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
 	path, err := settings.Evts(evt.ID())
 	log.Debugln("InspectEvent event", evt.ID(), "home:", path)
 	if err != nil {
 		log.Error("Inspect failed:", err)
 		return
 	}
-	dm := NewDockerMachine(settings, evt.ID())
-	_, validatorAccounts := evt.Validators()
-	for i := range validatorAccounts {
+	ctx, cmdRunner = cmdrunner.WithStep(ctx, "inspect"), journalRunner(settings, evt, cmdRunner)
+	prov := NewProvisioner(settings, evt)
+	for i := range evt.NodeNames() {
 		machineName := evt.NodeID(i)
-		out, err := dm.Status(machineName, cmdRunner)
+		out, err := prov.Status(ctx, machineName, cmdRunner)
 		if err != nil {
 			break
 		}
@@ -34,7 +37,7 @@ func InspectEvent(settings *config.Schema, evt *model.Event, cmdRunner cmdrunner
 }
 
 // DestroyEvent destroy an existing event
-func DestroyEvent(settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
+func DestroyEvent(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
 	path, err := settings.Evts(evt.ID())
 	log.Debugln("op DestroyEvent event", evt.ID(), "home:", path)
 	if err != nil {
@@ -56,57 +59,117 @@ func DestroyEvent(settings *config.Schema, evt *model.Event, cmdRunner cmdrunner
 		return
 	}
 
-	dm := NewDockerMachine(settings, evt.ID())
-	_, validatorAccounts := evt.Validators()
-	for i, v := range validatorAccounts {
+	if err = evt.CanTransition(model.StatusTornDown); err != nil {
+		log.Error("op DestroyEvent failed:", err)
+		return
+	}
+
+	ctx, cmdRunner = cmdrunner.WithStep(ctx, "destroy"), journalRunner(settings, evt, cmdRunner)
+	prov := NewProvisioner(settings, evt)
+	for i, name := range evt.NodeNames() {
 		machineName := evt.NodeID(i)
-		log.Infof("%s's node ID is %s", v.Name, machineName)
-		err = dm.StopMachine(machineName, cmdRunner)
+		log.Infof("%s's node ID is %s", name, machineName)
+		err = prov.StopMachine(ctx, machineName, cmdRunner)
 		if err != nil {
 			log.Warnf("error stopping machine %s: %v", machineName, err)
 		}
 	}
 	err = os.RemoveAll(path)
+	if err != nil {
+		return failEvent(settings, evt, err)
+	}
+	// the event home is gone, the status is only kept in memory for the caller
+	err = evt.Transition(model.StatusTornDown, "")
 	return
 }
 
 // ProvisionEvent provision the infrastructure for the event
-func ProvisionEvent(settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
-	dm := NewDockerMachine(settings, evt.ID())
-	if err != nil {
+func ProvisionEvent(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
+	if err = evt.CanTransition(model.StatusProvisioned); err != nil {
 		return
 	}
+	ctx, cmdRunner = cmdrunner.WithStep(ctx, "provision"), journalRunner(settings, evt, cmdRunner)
+	prov := NewProvisioner(settings, evt)
 	// init docker nodes map
 	// TODO: shouldn't this be initialized already during evt struct creation?
 	evt.State = make(map[string]*model.Machine)
-	_, validatorAccounts := evt.Validators()
 	// track the creation of all the elements,
 	// if just one machine fails, rollback the whole provisioning
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		started  []string // machines whose creation has been started
+		firstErr error    // the first provisioning failure
+	)
 	rollback := func() {
 		log.Infof("rolling back provisioning for event %s", evt.TokenSymbol)
-		for _, v := range evt.State {
-			err = dm.StopMachine(v.Instance.MachineName, cmdRunner)
-			if err != nil {
-				log.Warn("failed to rollback machine provisioning for %s", v.Instance.MachineName)
-				continue
+		// the cleanup must run even if the provisioning was cancelled
+		rollbackCtx := cmdrunner.WithStep(context.Background(), "rollback")
+		// a failed creation may leave a half created machine behind,
+		// so every machine that was started gets removed
+		for _, machineName := range started {
+			if rErr := prov.StopMachine(rollbackCtx, machineName, cmdRunner); rErr != nil {
+				log.Warnf("failed to rollback machine provisioning for %s: %v", machineName, rErr)
 			}
 		}
+		evt.State = make(map[string]*model.Machine)
 	}
-	// run the provisioning
-	for i, v := range validatorAccounts {
+	// run the provisioning, at most settings.Provisioning.Workers at the time
+	workers := settings.Provisioning.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	// the first failure stops the creations still in progress
+	provisionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for i, name := range evt.NodeNames() {
 		machineName := evt.NodeID(i)
-
-		log.Infof("%s's node ID is %s", v.Name, machineName)
-
-		mc, pErr := dm.ProvisionMachine(machineName, evt.Provider, cmdRunner)
-		if pErr != nil {
-			rollback()
-			log.Error(err)
-			return fmt.Errorf("failed to provision nodes for the event")
+		sem <- struct{}{}
+		mu.Lock()
+		if firstErr == nil && ctx.Err() != nil {
+			firstErr = ctx.Err()
 		}
-		evt.State[v.Name] = mc
+		if firstErr != nil {
+			// a machine failed already, don't start new ones
+			mu.Unlock()
+			<-sem
+			break
+		}
+		started = append(started, machineName)
+		mu.Unlock()
+
+		log.Infof("%s's node ID is %s (%s)", name, machineName, evt.NodeRole(name))
+		wg.Add(1)
+		go func(name, machineName string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			mc, pErr := prov.ProvisionMachine(provisionCtx, machineName, evt.Provider, cmdRunner)
+			mu.Lock()
+			defer mu.Unlock()
+			if pErr != nil {
+				log.Errorf("provisioning of %s failed: %v", machineName, pErr)
+				if firstErr == nil {
+					firstErr = pErr
+					cancel()
+				}
+				return
+			}
+			evt.State[name] = mc
+		}(name, machineName)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		rollback()
+		return failEvent(settings, evt, fmt.Errorf("failed to provision nodes for the event: %w", firstErr))
 	}
 
+	if err = evt.Transition(model.StatusProvisioned, ""); err != nil {
+		return
+	}
+	if err = StoreEvent(settings, evt); err != nil {
+		return
+	}
 	log.Infof("Your event ID is %s", evt.ID())
 	return
 }
@@ -114,115 +177,264 @@ func ProvisionEvent(settings *config.Schema, evt *model.Event, cmdRunner cmdrunn
 // RereadDockerMachineInfo is useful when docker-machine failed during 'create',
 // and a human fixed the problem, and wants to continue
 func RereadDockerMachineInfo(settings *config.Schema, evt *model.Event) (event *model.Event, err error) {
+	if err = evt.CanTransition(model.StatusProvisioned); err != nil {
+		return
+	}
+	if evt.Provider == LocalDockerProvider {
+		err = fmt.Errorf("event %s is not provisioned with docker-machine", evt.ID())
+		return
+	}
 	dm := NewDockerMachine(settings, evt.ID())
-	_, validatorAccounts := evt.Validators()
-	for i, v := range validatorAccounts {
+	for i, name := range evt.NodeNames() {
 		machineName := fmt.Sprintf("%s-%d", evt.ID(), i)
 		mc, err := dm.ReadConfig(machineName)
 		if err != nil {
 			log.Error("Provision read machine config error:", err)
 			return nil, err
 		}
-		evt.State[v.Name] = mc
+		evt.State[name] = mc
+	}
+	if err = evt.Transition(model.StatusProvisioned, "machine configuration reread from docker-machine"); err != nil {
+		return nil, err
 	}
 	return evt, err
 }
 
 // DeployPayload tells the provisioned machines to run the configured docker image
-func DeployPayload(settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
+func DeployPayload(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
+	if err = evt.CanTransition(model.StatusDeployed); err != nil {
+		return
+	}
+	// never ship a genesis that does not match the event
+	if err = verifyGenesisStep(ctx, settings, evt, cmdRunner); err != nil {
+		return failEvent(settings, evt, err)
+	}
+	ctx, cmdRunner = cmdrunner.WithStep(ctx, "deploy"), journalRunner(settings, evt, cmdRunner)
+	if err = deployPayload(ctx, settings, evt, cmdRunner); err != nil {
+		return failEvent(settings, evt, err)
+	}
+	if err = evt.Transition(model.StatusDeployed, ""); err != nil {
+		return
+	}
+	return StoreEvent(settings, evt)
+}
+
+// UndeployPayload stops and removes the containers of the event and the node
+// configuration copied on the machines, the machines stay provisioned and the
+// event can be deployed again
+func UndeployPayload(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
+	if err = evt.CanTransition(model.StatusConfigured); err != nil {
+		return
+	}
+	if status := evt.EffectiveStatus(); status != model.StatusConfigured && status != model.StatusDeployed {
+		return fmt.Errorf("%w: event %s is %s and has nothing deployed", model.ErrInvalidTransition, evt.ID(), status)
+	}
+	ctx, cmdRunner = cmdrunner.WithStep(ctx, "undeploy"), journalRunner(settings, evt, cmdRunner)
+	prov := NewProvisioner(settings, evt)
+	for _, name := range evt.NodeNames() {
+		state := evt.State[name]
+		if err = removeContainers(ctx, prov, evt, state.ID(), cmdRunner); err != nil {
+			return failEvent(settings, evt, err)
+		}
+		// docker-machine ssh rm -rf /home/docker/nodeconfig
+		if _, err = prov.Run(ctx, state.ID(), []string{"rm", "-rf", "/home/docker/nodeconfig"}, cmdRunner); err != nil {
+			return failEvent(settings, evt, err)
+		}
+	}
+	if err = evt.Transition(model.StatusConfigured, "payload undeployed"); err != nil {
+		return
+	}
+	return StoreEvent(settings, evt)
+}
+
+// ContainerLabel labels the containers of the payload with their event
+const ContainerLabel = "lctrld.event"
+
+// containerName returns the name of the container of a service on a machine
+func containerName(machineName, service string) string {
+	return fmt.Sprintf("%s-%s", machineName, service)
+}
+
+// removeContainers removes the containers of the event on a machine, running
+// or not
+func removeContainers(ctx context.Context, prov Provisioner, evt *model.Event, machineName string, cmdRunner cmdrunner.CommandRunner) (err error) {
+	command := []string{"ps", "-a", "--filter", fmt.Sprintf("label=%s=%s", ContainerLabel, evt.ID()), "--format", "{{.Names}}"}
+	out, err := prov.RunDocker(ctx, machineName, command, cmdRunner)
+	if err != nil {
+		return
+	}
+	names := strings.Fields(out)
+	if len(names) == 0 {
+		return
+	}
+	log.Infof("Removing the containers %s from %s", strings.Join(names, ", "), machineName)
+	_, err = prov.RunDocker(ctx, machineName, append([]string{"rm", "-f"}, names...), cmdRunner)
+	return
+}
+
+func deployPayload(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
 	var command []string
-	log.Infoln("Copying node configs to each provisioned machine")
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return
+	}
+	services, err := payloadServices(settings, evt)
+	if err != nil {
+		return
+	}
+	args := profileArgs(evt)
+	servicesNode := evt.ServicesNode()
+	faucet := false
+	for _, s := range services {
+		faucet = faucet || (s.Name == config.ServiceFaucet && s.RunsOn(string(evt.NodeRole(servicesNode)), true))
+	}
+	evtDir, err := settings.Evts(evt.ID())
+	if err != nil {
+		return
+	}
+	prov := NewProvisioner(settings, evt)
+	// a new deployment replaces the containers of the previous one
+	for _, name := range evt.NodeNames() {
+		if err = removeContainers(ctx, prov, evt, evt.State[name].ID(), cmdRunner); err != nil {
+			return
+		}
+	}
 
-	dm := NewDockerMachine(settings, evt.ID())
-	for name, state := range evt.State {
+	log.Infoln("Copying node configs to each provisioned machine")
+	for _, name := range evt.NodeNames() {
+		state := evt.State[name]
 		// docker-machine ssh mkdir -p /home/docker/nodeconfig
 		command = []string{"mkdir", "-p", "/home/docker/nodeconfig"}
-		_, err = dm.Run(state.ID(), command, cmdRunner)
+		_, err = prov.Run(ctx, state.ID(), command, cmdRunner)
 		if err != nil {
 			return
 		}
 
 		// docker-machine scp -r pathDaemon evtx-d97517a3673688070aef-0:/home/docker/nodeconfig
-		err = dm.Copy(state.ID(), evt.Accounts[name].ConfigLocation.DaemonConfigDir, "/home/docker/nodeconfig", cmdRunner)
+		location := evt.NodeConfigLocation(name)
+		err = prov.Copy(ctx, state.ID(), location.DaemonConfigDir, "/home/docker/nodeconfig", cmdRunner)
 		if err != nil {
 			return
 		}
 
 		// docker-machine scp -r pathCLI evtx-d97517a3673688070aef-0:/home/docker/nodeconfig
-		err = dm.Copy(state.ID(), evt.Accounts[name].ConfigLocation.CLIConfigDir, "/home/docker/nodeconfig", cmdRunner)
-		if err != nil {
-			return
+		if location.CLIConfigDir != location.DaemonConfigDir {
+			err = prov.Copy(ctx, state.ID(), location.CLIConfigDir, "/home/docker/nodeconfig", cmdRunner)
+			if err != nil {
+				return
+			}
+		}
+
+		// the faucet account and configuration
+		if faucet && name == servicesNode {
+			log.Infof("Copying the faucet account and configuration to the %s machine", name)
+			err = prov.Copy(ctx, state.ID(), evt.FaucetAccount().ConfigLocation.CLIConfigDir, "/home/docker/nodeconfig/faucet_account", cmdRunner)
+			if err != nil {
+				return
+			}
+			err = prov.Copy(ctx, state.ID(), filepath.Join(evtDir, "nodeconfig", "faucetconfig.yml"), "/home/docker/nodeconfig", cmdRunner)
+			if err != nil {
+				return
+			}
 		}
 
 		// docker-machine chmod -R 777 /home/docker/nodeconfig
 		command = []string{"chmod", "-R", "777", "/home/docker/nodeconfig"}
-		_, err = dm.Run(state.ID(), command, cmdRunner)
+		_, err = prov.Run(ctx, state.ID(), command, cmdRunner)
 		if err != nil {
 			return
 		}
 	}
 
-	log.Infof("Running docker pull %s on each provisioned machine", evt.Payload.DockerImage)
-	for email, state := range evt.State {
-		// in docker-machine provisioned machine: docker pull apeunit/launchpayload
-		command := []string{"pull", evt.Payload.DockerImage}
-		log.Debugf("Running docker %s for validator %s machine\n", command, email)
-		_, err = dm.RunDocker(state.ID(), command, cmdRunner)
-		if err != nil {
-			return
+	log.Infoln("Pulling the images of the services on each provisioned machine")
+	for _, name := range evt.NodeNames() {
+		pulled := make(map[string]bool)
+		for _, s := range services {
+			image := serviceImage(s, evt)
+			if pulled[image] || !s.RunsOn(string(evt.NodeRole(name)), name == servicesNode) {
+				continue
+			}
+			pulled[image] = true
+			// in docker-machine provisioned machine: docker pull apeunit/launchpayload
+			command = []string{"pull", image}
+			log.Debugf("Running docker %s for %s %s machine\n", command, evt.NodeRole(name), name)
+			if _, err = prov.RunDocker(ctx, evt.State[name].ID(), command, cmdRunner); err != nil {
+				return
+			}
 		}
 	}
 
-	log.Infoln("Running the dockerized Cosmos daemons on the provisioned machines")
-	for email, state := range evt.State {
-		// in docker-machine provisioned machine: docker run -v /home/docker/nodeconfig:/payload/config apeunit/launchpayload
-		command := []string{"run", "-d", "-v", "/home/docker/nodeconfig:/payload/config", "-p", "26656:26656", "-p", "26657:26657", "-p", "26658:26658", evt.Payload.DockerImage}
-		log.Debugf("Running docker %s for validator %s machine\n", command, email)
-		_, err = dm.RunDocker(state.ID(), command, cmdRunner)
-		if err != nil {
-			return
+	// https://forum.cosmos.network/t/what-could-cause-sync-mutex-lock-to-have-a-nil-pointer-dereference/4194
+	for _, s := range services {
+		log.Infof("Running the %s service on the provisioned machines", s.Name)
+		for _, name := range evt.NodeNames() {
+			if !s.RunsOn(string(evt.NodeRole(name)), name == servicesNode) {
+				continue
+			}
+			state := evt.State[name]
+			nodeArgs := args
+			nodeArgs.IP = state.Instance.IPAddress
+			// in docker-machine provisioned machine: docker run -v /home/docker/nodeconfig:/payload/config apeunit/launchpayload
+			if command, err = serviceRunCommand(s, evt, containerName(state.ID(), s.Name), profile, nodeArgs); err != nil {
+				return
+			}
+			log.Debugf("Running docker %s for %s %s machine\n", command, evt.NodeRole(name), name)
+			if _, err = prov.RunDocker(ctx, state.ID(), command, cmdRunner); err != nil {
+				return
+			}
 		}
 	}
+	return
+}
 
-	// https://forum.cosmos.network/t/what-could-cause-sync-mutex-lock-to-have-a-nil-pointer-dereference/4194
-	log.Infoln("Running the CLI to provide the Light Client Daemon")
-	v, _ := evt.Validators()
-	firstValidator := evt.State[v[0]]
-	command = []string{"run", "-d", "--volume=/home/docker/nodeconfig:/payload/config", "-p", "1317:1317", evt.Payload.DockerImage, "/payload/runlightclient.sh", firstValidator.Instance.IPAddress, evt.ID()}
-	// command = []string{"scp", evt.Payload.CLIPath, fmt.Sprintf("%s:/home/docker", evt.State[firstValidator].ID())}
-	log.Debugf("Running docker-machine %s on validator %s machine\n", command, firstValidator)
-	_, err = dm.RunDocker(firstValidator.ID(), command, cmdRunner)
-	if err != nil {
-		return
+// payloadServices returns the services deployed for an event, the events
+// created before the services were recorded get the default services
+func payloadServices(settings *config.Schema, evt *model.Event) (services []config.ServiceSpec, err error) {
+	if len(evt.Payload.Services) > 0 {
+		return evt.Payload.Services, nil
 	}
+	return settings.PayloadServices(config.CatalogPayload{Name: evt.Payload.Name, Profile: evt.Payload.Profile}, nil)
+}
 
-	log.Infoln("Copying the faucet account and configuration to the first validator machine")
-	faucetAccount := evt.FaucetAccount()
-	err = dm.Copy(firstValidator.ID(), faucetAccount.ConfigLocation.CLIConfigDir, "/home/docker/nodeconfig/faucet_account", cmdRunner)
-	if err != nil {
-		return
-	}
-	// docker-machine chmod -R 777 /home/docker/nodeconfig AGAIN - what a mess!
-	command = []string{"chmod", "-R", "777", "/home/docker/nodeconfig"}
-	_, err = dm.Run(firstValidator.ID(), command, cmdRunner)
-	if err != nil {
-		return
+// serviceImage returns the docker image of a service
+func serviceImage(s config.ServiceSpec, evt *model.Event) string {
+	if s.Image == "" {
+		return evt.Payload.DockerImage
 	}
+	return s.Image
+}
 
-	evtDir, err := settings.Evts(evt.ID())
+// serviceRunCommand returns the docker run command of a service on a node,
+// the container is named and labeled with the event
+func serviceRunCommand(s config.ServiceSpec, evt *model.Event, name string, profile config.PayloadProfile, args config.ProfileArgs) (command []string, err error) {
+	env, err := profile.Render(s.Env, args)
 	if err != nil {
-		log.Error(err)
 		return
 	}
-
-	err = dm.Copy(firstValidator.ID(), filepath.Join(evtDir, "nodeconfig", "faucetconfig.yml"), "/home/docker/nodeconfig", cmdRunner)
+	entrypoint, err := profile.Render(s.Command, args)
 	if err != nil {
 		return
 	}
-
-	log.Infoln("Starting the faucet")
-	command = []string{"run", "-d", "-v", "/home/docker/nodeconfig:/payload/config", "-p", "8000:8000", evt.Payload.DockerImage, "/payload/runfaucet.sh"}
-	log.Debugf("Running docker %s on %s\n", command, firstValidator.ID())
-	_, err = dm.RunDocker(firstValidator.ID(), command, cmdRunner)
+	command = []string{"run", "-d", "--name", name, "--label", fmt.Sprintf("%s=%s", ContainerLabel, evt.ID())}
+	if s.Restart != "" {
+		command = append(command, "--restart", s.Restart)
+	}
+	if s.CPUs != "" {
+		command = append(command, "--cpus", s.CPUs)
+	}
+	if s.Memory != "" {
+		command = append(command, "--memory", s.Memory)
+	}
+	for _, e := range env {
+		command = append(command, "-e", e)
+	}
+	for _, v := range s.Volumes {
+		command = append(command, "-v", v)
+	}
+	for _, p := range s.Ports {
+		command = append(command, "-p", p)
+	}
+	command = append(command, serviceImage(s, evt))
+	command = append(command, entrypoint...)
 	return
 }
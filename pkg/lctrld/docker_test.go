@@ -1,11 +1,20 @@
 package lctrld
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
 
+	"github.com/apeunit/LaunchControlD/pkg/config"
 	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	"github.com/stretchr/testify/assert"
 )
 
 type mockDockerMachineConfig struct {
@@ -24,3 +33,157 @@ func (m *mockDockerMachineConfig) ReadConfig(machineN string) (mc *model.Machine
 
 	return new(model.Machine), nil
 }
+
+// fakeDockerMachine emulates docker-machine create/stop/rm, writing the
+// machine config.json where lctrld expects to find it
+type fakeDockerMachine struct {
+	settings *config.Schema
+	fail     string // name of the machine whose creation fails
+	sync.Mutex
+	running, maxRunning int
+	removed             []string
+}
+
+func (f *fakeDockerMachine) run(ctx context.Context, command, envVars []string) (out string, err error) {
+	machineName := command[len(command)-1]
+	switch {
+	case strings.Contains(strings.Join(command, " "), " create "):
+		f.Lock()
+		f.running++
+		if f.running > f.maxRunning {
+			f.maxRunning = f.running
+		}
+		f.Unlock()
+		defer func() {
+			f.Lock()
+			f.running--
+			f.Unlock()
+		}()
+		if machineName == f.fail {
+			return "", errors.New("create failed")
+		}
+		evtID := machineName[:strings.LastIndex(machineName, "-")]
+		home, _ := f.settings.Evts(evtID)
+		dir := filepath.Join(home, DockerHome, "machine", "machines", machineName)
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			return
+		}
+		err = utils.StoreJSON(filepath.Join(dir, "config.json"), map[string]interface{}{
+			"Name":   machineName,
+			"Driver": map[string]interface{}{"IPAddress": "10.0.0.1", "MachineName": machineName},
+		})
+	case command[1] == "rm":
+		f.Lock()
+		f.removed = append(f.removed, machineName)
+		f.Unlock()
+	}
+	return
+}
+
+func newTestEvent(validators int) *model.Event {
+	var accounts []model.GenesisAccount
+	for i := 0; i < validators; i++ {
+		accounts = append(accounts, model.GenesisAccount{Name: fmt.Sprintf("v%d@apeunit.com", i), GenesisBalance: model.MustParseCoins("100stake"), Validator: true})
+	}
+	return model.NewEvent("drop", "owner@apeunit.com", "virtualbox", accounts, model.PayloadLocation{})
+}
+
+func TestProvisionEventParallel(t *testing.T) {
+	settings := &config.Schema{Workspace: t.TempDir(), Provisioning: config.Provisioning{Workers: 2}}
+	evt := newTestEvent(5)
+	assert.Nil(t, CreateEvent(settings, evt))
+
+	fdm := &fakeDockerMachine{settings: settings}
+	err := ProvisionEvent(context.Background(), settings, evt, fdm.run)
+	assert.Nil(t, err)
+	assert.Len(t, evt.State, 5)
+	assert.LessOrEqual(t, fdm.maxRunning, 2)
+	assert.Equal(t, model.StatusProvisioned, evt.CurrentStatus())
+}
+
+func TestProvisionEventRollback(t *testing.T) {
+	settings := &config.Schema{Workspace: t.TempDir(), Provisioning: config.Provisioning{Workers: 1}}
+	evt := newTestEvent(3)
+	assert.Nil(t, CreateEvent(settings, evt))
+
+	fdm := &fakeDockerMachine{settings: settings, fail: evt.NodeID(1)}
+	err := ProvisionEvent(context.Background(), settings, evt, fdm.run)
+	assert.NotNil(t, err)
+	assert.Len(t, evt.State, 0)
+	// every started machine is removed, including the one that failed,
+	// and no machine is started after the failure
+	assert.ElementsMatch(t, []string{evt.NodeID(0), evt.NodeID(1)}, fdm.removed)
+	assert.Equal(t, model.StatusFailed, evt.CurrentStatus())
+	assert.Equal(t, model.StatusCreated, evt.EffectiveStatus())
+}
+
+// fakeContainers emulates the containers of the docker daemons of the machines
+type fakeContainers struct {
+	containers  map[string]map[string]bool // by machine, by name
+	removedDirs []string
+}
+
+func (f *fakeContainers) run(ctx context.Context, command, envVars []string) (out string, err error) {
+	if filepath.Base(command[0]) != "docker" {
+		if len(command) > 3 && command[1] == "ssh" && command[3] == "rm" {
+			f.removedDirs = append(f.removedDirs, command[2]+":"+command[len(command)-1])
+		}
+		return
+	}
+	machine := envValue(envVars, "DOCKER_MACHINE_NAME")
+	if f.containers[machine] == nil {
+		f.containers[machine] = make(map[string]bool)
+	}
+	switch command[1] {
+	case "run":
+		name := argValue(command, "--name")
+		if f.containers[machine][name] {
+			return "", fmt.Errorf("the container name %s is already in use", name)
+		}
+		f.containers[machine][name] = true
+	case "ps":
+		for name := range f.containers[machine] {
+			out += name + "\n"
+		}
+	case "rm":
+		for _, name := range command[3:] {
+			delete(f.containers[machine], name)
+		}
+	}
+	return
+}
+
+func TestUndeployPayload(t *testing.T) {
+	settings := &config.Schema{Workspace: t.TempDir(), DockerMachine: config.DockerMachine{Binary: "docker-machine"}}
+	evt := newTestEvent(2)
+	evt.Payload.Services = []config.ServiceSpec{
+		{Name: config.ServiceDaemon, Volumes: []string{config.NodeConfigVolume}, Nodes: []string{config.NodesAll}},
+		{Name: "explorer", Image: "example/explorer:v1", Nodes: []string{config.NodesServices}},
+	}
+	assert.Nil(t, CreateEvent(settings, evt))
+	for i, name := range evt.NodeNames() {
+		evt.State[name] = &model.Machine{N: fmt.Sprint(i), EventID: evt.ID()}
+	}
+	assert.Nil(t, evt.Transition(model.StatusProvisioned, ""))
+	// there is nothing to undeploy before the configuration
+	assert.True(t, errors.Is(UndeployPayload(context.Background(), settings, evt, nil), model.ErrInvalidTransition))
+	assert.Nil(t, evt.Transition(model.StatusConfigured, ""))
+
+	// a new deployment replaces the containers of the previous one
+	fc := &fakeContainers{containers: make(map[string]map[string]bool)}
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, deployPayload(context.Background(), settings, evt, fc.run))
+	}
+	assert.Equal(t, map[string]map[string]bool{
+		evt.NodeID(0): {evt.NodeID(0) + "-daemon": true, evt.NodeID(0) + "-explorer": true},
+		evt.NodeID(1): {evt.NodeID(1) + "-daemon": true},
+	}, fc.containers)
+	assert.Nil(t, evt.Transition(model.StatusDeployed, ""))
+
+	assert.Nil(t, UndeployPayload(context.Background(), settings, evt, fc.run))
+	for _, containers := range fc.containers {
+		assert.Empty(t, containers)
+	}
+	assert.ElementsMatch(t, []string{evt.NodeID(0) + ":/home/docker/nodeconfig", evt.NodeID(1) + ":/home/docker/nodeconfig"}, fc.removedDirs)
+	assert.Equal(t, model.StatusConfigured, evt.CurrentStatus())
+}
@@ -1,6 +1,7 @@
 package lctrld
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -73,14 +74,14 @@ func (dm *DockerMachine) ReadConfig(machineName string) (mc *model.Machine, err
 }
 
 // ProvisionMachine runs docker-machine create MACHINE_NAME
-func (dm *DockerMachine) ProvisionMachine(machineName, provider string, cmdRunner cmdrunner.CommandRunner) (mc *model.Machine, err error) {
+func (dm *DockerMachine) ProvisionMachine(ctx context.Context, machineName, provider string, cmdRunner cmdrunner.CommandRunner) (mc *model.Machine, err error) {
 	driver := dm.Settings.DockerMachine.Drivers[provider]
 
 	p := []string{dm.Settings.DmBin(), "--debug", "create", "--driver", provider, "--engine-install-url", "https://releases.rancher.com/install-docker/19.03.9.sh"}
 	p = append(p, driver.Params...)
 	p = append(p, machineName)
 
-	_, err = cmdRunner(p, dm.EnvVars)
+	_, err = cmdRunner(ctx, p, dm.EnvVars)
 	if err != nil {
 		return
 	}
@@ -89,15 +90,15 @@ func (dm *DockerMachine) ProvisionMachine(machineName, provider string, cmdRunne
 }
 
 // StopMachine runs docker-machine stop MACHINE_NAME && docker-machine rm -y MACHINE_NAME
-func (dm *DockerMachine) StopMachine(machineName string, cmdRunner cmdrunner.CommandRunner) (err error) {
+func (dm *DockerMachine) StopMachine(ctx context.Context, machineName string, cmdRunner cmdrunner.CommandRunner) (err error) {
 	p := []string{dm.Settings.DmBin(), "stop", machineName}
-	_, err = cmdRunner(p, dm.EnvVars)
+	_, err = cmdRunner(ctx, p, dm.EnvVars)
 	if err != nil {
 		return
 	}
 
 	p = []string{dm.Settings.DmBin(), "rm", "-y", machineName}
-	_, err = cmdRunner(p, dm.EnvVars)
+	_, err = cmdRunner(ctx, p, dm.EnvVars)
 	if err != nil {
 		return
 	}
@@ -105,15 +106,15 @@ func (dm *DockerMachine) StopMachine(machineName string, cmdRunner cmdrunner.Com
 }
 
 // Status runs docker-machine ip MACHINE_NAME and docker-machine status machine_NAME
-func (dm *DockerMachine) Status(machineName string, cmdRunner cmdrunner.CommandRunner) (out string, err error) {
+func (dm *DockerMachine) Status(ctx context.Context, machineName string, cmdRunner cmdrunner.CommandRunner) (out string, err error) {
 	var out1, out2 string
 	p := []string{dm.Settings.DmBin(), "status", machineName}
-	out1, err = cmdRunner(p, dm.EnvVars)
+	out1, err = cmdRunner(ctx, p, dm.EnvVars)
 	if err != nil {
 		return
 	}
 	p = []string{dm.Settings.DmBin(), "ip", machineName}
-	out2, err = cmdRunner(p, dm.EnvVars)
+	out2, err = cmdRunner(ctx, p, dm.EnvVars)
 	if err != nil {
 		return
 	}
@@ -125,8 +126,8 @@ func (dm *DockerMachine) Status(machineName string, cmdRunner cmdrunner.CommandR
 // machine's docker installation and run a commnad for safety, this command
 // prepends "docker" to any command you send it. Therefore, to run "docker pull
 // <IMAGE>" on the remote machine, pass in []string{"pull", IMAGENAME}
-func (dm *DockerMachine) RunDocker(machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (out string, err error) {
-	ip, err := cmdRunner([]string{dm.Settings.DmBin(), "ip", machineName}, dm.EnvVars)
+func (dm *DockerMachine) RunDocker(ctx context.Context, machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (out string, err error) {
+	ip, err := cmdRunner(ctx, []string{dm.Settings.DmBin(), "ip", machineName}, dm.EnvVars)
 	if err != nil {
 		return
 	}
@@ -139,22 +140,22 @@ func (dm *DockerMachine) RunDocker(machineName string, cmd []string, cmdRunner c
 	)
 	finalCmd := []string{"docker"}
 	finalCmd = append(finalCmd, cmd...)
-	out, err = cmdRunner(finalCmd, envVars)
+	out, err = cmdRunner(ctx, finalCmd, envVars)
 	return
 }
 
 // Run uses docker-machine ssh to run a command on the remote machine.
-func (dm *DockerMachine) Run(machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (out string, err error) {
+func (dm *DockerMachine) Run(ctx context.Context, machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (out string, err error) {
 	finalCmd := []string{dm.Settings.DmBin(), "ssh", machineName}
 	finalCmd = append(finalCmd, cmd...)
-	out, err = cmdRunner(finalCmd, dm.EnvVars)
+	out, err = cmdRunner(ctx, finalCmd, dm.EnvVars)
 	return
 }
 
 // Copy recursively copies a path from the local machine to the provisioned Machine
-func (dm *DockerMachine) Copy(machineName, sourcePath, destPath string, cmdRunner cmdrunner.CommandRunner) (err error) {
+func (dm *DockerMachine) Copy(ctx context.Context, machineName, sourcePath, destPath string, cmdRunner cmdrunner.CommandRunner) (err error) {
 	p := []string{dm.Settings.DmBin(), "scp", "-r", sourcePath, fmt.Sprintf("%s:%s", machineName, destPath)}
-	_, err = cmdRunner(p, dm.EnvVars)
+	_, err = cmdRunner(ctx, p, dm.EnvVars)
 	return
 }
 
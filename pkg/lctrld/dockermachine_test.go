@@ -1,6 +1,7 @@
 package lctrld
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -35,7 +36,7 @@ func TestDockerMachineProvisionMachine(t *testing.T) {
 	machineName := fmt.Sprintf("%s-%s", evtID, "0")
 	dm := NewDockerMachine(mockSettings, evtID)
 	fmt.Println(dm.EnvVars)
-	mc, err := dm.ProvisionMachine(machineName, "virtualbox", cmdrunner.RunCommand)
+	mc, err := dm.ProvisionMachine(context.Background(), machineName, "virtualbox", cmdrunner.RunCommand)
 	fmt.Printf("%#v\n", mc)
 
 	if err != nil {
@@ -43,9 +44,9 @@ func TestDockerMachineProvisionMachine(t *testing.T) {
 	}
 
 	// cleanup: remove workspacedir/evts/<EVTID>
-	_, err = cmdrunner.RunCommand([]string{"VBoxManage", "controlvm", machineName, "poweroff"}, dm.EnvVars)
+	_, err = cmdrunner.RunCommand(context.Background(), []string{"VBoxManage", "controlvm", machineName, "poweroff"}, dm.EnvVars)
 	assert.Nil(t, err)
-	_, err = cmdrunner.RunCommand([]string{"VBoxManage", "unregistervm", machineName}, dm.EnvVars)
+	_, err = cmdrunner.RunCommand(context.Background(), []string{"VBoxManage", "unregistervm", machineName}, dm.EnvVars)
 	assert.Nil(t, err)
 	evtDir, err := mockSettings.Evts(evtID)
 	assert.Nil(t, err)
@@ -59,14 +60,14 @@ func TestDockerMachineStopMachine(t *testing.T) {
 	machineName := fmt.Sprintf("%s-%s", evtID, "0")
 	dm := NewDockerMachine(mockSettings, evtID)
 	fmt.Println(dm.EnvVars)
-	_, err := dm.ProvisionMachine(machineName, "virtualbox", cmdrunner.RunCommand)
+	_, err := dm.ProvisionMachine(context.Background(), machineName, "virtualbox", cmdrunner.RunCommand)
 
 	if err != nil {
 		t.Error(err)
 	}
 
 	fmt.Println("Gonna stop the machine")
-	err = dm.StopMachine(machineName, cmdrunner.RunCommand)
+	err = dm.StopMachine(context.Background(), machineName, cmdrunner.RunCommand)
 	if err != nil {
 		t.Error(err)
 	}
@@ -84,23 +85,23 @@ func TestDockerMachineGeneral(t *testing.T) {
 	machineName := fmt.Sprintf("%s-%s", evtID, "0")
 	dm := NewDockerMachine(mockSettings, evtID)
 	fmt.Println(dm.EnvVars)
-	_, err = dm.ProvisionMachine(machineName, "virtualbox", cmdrunner.RunCommand)
+	_, err = dm.ProvisionMachine(context.Background(), machineName, "virtualbox", cmdrunner.RunCommand)
 
 	if err != nil {
 		t.Error(err)
 	}
 
 	t.Run("testRun", func(t *testing.T) {
-		out, err := dm.Run(machineName, []string{"hostname"}, cmdrunner.RunCommand)
+		out, err := dm.Run(context.Background(), machineName, []string{"hostname"}, cmdrunner.RunCommand)
 		if err != nil {
 			t.Error(err)
 		}
 		assert.Equal(t, out, machineName)
-		_, err = dm.Run(machineName, []string{"mkdir", "/home/docker/testdir"}, cmdrunner.RunCommand)
+		_, err = dm.Run(context.Background(), machineName, []string{"mkdir", "/home/docker/testdir"}, cmdrunner.RunCommand)
 		if err != nil {
 			t.Error(err)
 		}
-		out, err = dm.Run(machineName, []string{"ls", "-la", "/home/docker/"}, cmdrunner.RunCommand)
+		out, err = dm.Run(context.Background(), machineName, []string{"ls", "-la", "/home/docker/"}, cmdrunner.RunCommand)
 		if err != nil {
 			t.Error(err)
 		}
@@ -114,10 +115,10 @@ func TestDockerMachineGeneral(t *testing.T) {
 		err = os.Mkdir(testDir, 0755)
 		assert.Nil(t, err)
 
-		err = dm.Copy(machineName, testDir, "/home/docker", cmdrunner.RunCommand)
+		err = dm.Copy(context.Background(), machineName, testDir, "/home/docker", cmdrunner.RunCommand)
 		assert.Nil(t, err)
 
-		out, err := dm.Run(machineName, []string{"ls", "-la", "/home/docker/"}, cmdrunner.RunCommand)
+		out, err := dm.Run(context.Background(), machineName, []string{"ls", "-la", "/home/docker/"}, cmdrunner.RunCommand)
 		if err != nil {
 			t.Error(err)
 		}
@@ -126,7 +127,7 @@ func TestDockerMachineGeneral(t *testing.T) {
 	})
 
 	fmt.Println("Gonna stop the machine")
-	err = dm.StopMachine(machineName, cmdrunner.RunCommand)
+	err = dm.StopMachine(context.Background(), machineName, cmdrunner.RunCommand)
 	if err != nil {
 		t.Error(err)
 	}
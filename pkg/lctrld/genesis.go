@@ -0,0 +1,156 @@
+package lctrld
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// SetGenesisParams applies the genesis parameters of the event to the
+// genesis.json of the first validator, EditConfigs then copies it to the
+// other nodes
+func SetGenesisParams(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
+	if evt.GenesisParams == nil {
+		return
+	}
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return
+	}
+	_, valAccounts := evt.Validators()
+	genesisPath := path.Join(valAccounts[0].ConfigLocation.DaemonConfigDir, "config/genesis.json")
+	if p := plannerFrom(ctx); p != nil {
+		changes, err := genesisParamChanges(evt.ChainID(), evt.GenesisParams, profile.Genesis())
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			p.edit(valAccounts[0].Name, genesisPath, c.path, c.value)
+		}
+		return nil
+	}
+	log.Infoln("Applying the genesis parameters to node 0's genesis.json")
+	info, err := os.Stat(genesisPath)
+	if err != nil {
+		return
+	}
+	genesis, err := readGenesis(genesisPath)
+	if err != nil {
+		return
+	}
+	if err = applyGenesisParams(genesis, evt.ChainID(), evt.GenesisParams, profile.Genesis()); err != nil {
+		return fmt.Errorf("cannot apply the genesis parameters to %s: %w", genesisPath, err)
+	}
+	data, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(genesisPath, data, info.Mode())
+}
+
+// readGenesis reads a genesis.json keeping the numbers as they are
+func readGenesis(genesisPath string) (genesis map[string]interface{}, err error) {
+	data, err := ioutil.ReadFile(genesisPath)
+	if err != nil {
+		return
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	err = d.Decode(&genesis)
+	return
+}
+
+// genesisChange is the value to set at a dotted path of a genesis
+type genesisChange struct {
+	path  string
+	value interface{}
+}
+
+// applyGenesisParams sets the parameters in a genesis in a genesis layout, a
+// parameter missing from the genesis is an error since it would be silently
+// ignored by the chain
+func applyGenesisParams(genesis map[string]interface{}, chainID string, p *model.GenesisParams, layout string) (err error) {
+	changes, err := genesisParamChanges(chainID, p, layout)
+	if err != nil {
+		return
+	}
+	for _, c := range changes {
+		if err = setGenesisValue(genesis, c.path, c.value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// genesisParamChanges returns the values set in the genesis for the
+// parameters, the durations are in nanoseconds in the legacy layout and in
+// seconds, i.e. 600s, in the stargate one
+func genesisParamChanges(chainID string, p *model.GenesisParams, layout string) (changes []genesisChange, err error) {
+	if err = p.Validate(); err != nil {
+		return
+	}
+	if layout != config.GenesisLegacy && layout != config.GenesisStargate {
+		return nil, fmt.Errorf("unknown genesis layout %s", layout)
+	}
+	duration := func(s string) string {
+		d, _ := model.ParseGenesisDuration(s)
+		if layout == config.GenesisStargate {
+			return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+		}
+		return strconv.FormatInt(d.Nanoseconds(), 10)
+	}
+	changes = []genesisChange{{"chain_id", chainID}}
+	if p.GenesisTime != "" {
+		changes = append(changes, genesisChange{"genesis_time", p.GenesisTime})
+	}
+	if p.UnbondingTime != "" {
+		changes = append(changes, genesisChange{"app_state.staking.params.unbonding_time", duration(p.UnbondingTime)})
+	}
+	if p.MaxValidators != 0 {
+		changes = append(changes, genesisChange{"app_state.staking.params.max_validators", json.Number(strconv.Itoa(p.MaxValidators))})
+	}
+	if p.VotingPeriod != "" {
+		changes = append(changes, genesisChange{"app_state.gov.voting_params.voting_period", duration(p.VotingPeriod)})
+	}
+	if p.Inflation != "" {
+		// the inflation is fixed by pinning its bounds
+		changes = append(changes,
+			genesisChange{"app_state.mint.minter.inflation", p.Inflation},
+			genesisChange{"app_state.mint.params.inflation_min", p.Inflation},
+			genesisChange{"app_state.mint.params.inflation_max", p.Inflation},
+		)
+	}
+	if p.BlockMaxGas != 0 {
+		changes = append(changes, genesisChange{"consensus_params.block.max_gas", strconv.FormatInt(p.BlockMaxGas, 10)})
+	}
+	return
+}
+
+// setGenesisValue replaces the value at a dotted path of a genesis
+func setGenesisValue(genesis map[string]interface{}, dottedPath string, value interface{}) error {
+	keys := strings.Split(dottedPath, ".")
+	m := genesis
+	for i, k := range keys[:len(keys)-1] {
+		var ok bool
+		if m, ok = m[k].(map[string]interface{}); !ok {
+			return fmt.Errorf("%s not found", strings.Join(keys[:i+1], "."))
+		}
+	}
+	last := keys[len(keys)-1]
+	if _, ok := m[last]; !ok {
+		return fmt.Errorf("%s not found", dottedPath)
+	}
+	m[last] = value
+	return nil
+}
@@ -0,0 +1,96 @@
+package lctrld
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyGenesisParams(t *testing.T) {
+	genesis, err := readGenesis("testdata/genesis.json")
+	require.Nil(t, err)
+	p := &model.GenesisParams{
+		ChainID:       "workshop-1",
+		GenesisTime:   "2021-03-01T09:00:00Z",
+		UnbondingTime: "10m",
+		MaxValidators: 10,
+		VotingPeriod:  "5m",
+		Inflation:     "0.05",
+		BlockMaxGas:   10000000,
+	}
+	require.Nil(t, applyGenesisParams(genesis, p.ChainID, p, config.GenesisLegacy))
+
+	data, err := json.Marshal(genesis)
+	require.Nil(t, err)
+	var g struct {
+		ChainID         string `json:"chain_id"`
+		GenesisTime     string `json:"genesis_time"`
+		ConsensusParams struct {
+			Block struct {
+				MaxGas string `json:"max_gas"`
+			} `json:"block"`
+		} `json:"consensus_params"`
+		AppState struct {
+			Staking struct {
+				Params struct {
+					UnbondingTime string `json:"unbonding_time"`
+					MaxValidators int    `json:"max_validators"`
+				} `json:"params"`
+			} `json:"staking"`
+			Gov struct {
+				VotingParams struct {
+					VotingPeriod string `json:"voting_period"`
+				} `json:"voting_params"`
+			} `json:"gov"`
+			Mint struct {
+				Minter struct {
+					Inflation string `json:"inflation"`
+				} `json:"minter"`
+				Params struct {
+					InflationMax string `json:"inflation_max"`
+				} `json:"params"`
+			} `json:"mint"`
+			Auth struct {
+				Accounts []interface{} `json:"accounts"`
+			} `json:"auth"`
+		} `json:"app_state"`
+	}
+	require.Nil(t, json.Unmarshal(data, &g))
+	assert.Equal(t, "workshop-1", g.ChainID)
+	assert.Equal(t, "2021-03-01T09:00:00Z", g.GenesisTime)
+	assert.Equal(t, "10000000", g.ConsensusParams.Block.MaxGas)
+	assert.Equal(t, "600000000000", g.AppState.Staking.Params.UnbondingTime)
+	assert.Equal(t, 10, g.AppState.Staking.Params.MaxValidators)
+	assert.Equal(t, "300000000000", g.AppState.Gov.VotingParams.VotingPeriod)
+	assert.Equal(t, "0.05", g.AppState.Mint.Minter.Inflation)
+	assert.Equal(t, "0.05", g.AppState.Mint.Params.InflationMax)
+	// the rest of the genesis is kept
+	assert.Len(t, g.AppState.Auth.Accounts, 3)
+
+	// parameters missing from the genesis are not silently added
+	err = applyGenesisParams(map[string]interface{}{"chain_id": "x"}, "x", &model.GenesisParams{VotingPeriod: "5m"}, config.GenesisLegacy)
+	assert.EqualError(t, err, "app_state not found")
+
+	err = applyGenesisParams(genesis, "x", &model.GenesisParams{Inflation: "5%"}, config.GenesisLegacy)
+	assert.NotNil(t, err)
+
+	// the stargate durations are in seconds
+	genesis, err = readGenesis("testdata/genesis_stargate.json")
+	require.Nil(t, err)
+	require.Nil(t, applyGenesisParams(genesis, p.ChainID, p, config.GenesisStargate))
+	data, err = json.Marshal(genesis)
+	require.Nil(t, err)
+	require.Nil(t, json.Unmarshal(data, &g))
+	assert.Equal(t, "workshop-1", g.ChainID)
+	assert.Equal(t, "600s", g.AppState.Staking.Params.UnbondingTime)
+	assert.Equal(t, 10, g.AppState.Staking.Params.MaxValidators)
+	assert.Equal(t, "300s", g.AppState.Gov.VotingParams.VotingPeriod)
+	assert.Equal(t, "0.05", g.AppState.Mint.Params.InflationMax)
+
+	err = applyGenesisParams(genesis, "x", &model.GenesisParams{}, "amino")
+	assert.EqualError(t, err, "unknown genesis layout amino")
+}
@@ -0,0 +1,283 @@
+package lctrld
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+)
+
+// Container ports of the endpoints of the services, the host ports are the
+// ones publishing them in the service specs
+const (
+	TendermintRPCPort = 26657
+	LightClientPort   = 1317
+	FaucetPort        = 8000
+)
+
+// healthCheckTimeout limits the time waited for each endpoint
+const healthCheckTimeout = 5 * time.Second
+
+// EventHealth is the health of the chain of a deployed event
+type EventHealth struct {
+	EventID     string         `json:"event_id"`
+	Healthy     bool           `json:"healthy"`
+	CheckedOn   time.Time      `json:"checked_on"`
+	Nodes       []NodeHealth   `json:"nodes"`
+	LightClient EndpointHealth `json:"light_client"`
+	Faucet      EndpointHealth `json:"faucet"`
+}
+
+// NodeHealth is the health of a node, as reported by its Tendermint RPC
+type NodeHealth struct {
+	Machine           string         `json:"machine"`
+	Account           string         `json:"account"`
+	Role              model.NodeRole `json:"role"`
+	RPC               EndpointHealth `json:"rpc"`
+	LatestBlockHeight int64          `json:"latest_block_height"`
+	LatestBlockTime   time.Time      `json:"latest_block_time"`
+	CatchingUp        bool           `json:"catching_up"`
+	Peers             int            `json:"peers"`
+}
+
+// EndpointHealth tells whenever an endpoint answered
+type EndpointHealth struct {
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Healthy tells whenever the node is in sync and producing blocks
+func (n *NodeHealth) Healthy() bool {
+	return n.RPC.Reachable && !n.CatchingUp && n.LatestBlockHeight > 0
+}
+
+// tendermintStatus is the part of the /status reply of the Tendermint RPC
+// used for the health checks
+type tendermintStatus struct {
+	Result struct {
+		SyncInfo struct {
+			LatestBlockHeight string    `json:"latest_block_height"`
+			LatestBlockTime   time.Time `json:"latest_block_time"`
+			CatchingUp        bool      `json:"catching_up"`
+		} `json:"sync_info"`
+	} `json:"result"`
+}
+
+// tendermintNetInfo is the part of the /net_info reply of the Tendermint RPC
+// used for the health checks
+type tendermintNetInfo struct {
+	Result struct {
+		NPeers string `json:"n_peers"`
+	} `json:"result"`
+}
+
+// serviceEndpoints are the host:port addresses of the services of an event,
+// the services that are disabled or do not publish their port have none
+type serviceEndpoints struct {
+	// RPC are the Tendermint RPC of the nodes, by node name
+	RPC         map[string]string
+	LightClient string
+	Faucet      string
+}
+
+// eventEndpoints returns the addresses of the services of an event from its
+// service specs: the host port publishing the container port of each service
+// on the nodes the service runs on
+func eventEndpoints(settings *config.Schema, evt *model.Event) (e serviceEndpoints, err error) {
+	services, err := payloadServices(settings, evt)
+	if err != nil {
+		return
+	}
+	e.RPC = make(map[string]string)
+	servicesNode := evt.ServicesNode()
+	// the light client and the faucet are looked for on the services node first
+	nodes := append([]string{servicesNode}, evt.NodeNames()...)
+	for _, s := range services {
+		if s.Disabled {
+			continue
+		}
+		for _, name := range nodes {
+			m := evt.State[name]
+			if m == nil || m.Instance.IPAddress == "" || !s.RunsOn(string(evt.NodeRole(name)), name == servicesNode) {
+				continue
+			}
+			switch s.Name {
+			case config.ServiceDaemon:
+				if port := publishedPort(s, TendermintRPCPort); port != 0 {
+					e.RPC[name] = fmt.Sprintf("%s:%d", m.Instance.IPAddress, port)
+				}
+			case config.ServiceLightClient:
+				if port := publishedPort(s, LightClientPort); port != 0 && e.LightClient == "" {
+					e.LightClient = fmt.Sprintf("%s:%d", m.Instance.IPAddress, port)
+				}
+			case config.ServiceFaucet:
+				if port := publishedPort(s, FaucetPort); port != 0 && e.Faucet == "" {
+					e.Faucet = fmt.Sprintf("%s:%d", m.Instance.IPAddress, port)
+				}
+			}
+		}
+	}
+	return
+}
+
+// publishedPort returns the host port publishing a tcp container port of a
+// service, 0 if the port is not published on a known host port
+func publishedPort(s config.ServiceSpec, containerPort int) int {
+	for _, p := range s.Ports {
+		if strings.HasSuffix(p, "/udp") {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(p, "/tcp"), ":")
+		if len(parts) < 2 {
+			// docker picks a random host port
+			continue
+		}
+		hostFirst, _, hErr := portRange(parts[len(parts)-2])
+		first, last, cErr := portRange(parts[len(parts)-1])
+		if hErr == nil && cErr == nil && containerPort >= first && containerPort <= last {
+			return hostFirst + containerPort - first
+		}
+	}
+	return 0
+}
+
+// portRange parses a port or a range of ports, i.e. 26656-26658
+func portRange(s string) (first, last int, err error) {
+	bounds := strings.SplitN(s, "-", 2)
+	if first, err = strconv.Atoi(bounds[0]); err != nil {
+		return
+	}
+	last = first
+	if len(bounds) == 2 {
+		last, err = strconv.Atoi(bounds[1])
+	}
+	return
+}
+
+// CheckEventHealth queries the Tendermint RPC of every node of the event, and
+// the light client and the faucet, on the ports published by their services.
+// The services that are not deployed are not checked.
+func CheckEventHealth(ctx context.Context, settings *config.Schema, evt *model.Event) (health *EventHealth, err error) {
+	endpoints, err := eventEndpoints(settings, evt)
+	if err != nil {
+		return
+	}
+	names := make([]string, 0, len(evt.State))
+	for name := range evt.State {
+		names = append(names, name)
+	}
+	health = &EventHealth{
+		EventID:   evt.ID(),
+		CheckedOn: time.Now(),
+		// every node check writes its own slot
+		Nodes: make([]NodeHealth, len(names)),
+	}
+	var wg sync.WaitGroup
+	for i, name := range names {
+		m := evt.State[name]
+		rpc, found := endpoints.RPC[name]
+		if !found {
+			health.Nodes[i] = NodeHealth{Machine: m.ID(), Account: name, Role: evt.NodeRole(name),
+				RPC: EndpointHealth{Error: "the Tendermint RPC is not published"}}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string, m *model.Machine, rpc string) {
+			defer wg.Done()
+			n := checkNodeHealth(ctx, name, m, "http://"+rpc)
+			n.Role = evt.NodeRole(name)
+			health.Nodes[i] = n
+		}(i, name, m, rpc)
+	}
+	if endpoints.LightClient != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health.LightClient = checkEndpoint(ctx, "http://"+endpoints.LightClient+"/node_info", nil)
+		}()
+	}
+	if endpoints.Faucet != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health.Faucet = checkEndpoint(ctx, "http://"+endpoints.Faucet+"/status", nil)
+		}()
+	}
+	wg.Wait()
+	sort.Slice(health.Nodes, func(i, j int) bool { return health.Nodes[i].Machine < health.Nodes[j].Machine })
+
+	health.Healthy = len(endpoints.RPC) > 0 &&
+		(endpoints.LightClient == "" || health.LightClient.Reachable) &&
+		(endpoints.Faucet == "" || health.Faucet.Reachable)
+	for _, n := range health.Nodes {
+		// the nodes without a published RPC cannot be checked
+		if n.RPC.URL != "" {
+			health.Healthy = health.Healthy && n.Healthy()
+		}
+	}
+	return
+}
+
+// checkNodeHealth queries the Tendermint RPC of a node at the base url
+func checkNodeHealth(ctx context.Context, account string, m *model.Machine, base string) (n NodeHealth) {
+	n = NodeHealth{Machine: m.ID(), Account: account}
+
+	var status tendermintStatus
+	n.RPC = checkEndpoint(ctx, base+"/status", &status)
+	if !n.RPC.Reachable {
+		return
+	}
+	n.LatestBlockHeight, _ = strconv.ParseInt(status.Result.SyncInfo.LatestBlockHeight, 10, 64)
+	n.LatestBlockTime = status.Result.SyncInfo.LatestBlockTime
+	n.CatchingUp = status.Result.SyncInfo.CatchingUp
+
+	var netInfo tendermintNetInfo
+	if e := checkEndpoint(ctx, base+"/net_info", &netInfo); e.Reachable {
+		n.Peers, _ = strconv.Atoi(netInfo.Result.NPeers)
+	}
+	return
+}
+
+// checkEndpoint sends a GET request to an endpoint, the endpoint is
+// reachable if it answers with a non error status. If v is not nil the
+// reply is decoded in it.
+func checkEndpoint(ctx context.Context, url string, v interface{}) (e EndpointHealth) {
+	e.URL = url
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		e.Error = err.Error()
+		return
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.Error = err.Error()
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		io.Copy(ioutil.Discard, res.Body)
+		e.Error = res.Status
+		return
+	}
+	if v != nil {
+		if err = json.NewDecoder(res.Body).Decode(v); err != nil {
+			e.Error = fmt.Sprintf("invalid reply: %v", err)
+			return
+		}
+	}
+	e.Reachable = true
+	return
+}
@@ -0,0 +1,124 @@
+package lctrld
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckNodeHealth(t *testing.T) {
+	rpc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":-1,"result":{"sync_info":{"latest_block_height":"42","latest_block_time":"2021-01-27T10:26:50.848598231Z","catching_up":false}}}`))
+		case "/net_info":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":-1,"result":{"listening":true,"n_peers":"3"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer rpc.Close()
+	m := &model.Machine{N: "0", EventID: "drop-xxx"}
+
+	n := checkNodeHealth(context.Background(), "alice@apeunit.com", m, rpc.URL)
+	assert.True(t, n.RPC.Reachable)
+	assert.Equal(t, int64(42), n.LatestBlockHeight)
+	assert.Equal(t, 3, n.Peers)
+	assert.False(t, n.CatchingUp)
+	assert.True(t, n.Healthy())
+
+	e := checkEndpoint(context.Background(), rpc.URL+"/missing", nil)
+	assert.False(t, e.Reachable)
+	assert.Equal(t, "404 Not Found", e.Error)
+
+	rpc.Close()
+	n = checkNodeHealth(context.Background(), "alice@apeunit.com", m, rpc.URL)
+	assert.False(t, n.RPC.Reachable)
+	assert.NotEmpty(t, n.RPC.Error)
+	assert.False(t, n.Healthy())
+}
+
+func TestCheckEventHealth(t *testing.T) {
+	rpc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":-1,"result":{"sync_info":{"latest_block_height":"42","catching_up":false}}}`))
+		case "/net_info":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":-1,"result":{"listening":true,"n_peers":"1"}}`))
+		}
+	}))
+	defer rpc.Close()
+	rpcURL, err := url.Parse(rpc.URL)
+	require.Nil(t, err)
+	settings := &config.Schema{Workspace: t.TempDir()}
+	req, err := model.LoadEventRequestFromFile("../../examples/simple_event_w_faucet.yml")
+	require.Nil(t, err)
+	evt := model.NewEvent(req.TokenSymbol, req.Owner, "virtualbox", req.GenesisAccounts, model.NewDefaultPayloadLocation())
+	evt.Payload.Services, err = settings.PayloadServices(config.CatalogPayload{Name: config.DefaultPayload}, map[string]config.ServiceSpec{
+		config.ServiceDaemon:      {Ports: []string{rpcURL.Port() + ":26657"}},
+		config.ServiceLightClient: {Disabled: true},
+		config.ServiceFaucet:      {Disabled: true},
+	})
+	require.Nil(t, err)
+	// the RPC of the second node is not published, it has no address
+	names := evt.NodeNames()
+	evt.State[names[0]] = &model.Machine{N: "0", EventID: evt.ID(), Instance: model.MachineNetworkConfig{IPAddress: rpcURL.Hostname()}}
+	evt.State[names[1]] = &model.Machine{N: "1", EventID: evt.ID()}
+
+	health, err := CheckEventHealth(context.Background(), settings, evt)
+	require.Nil(t, err)
+	require.Len(t, health.Nodes, 2)
+	assert.Equal(t, names[0], health.Nodes[0].Account)
+	assert.True(t, health.Nodes[0].Healthy())
+	assert.Equal(t, names[1], health.Nodes[1].Account)
+	assert.Equal(t, "the Tendermint RPC is not published", health.Nodes[1].RPC.Error)
+	assert.True(t, health.Healthy)
+}
+
+func TestEventEndpoints(t *testing.T) {
+	settings := &config.Schema{Workspace: t.TempDir()}
+	req, err := model.LoadEventRequestFromFile("../../examples/simple_event_w_faucet.yml")
+	require.Nil(t, err)
+	evt := model.NewEvent(req.TokenSymbol, req.Owner, "virtualbox", req.GenesisAccounts, model.NewDefaultPayloadLocation())
+	for i, name := range evt.NodeNames() {
+		evt.State[name] = &model.Machine{N: fmt.Sprint(i), EventID: evt.ID(), Instance: model.MachineNetworkConfig{IPAddress: fmt.Sprintf("10.0.0.%d", i+1)}}
+	}
+	servicesIP := evt.State[evt.ServicesNode()].Instance.IPAddress
+
+	// the default services
+	e, err := eventEndpoints(settings, evt)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"alice@apeunit.com": "10.0.0.1:26657", "bob@apeunit.com": "10.0.0.2:26657"}, e.RPC)
+	assert.Equal(t, servicesIP+":1317", e.LightClient)
+	assert.Equal(t, servicesIP+":8000", e.Faucet)
+
+	// the ports of the event services, the disabled services have no endpoint
+	evt.Payload.Services, err = settings.PayloadServices(config.CatalogPayload{Name: config.DefaultPayload}, map[string]config.ServiceSpec{
+		config.ServiceDaemon:      {Ports: []string{"26656-26658:26656-26658"}},
+		config.ServiceLightClient: {Ports: []string{"0.0.0.0:11317:1317/tcp"}},
+		config.ServiceFaucet:      {Disabled: true},
+	})
+	require.Nil(t, err)
+	e, err = eventEndpoints(settings, evt)
+	require.Nil(t, err)
+	assert.Equal(t, "10.0.0.2:26657", e.RPC["bob@apeunit.com"])
+	assert.Equal(t, servicesIP+":11317", e.LightClient)
+	assert.Empty(t, e.Faucet)
+
+	evt.Payload.Services, err = settings.PayloadServices(config.CatalogPayload{Name: config.DefaultPayload}, map[string]config.ServiceSpec{
+		config.ServiceDaemon: {Ports: []string{"26656:26656", "26657"}},
+	})
+	require.Nil(t, err)
+	e, err = eventEndpoints(settings, evt)
+	require.Nil(t, err)
+	// docker publishes the RPC on a random port
+	assert.Empty(t, e.RPC)
+}
@@ -0,0 +1,28 @@
+package lctrld
+
+import (
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// journalRunner wraps a CommandRunner to record the commands run for the
+// event in the event journal
+func journalRunner(settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) cmdrunner.CommandRunner {
+	p, err := settings.JournalFile(evt.ID())
+	if err != nil {
+		log.Warnf("the commands of event %s are not journaled: %v", evt.ID(), err)
+		return cmdRunner
+	}
+	return cmdrunner.NewJournal(p).Wrap(cmdRunner)
+}
+
+// EventJournal returns the commands run for an event, oldest first
+func EventJournal(settings *config.Schema, evtID string) (entries []cmdrunner.JournalEntry, err error) {
+	p, err := settings.JournalFile(evtID)
+	if err != nil {
+		return
+	}
+	return cmdrunner.ReadJournal(p)
+}
@@ -5,8 +5,10 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/apeunit/LaunchControlD/pkg/archive"
 	"github.com/apeunit/LaunchControlD/pkg/config"
 	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
 	"github.com/apeunit/LaunchControlD/pkg/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -23,7 +25,7 @@ func SetupWorkspace(settings *config.Schema) (err error) {
 		}
 	}
 
-	for _, dirN := range []string{"bin", "tmp", "evts"} {
+	for _, dirN := range []string{"bin", "tmp", "evts", "cache"} {
 		dir := filepath.Join(settings.Workspace, dirN)
 		if !utils.FileExists(dir) {
 			log.Debugln("Folder", dir, "does not exists, creating")
@@ -42,7 +44,7 @@ func InstallDockerMachine(settings *config.Schema) (err error) {
 	log.Debug("InstallDockerMachine setup binaries")
 
 	// download if not exists helper
-	dine := func(file, downloadURL string) (err error) {
+	dine := func(file, downloadURL, sha256 string) (err error) {
 		targetPath := settings.Bin(file)
 		log.Debug("InstallDockerMachine: checking ", targetPath)
 		if utils.FileExists(targetPath) {
@@ -56,6 +58,7 @@ func InstallDockerMachine(settings *config.Schema) (err error) {
 			log.Error("InstallDockerMachine: ", err)
 			return
 		}
+		defer os.RemoveAll(td)
 		log.Debug("InstallDockerMachine: file will be download in ", td)
 		dwnFile, err := utils.DownloadFile(td, downloadURL)
 		if err != nil {
@@ -64,50 +67,38 @@ func InstallDockerMachine(settings *config.Schema) (err error) {
 		}
 		dwnFilePath := filepath.Join(td, dwnFile)
 		log.Debug("InstallDockerMachine: download complete ", dwnFilePath)
-		ct, err := utils.DetectContentType(dwnFilePath)
+		// nothing is moved to the bin folder before the verification
+		artifactSum, err := verifyDownload(dwnFilePath, downloadURL, sha256)
 		if err != nil {
-			log.Error("InstallDockerMachine: ", err)
 			return
 		}
-		log.Debug("InstallDockerMachine: downloaded file ", dwnFilePath, " has content-type ", ct)
-		switch ct {
-		case "application/octet-stream":
-			log.Debugln("InstallDockerMachine: downloaded file is binary, moving to the destination path")
-			err = os.Rename(dwnFilePath, targetPath)
-			if err != nil {
-				log.Error("InstallDockerMachine: ", err)
-				return
-			}
-		case "application/zip":
-			err = fmt.Errorf("InstallDockerMachine: unsupported file type %s", ct)
-		case "application/x-gzip":
-			err = utils.ExtractGzip(dwnFilePath, td)
-			if err != nil {
-				log.Error("InstallDockerMachine: ", err)
-				return
-			}
-			err = utils.SearchAndMove(td, file, targetPath)
-			if err != nil {
-				log.Error("InstallDockerMachine: ", err)
-				return
-			}
-		default:
-			err = fmt.Errorf("InstallDockerMachine: unsupported file type %s", ct)
+		// plain binaries and archives with the binary anywhere inside
+		extractDir := filepath.Join(td, "extracted")
+		files, err := archive.Extract(dwnFilePath, extractDir, file)
+		if err != nil {
+			log.Error("InstallDockerMachine: ", err)
+			return
 		}
+		extracted, err := archive.Find(extractDir, files, file)
 		if err != nil {
 			log.Error("InstallDockerMachine: ", err)
 			return
 		}
+		log.Debugln("InstallDockerMachine: moving", extracted, "to the destination path")
+		if err = os.Rename(extracted, targetPath); err != nil {
+			log.Error("InstallDockerMachine: ", err)
+			return
+		}
 		// make it executable
 		os.Chmod(targetPath, 0700)
-		if err != nil {
+		if err = recordInstall(settings, downloadURL, artifactSum, file); err != nil {
 			log.Error("InstallDockerMachine: ", err)
 		}
 		return
 	}
 
 	// check if the system has been setup already
-	err = dine(settings.DockerMachine.Binary, settings.DockerMachine.BinaryURL)
+	err = dine(settings.DockerMachine.Binary, settings.DockerMachine.BinaryURL, settings.DockerMachine.SHA256)
 	if err != nil {
 		log.Error("InstallDockerMachine: ", err)
 		return
@@ -118,7 +109,7 @@ func InstallDockerMachine(settings *config.Schema) (err error) {
 			log.Debugln("InstallDockerMachine: driver", dName, "does not require installation (download url not provided)")
 			continue
 		}
-		err = dine(driver.Binary, driver.BinaryURL)
+		err = dine(driver.Binary, driver.BinaryURL, driver.SHA256)
 		if err != nil {
 			log.Error("InstallDockerMachine: ", err)
 			return
@@ -150,12 +141,28 @@ func LoadEvent(settings *config.Schema, evtID string) (evt *model.Event, err err
 		return
 	}
 	path = filepath.Join(path, config.EvtDescriptorFile)
-	err = utils.LoadJSON(path, &evt)
+	if err = utils.LoadJSON(path, &evt); err != nil {
+		return
+	}
+	err = migrateSecrets(settings, evt)
 	return
 }
 
-// StoreEvent saves the Event model to a file
+// StoreEvent saves the Event model to a file, sealing its secrets if a master
+// key is configured
 func StoreEvent(settings *config.Schema, evt *model.Event) (err error) {
+	keeper, err := secrets.FromSettings(settings)
+	if err != nil {
+		return
+	}
+	return storeEvent(settings, evt, keeper)
+}
+
+// storeEvent seals the secrets of the event with keeper and saves it to a file
+func storeEvent(settings *config.Schema, evt *model.Event, keeper *secrets.Keeper) (err error) {
+	if err = sealEvent(evt, keeper); err != nil {
+		return
+	}
 	path, err := settings.Evts(evt.ID())
 	if err != nil {
 		return
@@ -165,6 +172,16 @@ func StoreEvent(settings *config.Schema, evt *model.Event) (err error) {
 	return
 }
 
+// failEvent marks the event as failed and persists it, the cause is returned
+// unchanged so the caller can pass it along
+func failEvent(settings *config.Schema, evt *model.Event, cause error) error {
+	evt.Fail(cause)
+	if err := StoreEvent(settings, evt); err != nil {
+		log.Errorf("failed to store the status of event %s: %v", evt.ID(), err)
+	}
+	return cause
+}
+
 // ListEvents list available events
 func ListEvents(settings *config.Schema) (events []model.Event, err error) {
 	events = make([]model.Event, 0)
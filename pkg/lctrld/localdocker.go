@@ -0,0 +1,158 @@
+package lctrld
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// LocalDockerProvider is the provider that runs the machines of an event as
+// docker containers on the lctrld host
+const LocalDockerProvider = "local-docker"
+
+// LocalDocker implements the machines of an event as docker-in-docker
+// containers attached to a bridge network dedicated to the event
+type LocalDocker struct {
+	EventID  string
+	EnvVars  []string
+	Settings *config.Schema
+	network  sync.Mutex // serializes the creation/removal of the network
+}
+
+// NewLocalDocker creates a LocalDocker for an event
+func NewLocalDocker(settings *config.Schema, eventID string) *LocalDocker {
+	return &LocalDocker{
+		EventID:  eventID,
+		EnvVars:  utils.BuildEnvVars(settings),
+		Settings: settings,
+	}
+}
+
+// Network returns the name of the docker network of the event
+func (ld *LocalDocker) Network() string {
+	return fmt.Sprintf("lctrld-%s", ld.EventID)
+}
+
+// ensureNetwork creates the network of the event if it does not exist yet
+func (ld *LocalDocker) ensureNetwork(ctx context.Context, cmdRunner cmdrunner.CommandRunner) (err error) {
+	ld.network.Lock()
+	defer ld.network.Unlock()
+	if _, err = cmdRunner(ctx, []string{"docker", "network", "inspect", ld.Network()}, ld.EnvVars); err == nil {
+		return
+	}
+	_, err = cmdRunner(ctx, []string{"docker", "network", "create", "--driver", "bridge", "--label", "lctrld.event=" + ld.EventID, ld.Network()}, ld.EnvVars)
+	return
+}
+
+// ProvisionMachine runs a docker-in-docker container named after the machine
+// and waits for its docker daemon to be ready, the provider is ignored
+func (ld *LocalDocker) ProvisionMachine(ctx context.Context, machineName, provider string, cmdRunner cmdrunner.CommandRunner) (mc *model.Machine, err error) {
+	if err = ld.ensureNetwork(ctx, cmdRunner); err != nil {
+		return
+	}
+	p := []string{"docker", "run", "-d", "--privileged",
+		"--name", machineName,
+		"--hostname", machineName,
+		"--network", ld.Network(),
+		"--label", "lctrld.event=" + ld.EventID,
+		// the daemon is only reached through docker exec, no need for tls
+		"-e", "DOCKER_TLS_CERTDIR=",
+		ld.Settings.LocalDocker.Image,
+	}
+	if _, err = cmdRunner(ctx, p, ld.EnvVars); err != nil {
+		return
+	}
+	if err = ld.waitReady(ctx, machineName, cmdRunner); err != nil {
+		return
+	}
+	ip, err := cmdRunner(ctx, []string{"docker", "inspect", "-f", "{{range .NetworkSettings.Networks}}{{.IPAddress}}{{end}}", machineName}, ld.EnvVars)
+	if err != nil {
+		return
+	}
+	mc = &model.Machine{
+		N:          machineName[strings.LastIndex(machineName, "-")+1:],
+		EventID:    ld.EventID,
+		DriverName: LocalDockerProvider,
+		Instance: model.MachineNetworkConfig{
+			IPAddress:   strings.TrimSpace(ip),
+			MachineName: machineName,
+		},
+	}
+	return
+}
+
+// waitReady polls the docker daemon of a machine until it answers
+func (ld *LocalDocker) waitReady(ctx context.Context, machineName string, cmdRunner cmdrunner.CommandRunner) (err error) {
+	deadline := time.Now().Add(ld.Settings.LocalDocker.ReadyTimeout)
+	for {
+		if _, err = cmdRunner(ctx, []string{"docker", "exec", machineName, "docker", "info"}, ld.EnvVars); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("docker daemon of %s not ready after %s: %w", machineName, ld.Settings.LocalDocker.ReadyTimeout, err)
+		}
+		log.Debugf("waiting for the docker daemon of %s", machineName)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// StopMachine removes the container of a machine, the network of the event
+// is removed together with its last machine
+func (ld *LocalDocker) StopMachine(ctx context.Context, machineName string, cmdRunner cmdrunner.CommandRunner) (err error) {
+	if _, err = cmdRunner(ctx, []string{"docker", "rm", "-f", "-v", machineName}, ld.EnvVars); err != nil {
+		return
+	}
+	ld.network.Lock()
+	defer ld.network.Unlock()
+	out, err := cmdRunner(ctx, []string{"docker", "network", "inspect", "-f", "{{len .Containers}}", ld.Network()}, ld.EnvVars)
+	if err != nil {
+		// the network is gone already
+		log.Debugf("network %s not found: %v", ld.Network(), err)
+		return nil
+	}
+	if strings.TrimSpace(out) == "0" {
+		_, err = cmdRunner(ctx, []string{"docker", "network", "rm", ld.Network()}, ld.EnvVars)
+	}
+	return
+}
+
+// Status returns the container status and the address of a machine
+func (ld *LocalDocker) Status(ctx context.Context, machineName string, cmdRunner cmdrunner.CommandRunner) (out string, err error) {
+	out, err = cmdRunner(ctx, []string{"docker", "inspect", "-f", "{{.State.Status}}\n{{range .NetworkSettings.Networks}}{{.IPAddress}}{{end}}", machineName}, ld.EnvVars)
+	return
+}
+
+// RunDocker runs a docker command with the docker daemon of the machine, to
+// run "docker pull <IMAGE>" on the machine pass in []string{"pull", IMAGENAME}
+func (ld *LocalDocker) RunDocker(ctx context.Context, machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (out string, err error) {
+	return ld.Run(ctx, machineName, append([]string{"docker"}, cmd...), cmdRunner)
+}
+
+// Run uses docker exec to run a command in the machine container
+func (ld *LocalDocker) Run(ctx context.Context, machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (out string, err error) {
+	finalCmd := []string{"docker", "exec", machineName}
+	finalCmd = append(finalCmd, cmd...)
+	out, err = cmdRunner(ctx, finalCmd, ld.EnvVars)
+	return
+}
+
+// Copy uses docker cp to copy a path from the local machine to the machine
+// container, like scp -r an existing destination directory receives a copy
+// of the source
+func (ld *LocalDocker) Copy(ctx context.Context, machineName, sourcePath, destPath string, cmdRunner cmdrunner.CommandRunner) (err error) {
+	p := []string{"docker", "cp", sourcePath, fmt.Sprintf("%s:%s", machineName, destPath)}
+	_, err = cmdRunner(ctx, p, ld.EnvVars)
+	return
+}
@@ -0,0 +1,104 @@
+package lctrld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ Provisioner = (*DockerMachine)(nil)
+	_ Provisioner = (*LocalDocker)(nil)
+)
+
+// fakeDocker emulates the docker cli for the containers of an event
+type fakeDocker struct {
+	sync.Mutex
+	network    bool
+	containers map[string]bool
+	commands   []string
+}
+
+func (f *fakeDocker) run(ctx context.Context, command, envVars []string) (out string, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.commands = append(f.commands, strings.Join(command, " "))
+	args := strings.Join(command[1:], " ")
+	name := command[len(command)-1]
+	switch {
+	case strings.HasPrefix(args, "network inspect -f"):
+		if !f.network {
+			return "", errors.New("no such network")
+		}
+		return fmt.Sprint(len(f.containers)), nil
+	case strings.HasPrefix(args, "network inspect"):
+		if !f.network {
+			return "", errors.New("no such network")
+		}
+	case strings.HasPrefix(args, "network create"):
+		f.network = true
+	case strings.HasPrefix(args, "network rm"):
+		f.network = false
+	case strings.HasPrefix(args, "run"):
+		for i, a := range command {
+			if a == "--name" {
+				f.containers[command[i+1]] = true
+			}
+		}
+	case strings.HasPrefix(args, "inspect"):
+		return "172.18.0." + name[len(name)-1:] + "\n", nil
+	case strings.HasPrefix(args, "rm"):
+		delete(f.containers, name)
+	}
+	return
+}
+
+func TestLocalDockerProvisionEvent(t *testing.T) {
+	settings := &config.Schema{
+		Workspace:    t.TempDir(),
+		LocalDocker:  config.LocalDocker{Image: "docker:dind", ReadyTimeout: time.Second},
+		Provisioning: config.Provisioning{Workers: 3},
+	}
+	evt := newTestEvent(3)
+	evt.Provider = LocalDockerProvider
+	assert.Nil(t, CreateEvent(settings, evt))
+
+	fd := &fakeDocker{containers: make(map[string]bool)}
+	err := ProvisionEvent(context.Background(), settings, evt, fd.run)
+	assert.Nil(t, err)
+	assert.Len(t, fd.containers, 3)
+	assert.Equal(t, model.StatusProvisioned, evt.CurrentStatus())
+	for _, m := range evt.State {
+		assert.Equal(t, LocalDockerProvider, m.DriverName)
+		assert.Equal(t, "172.18.0."+m.N, m.Instance.IPAddress)
+	}
+	// the network is created once, even with parallel workers
+	creates := 0
+	for _, c := range fd.commands {
+		if strings.HasPrefix(c, "docker network create") {
+			creates++
+		}
+	}
+	assert.Equal(t, 1, creates)
+
+	ld := NewLocalDocker(settings, evt.ID())
+	err = ld.Copy(context.Background(), evt.NodeID(0), "/tmp/daemon", "/home/docker/nodeconfig", fd.run)
+	assert.Nil(t, err)
+	assert.Equal(t, "docker cp /tmp/daemon "+evt.NodeID(0)+":/home/docker/nodeconfig", fd.commands[len(fd.commands)-1])
+	_, err = ld.RunDocker(context.Background(), evt.NodeID(0), []string{"pull", "image"}, fd.run)
+	assert.Nil(t, err)
+	assert.Equal(t, "docker exec "+evt.NodeID(0)+" docker pull image", fd.commands[len(fd.commands)-1])
+
+	// the network goes away with the event
+	assert.Nil(t, DestroyEvent(context.Background(), settings, evt, fd.run))
+	assert.Len(t, fd.containers, 0)
+	assert.False(t, fd.network)
+}
@@ -0,0 +1,161 @@
+package lctrld
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/pelletier/go-toml"
+	log "github.com/sirupsen/logrus"
+)
+
+// ApplyNodeConfig applies the node_config overrides of the event to the
+// config.toml and app.toml of each node. Every key must already be in the
+// file, with a value of the same type.
+func ApplyNodeConfig(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
+	if evt.NodeConfig == nil {
+		return
+	}
+	log.Infoln("Applying the node_config overrides to the nodes configuration")
+	for _, name := range evt.NodeNames() {
+		overrides := evt.NodeConfig.For(name)
+		configDir := path.Join(evt.NodeConfigLocation(name).DaemonConfigDir, "config")
+		if p := plannerFrom(ctx); p != nil {
+			planOverrides(p, name, path.Join(configDir, "config.toml"), overrides.Config)
+			planOverrides(p, name, path.Join(configDir, "app.toml"), overrides.App)
+			continue
+		}
+		if err = overrideTOML(path.Join(configDir, "config.toml"), overrides.Config); err != nil {
+			return fmt.Errorf("node %s: %w", name, err)
+		}
+		if err = overrideTOML(path.Join(configDir, "app.toml"), overrides.App); err != nil {
+			return fmt.Errorf("node %s: %w", name, err)
+		}
+	}
+	return
+}
+
+// planOverrides records the overrides of a TOML file in a plan
+func planOverrides(p *Planner, node, tomlPath string, overrides map[string]interface{}) {
+	keys := make([]string, 0, len(overrides))
+	for k := range overrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p.edit(node, tomlPath, k, overrides[k])
+	}
+}
+
+// overrideTOML sets the values in a TOML file by dotted key path
+func overrideTOML(tomlPath string, overrides map[string]interface{}) (err error) {
+	if len(overrides) == 0 {
+		return
+	}
+	info, err := os.Stat(tomlPath)
+	if err != nil {
+		return
+	}
+	t, err := toml.LoadFile(tomlPath)
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %w", tomlPath, err)
+	}
+	keys := make([]string, 0, len(overrides))
+	for k := range overrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		keyPath := strings.Split(k, ".")
+		current := t.GetPath(keyPath)
+		if current == nil {
+			return fmt.Errorf("%s: %s not found", tomlPath, k)
+		}
+		value, err := tomlValue(current, overrides[k])
+		if err != nil {
+			return fmt.Errorf("%s: invalid %s: %w", tomlPath, k, err)
+		}
+		log.Debugf("%s: setting %s to %v", tomlPath, k, value)
+		t.SetPathWithComment(keyPath, "set by the node_config of the event", false, value)
+	}
+	s, err := t.ToTomlString()
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(tomlPath, []byte(s), info.Mode())
+}
+
+// tomlValue converts an override to the type of the current value of its key,
+// the overrides are decoded from YAML or JSON so numbers can be int or float64
+func tomlValue(current, value interface{}) (interface{}, error) {
+	switch current.(type) {
+	case int64:
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case uint64:
+			if v <= math.MaxInt64 {
+				return int64(v), nil
+			}
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		}
+		return nil, fmt.Errorf("expected an integer, got %v", value)
+	case float64:
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected a number, got %v", value)
+	case bool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected a boolean, got %v", value)
+	case string:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("expected a string, got %v", value)
+	case []interface{}:
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a list, got %v", value)
+		}
+		converted := make([]interface{}, len(list))
+		for i, e := range list {
+			switch v := e.(type) {
+			case int:
+				converted[i] = int64(v)
+			case float64:
+				if v == math.Trunc(v) {
+					converted[i] = int64(v)
+					continue
+				}
+				converted[i] = v
+			default:
+				converted[i] = v
+			}
+		}
+		return converted, nil
+	case *toml.Tree, []*toml.Tree:
+		return nil, fmt.Errorf("it is a table, set its keys instead")
+	}
+	return nil, fmt.Errorf("values of type %T cannot be overridden", current)
+}
@@ -0,0 +1,90 @@
+package lctrld
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigTOML = `
+[consensus]
+timeout_commit = "5s"
+create_empty_blocks = true
+
+[instrumentation]
+prometheus = false
+max_open_connections = 3
+
+[rpc]
+cors_allowed_origins = []
+`
+
+const testAppTOML = `
+minimum-gas-prices = ""
+pruning = "syncable"
+halt-height = 0
+`
+
+func TestApplyNodeConfig(t *testing.T) {
+	evt := model.NewEvent("drop", "owner@apeunit.com", "virtualbox", []model.GenesisAccount{
+		{Name: "alice", GenesisBalance: model.MustParseCoins("100stake"), Validator: true},
+		{Name: "bob", GenesisBalance: model.MustParseCoins("100stake"), Validator: true},
+	}, model.PayloadLocation{})
+	for _, name := range []string{"alice", "bob"} {
+		dir := t.TempDir()
+		require.Nil(t, os.MkdirAll(filepath.Join(dir, "config"), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "config", "config.toml"), []byte(testConfigTOML), 0644))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "config", "app.toml"), []byte(testAppTOML), 0644))
+		evt.Accounts[name].ConfigLocation.DaemonConfigDir = dir
+		evt.State[name] = &model.Machine{EventID: evt.ID()}
+	}
+	// the values are decoded from the event JSON, numbers are float64
+	evt.NodeConfig = &model.NodeConfig{
+		ConfigOverrides: model.ConfigOverrides{
+			Config: map[string]interface{}{
+				"consensus.timeout_commit":             "1s",
+				"instrumentation.prometheus":           true,
+				"instrumentation.max_open_connections": float64(10),
+				"rpc.cors_allowed_origins":             []interface{}{"*"},
+			},
+			App: map[string]interface{}{"pruning": "nothing"},
+		},
+		Nodes: map[string]model.ConfigOverrides{
+			"bob": {App: map[string]interface{}{"pruning": "everything", "halt-height": 100}},
+		},
+	}
+	require.Nil(t, ApplyNodeConfig(context.Background(), nil, evt, nil))
+
+	load := func(name, file string) *toml.Tree {
+		tree, err := toml.LoadFile(filepath.Join(evt.Accounts[name].ConfigLocation.DaemonConfigDir, "config", file))
+		require.Nil(t, err)
+		return tree
+	}
+	for _, name := range []string{"alice", "bob"} {
+		c := load(name, "config.toml")
+		assert.Equal(t, "1s", c.Get("consensus.timeout_commit"))
+		assert.Equal(t, true, c.Get("consensus.create_empty_blocks"))
+		assert.Equal(t, true, c.Get("instrumentation.prometheus"))
+		assert.Equal(t, int64(10), c.Get("instrumentation.max_open_connections"))
+		assert.Equal(t, []interface{}{"*"}, c.Get("rpc.cors_allowed_origins"))
+	}
+	assert.Equal(t, "nothing", load("alice", "app.toml").Get("pruning"))
+	assert.Equal(t, int64(0), load("alice", "app.toml").Get("halt-height"))
+	assert.Equal(t, "everything", load("bob", "app.toml").Get("pruning"))
+	assert.Equal(t, int64(100), load("bob", "app.toml").Get("halt-height"))
+
+	// the keys and the types are checked against the files
+	evt.NodeConfig = &model.NodeConfig{ConfigOverrides: model.ConfigOverrides{App: map[string]interface{}{"api.enable": true}}}
+	assert.Contains(t, ApplyNodeConfig(context.Background(), nil, evt, nil).Error(), "api.enable not found")
+	evt.NodeConfig = &model.NodeConfig{ConfigOverrides: model.ConfigOverrides{Config: map[string]interface{}{"instrumentation.prometheus": "yes"}}}
+	assert.Contains(t, ApplyNodeConfig(context.Background(), nil, evt, nil).Error(), "invalid instrumentation.prometheus: expected a boolean, got yes")
+	evt.NodeConfig = &model.NodeConfig{ConfigOverrides: model.ConfigOverrides{Config: map[string]interface{}{"consensus": "x"}}}
+	assert.Contains(t, ApplyNodeConfig(context.Background(), nil, evt, nil).Error(), "it is a table")
+}
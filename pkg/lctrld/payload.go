@@ -1,10 +1,12 @@
 package lctrld
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -13,76 +15,85 @@ import (
 	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
 	"github.com/apeunit/LaunchControlD/pkg/config"
 	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
 	"github.com/apeunit/LaunchControlD/pkg/utils"
 
-	"github.com/melbahja/got"
 	"github.com/pelletier/go-toml"
 	log "github.com/sirupsen/logrus"
 )
 
 // DownloadPayloadBinary downloads a copy of the payload binaries to the host
-// running lctrld to generate the config files for the provisioned machines
-func DownloadPayloadBinary(settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
-	_, cliExistsErr := os.Stat(evt.Payload.CLIPath)
-	_, daemonExistsErr := os.Stat(evt.Payload.DaemonPath)
-	if os.IsNotExist(cliExistsErr) || os.IsNotExist(daemonExistsErr) {
-		binFile := settings.Bin("payloadBinaries.zip")
-		log.Infof("downloading payload binaries from %s to %s", evt.Payload.BinaryURL, binFile)
-		g := got.New()
-		err = g.Download(evt.Payload.BinaryURL, binFile)
-		if err != nil {
-			return
-		}
+// running lctrld to generate the config files for the provisioned machines.
+// The binaries are kept in a cache shared by the events using the same
+// payload release, see resolvePayload.
+func DownloadPayloadBinary(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
+	return resolvePayload(ctx, settings, evt)
+}
 
-		_, err = runCommand([]string{"unzip", "-d", settings.Bin(""), "-o", binFile}, []string{})
-		if err != nil {
-			return
-		}
+// payloadProfile returns the payload profile of an event
+func payloadProfile(settings *config.Schema, evt *model.Event) (config.PayloadProfile, error) {
+	return settings.PayloadProfile(evt.Payload.Profile)
+}
 
-		err = os.Remove(binFile)
-		if err != nil {
-			return
-		}
+// profileArgs returns the payload profile template arguments common to all
+// the commands of an event
+func profileArgs(evt *model.Event) config.ProfileArgs {
+	return config.ProfileArgs{
+		Daemon:  evt.Payload.DaemonPath,
+		CLI:     evt.Payload.CLIPath,
+		ChainID: evt.ChainID(),
+		Symbol:  evt.TokenSymbol,
 	}
-	return nil
 }
 
 // InitDaemon runs gaiad init burnerchain --home
 // state.DaemonConfigDir
 // and gaiad tendermint show-node-id
-func InitDaemon(settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (*model.Event, error) {
+// for the node of every validator and for the other nodes of the event
+func InitDaemon(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (*model.Event, error) {
 	log.Infoln("Initializing daemon configs for each node")
 
 	envVars := utils.BuildEnvVars(settings)
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return nil, err
+	}
 
-	_, accounts := evt.Validators()
-	for _, acc := range accounts {
+	for _, name := range evt.NodeNames() {
 		// Make the config directory for the node CLI
-		machineConfig := evt.State[acc.Name]
-		if acc.Validator {
-			nodeConfigDir, err := settings.NodeConfigDir(evt.ID(), machineConfig.N)
-			if err != nil {
-				break
-			}
-			acc.ConfigLocation.DaemonConfigDir = path.Join(nodeConfigDir, "daemon")
-			acc.ConfigLocation.CLIConfigDir = path.Join(nodeConfigDir, "cli")
-		} else {
-			extraAccDir, err := settings.ExtraAccountConfigDir(evt.ID(), acc.Name)
-			if err != nil {
-				break
+		machineConfig := evt.State[name]
+		location := evt.NodeConfigLocation(name)
+		nodeConfigDir, err := settings.NodeConfigDir(evt.ID(), machineConfig.N)
+		if err != nil {
+			return nil, err
+		}
+		location.DaemonConfigDir = path.Join(nodeConfigDir, profile.DaemonHome)
+		location.CLIConfigDir = path.Join(nodeConfigDir, profile.CLIHome)
+		if evt.NodeRole(name) != model.RoleValidator {
+			// there are no keys for the other nodes, the CLI home is only
+			// used by the light client
+			if err = os.MkdirAll(location.CLIConfigDir, 0755); err != nil {
+				return nil, err
 			}
-			acc.ConfigLocation.CLIConfigDir = extraAccDir
 		}
 
-		command := []string{evt.Payload.DaemonPath, "init", fmt.Sprintf("%s node %s", acc.Name, machineConfig.ID()), "--home", acc.ConfigLocation.DaemonConfigDir, "--chain-id", evt.ID()}
-		out, err := runCommand(command, envVars)
+		args := profileArgs(evt)
+		args.Moniker = fmt.Sprintf("%s node %s", name, machineConfig.ID())
+		args.Home, args.CLIHome = location.DaemonConfigDir, location.CLIConfigDir
+		command, err := profile.Render(profile.Commands.Init, args)
+		if err != nil {
+			return nil, err
+		}
+		out, err := runCommand(ctx, command, envVars)
 		if err != nil {
 			log.Errorf("%s %s failed with %s, %s\n", evt.Payload.DaemonPath, command, err, out)
 			return nil, err
 		}
 
-		command = []string{evt.Payload.DaemonPath, "tendermint", "show-node-id", "--home", acc.ConfigLocation.DaemonConfigDir}
-		out, err = runCommand(command, envVars)
+		if command, err = profile.Render(profile.Commands.ShowNodeID, args); err != nil {
+			return nil, err
+		}
+		out, err = runCommand(ctx, command, envVars)
 		if err != nil {
 			log.Errorf("%s %s failed with %s, %s\n", evt.Payload.DaemonPath, command, err, out)
 			return nil, err
@@ -95,69 +106,117 @@ func InitDaemon(settings *config.Schema, evt *model.Event, runCommand cmdrunner.
 
 // GenerateKeys generates keys for each genesis account (this includes validator
 // accounts). The specific command is gaiacli keys add validatoremail/some other name -o json
-// --keyring-backend test --home.... for each node.
-func GenerateKeys(settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (*model.Event, error) {
+// --keyring-backend test --home.... for each node. Accounts with a mnemonic
+// are recovered with keys add --recover, external accounts have no keys.
+func GenerateKeys(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (*model.Event, error) {
 	log.Infoln("Generating keys for validator accounts")
 
 	envVars := utils.BuildEnvVars(settings)
 
 	_, validatorAccounts := evt.Validators()
 	for _, account := range validatorAccounts {
-		command := []string{evt.Payload.CLIPath, "keys", "add", account.Name, "-o", "json", "--keyring-backend", "test", "--home", account.ConfigLocation.CLIConfigDir}
-		out, err := runCommand(command, envVars)
-		if err != nil {
-			log.Errorf("%s %s failed with %s, %s\n", evt.Payload.CLIPath, command, err, out)
+		if err := addKey(ctx, settings, evt, account, account.ConfigLocation.CLIConfigDir, envVars, runCommand); err != nil {
 			return nil, err
 		}
-
-		var result map[string]interface{}
-		json.Unmarshal([]byte(out), &result)
-
-		account.Address = result["address"].(string)
-		account.Mnemonic = result["mnemonic"].(string)
-
-		log.Infof("%s -> %s\n", account.Name, account.Address)
 	}
 
 	log.Infoln("Generating keys for non-validator accounts")
 	for _, acc := range evt.ExtraAccounts() {
+		if acc.External {
+			log.Infof("%s -> %s (external)\n", acc.Name, acc.Address)
+			continue
+		}
 		extraAccDir, err2 := settings.ExtraAccountConfigDir(evt.ID(), acc.Name)
 		if err2 != nil {
 			return nil, err2
 		}
-
-		command := []string{evt.Payload.CLIPath, "keys", "add", acc.Name, "-o", "json", "--keyring-backend", "test", "--home", extraAccDir}
-		out, err := runCommand(command, envVars)
-		if err != nil {
-			log.Errorf("%s %s failed with %s, %s\n", evt.Payload.CLIPath, command, err, out)
+		if err := addKey(ctx, settings, evt, acc, extraAccDir, envVars, runCommand); err != nil {
 			return nil, err
 		}
-
-		var result map[string]interface{}
-		json.Unmarshal([]byte(out), &result)
-
-		acc.Address = result["address"].(string)
-		acc.Mnemonic = result["mnemonic"].(string)
 		acc.ConfigLocation.CLIConfigDir = extraAccDir
-
-		log.Infof("%s -> %s\n", acc.Name, acc.Address)
 	}
 	return evt, nil
 }
 
+// addKey adds the key of an account to the keyring in home, the key is
+// recovered from the account mnemonic if there is one, otherwise the new
+// key mnemonic is stored in the account. The mnemonic is decrypted only here,
+// it is sealed again when the event is stored.
+func addKey(ctx context.Context, settings *config.Schema, evt *model.Event, account *model.Account, home string, envVars []string, runCommand cmdrunner.CommandRunner) (err error) {
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return
+	}
+	args := profileArgs(evt)
+	args.Name, args.CLIHome = account.Name, home
+	if account.Mnemonic != "" {
+		keeper, err := secrets.FromSettings(settings)
+		if err != nil {
+			return err
+		}
+		mnemonic, err := keeper.Open(account.Mnemonic)
+		if err != nil {
+			return fmt.Errorf("cannot recover the key of %s: %w", account.Name, err)
+		}
+		// the mnemonic is read from the standard input, not to expose it
+		args.Recover = true
+		ctx = cmdrunner.WithStdin(ctx, mnemonic+"\n")
+	}
+	command, err := profile.Render(profile.Commands.KeysAdd, args)
+	if err != nil {
+		return
+	}
+	// the output has the mnemonic of the new key
+	out, err := runCommand(cmdrunner.WithSecretOutput(ctx), command, envVars)
+	if err != nil {
+		log.Errorf("%s failed with %s\n", command, err)
+		return
+	}
+
+	var result struct {
+		Address  string `json:"address"`
+		Mnemonic string `json:"mnemonic"`
+	}
+	if err = json.Unmarshal([]byte(out), &result); err != nil {
+		return fmt.Errorf("cannot read the key of %s: %w", account.Name, err)
+	}
+	account.Address = result.Address
+	if account.Mnemonic == "" {
+		account.Mnemonic = secrets.Secret(result.Mnemonic)
+	}
+
+	log.Infof("%s -> %s\n", account.Name, account.Address)
+	return
+}
+
 // AddGenesisAccounts runs gaiad add-genesis-account with the created addresses
 // and default initial balances
-func AddGenesisAccounts(settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
+func AddGenesisAccounts(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
 	log.Infoln("Adding accounts to the genesis.json files")
 
 	envVars := utils.BuildEnvVars(settings)
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return
+	}
 
-	for name := range evt.State {
+	// the other nodes get the genesis of the first validator in EditConfigs
+	v, _ := evt.Validators()
+	for _, name := range v {
 		for _, account := range evt.Accounts {
-			command := []string{evt.Payload.DaemonPath, "add-genesis-account", account.Address, account.GenesisBalance, "--home", evt.Accounts[name].ConfigLocation.DaemonConfigDir}
-			out, err := runCommand(command, envVars)
+			if account.Address == "" {
+				return fmt.Errorf("account %s has no address", account.Name)
+			}
+			args := profileArgs(evt)
+			args.Address, args.Coins = account.Address, account.GenesisBalance.String()
+			args.Home = evt.Accounts[name].ConfigLocation.DaemonConfigDir
+			command, err := profile.Render(profile.Commands.AddGenesisAccount, args)
 			if err != nil {
-				log.Errorf("%s %s failed with %s, %s\n", evt.Payload.DaemonPath, command, err, out)
+				return err
+			}
+			out, err := runCommand(ctx, command, envVars)
+			if err != nil {
+				log.Errorf("%s failed with %s, %s\n", command, err, out)
 				return err
 			}
 		}
@@ -167,11 +226,15 @@ func AddGenesisAccounts(settings *config.Schema, evt *model.Event, runCommand cm
 }
 
 // GenesisTxs runs gentx to turn accounts into validator accounts and outputs
-// the genesis transactions into a single folder.
-func GenesisTxs(settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
+// the genesis transactions into a single folder. The other nodes have none.
+func GenesisTxs(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
 	log.Infoln("Creating genesis transactions to turn accounts into validators")
 
 	envVars := utils.BuildEnvVars(settings)
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return
+	}
 	basePath, err := settings.ConfigDir(evt.ID())
 	if err != nil {
 		return
@@ -183,16 +246,22 @@ func GenesisTxs(settings *config.Schema, evt *model.Event, runCommand cmdrunner.
 		os.Mkdir(outputGenesisTxDir, 0755)
 	}
 
-	for email, state := range evt.State {
+	v, _ := evt.Validators()
+	for _, email := range v {
+		state := evt.State[email]
 		outputDocument := path.Join(outputGenesisTxDir, fmt.Sprintf("%s.json", state.ID()))
-		stakeAmount := strings.Split(evt.Accounts[email].GenesisBalance, ",")
 
-		// Here we assume that last part of genesis_balance is the # of stake tokens
 		// launchpayloadd gentx --name v1@email.com --amount 10000stake --home-client ... --keyring-backend test --home ... --output-document ...
-		command := []string{evt.Payload.DaemonPath, "gentx", "--name", email, "--ip", state.Instance.IPAddress, "--amount", stakeAmount[len(stakeAmount)-1], "--home-client", evt.Accounts[email].ConfigLocation.CLIConfigDir, "--keyring-backend", "test", "--home", evt.Accounts[email].ConfigLocation.DaemonConfigDir, "--output-document", outputDocument}
-		out, err := runCommand(command, envVars)
+		args := profileArgs(evt)
+		args.Name, args.IP, args.Amount, args.Output = email, state.Instance.IPAddress, evt.Accounts[email].Stake().String(), outputDocument
+		args.Home, args.CLIHome = evt.Accounts[email].ConfigLocation.DaemonConfigDir, evt.Accounts[email].ConfigLocation.CLIConfigDir
+		command, err := profile.Render(profile.Commands.Gentx, args)
 		if err != nil {
-			log.Errorf("%s %s failed with %s, %s\n", evt.Payload.DaemonPath, command, err, out)
+			return err
+		}
+		out, err := runCommand(ctx, command, envVars)
+		if err != nil {
+			log.Errorf("%s failed with %s, %s\n", command, err, out)
 			return err
 		}
 
@@ -203,10 +272,14 @@ func GenesisTxs(settings *config.Schema, evt *model.Event, runCommand cmdrunner.
 // CollectGenesisTxs is run on every node's config directory from the single
 // directory where the genesis transactions were placed before. In the end, only
 // the first node's genesis.json will be used.
-func CollectGenesisTxs(settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
+func CollectGenesisTxs(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
 	log.Infoln("Collecting genesis transactions and writing final genesis.json")
 
 	envVars := utils.BuildEnvVars(settings)
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return
+	}
 	basePath, err := settings.ConfigDir(evt.ID())
 	if err != nil {
 		return
@@ -214,33 +287,41 @@ func CollectGenesisTxs(settings *config.Schema, evt *model.Event, runCommand cmd
 	// Get the first validator/node and use it to generate the genesis.json with all gentxs.
 	// firstValidator := evt.Validators[0]
 
-	for name := range evt.State {
-		command := []string{evt.Payload.DaemonPath, "collect-gentxs", "--gentx-dir", path.Join(basePath, "genesis_txs"), "--home", evt.Accounts[name].ConfigLocation.DaemonConfigDir}
-		out, err := runCommand(command, envVars)
+	v, _ := evt.Validators()
+	for _, name := range v {
+		args := profileArgs(evt)
+		args.GentxDir, args.Home = path.Join(basePath, "genesis_txs"), evt.Accounts[name].ConfigLocation.DaemonConfigDir
+		command, err := profile.Render(profile.Commands.CollectGentxs, args)
 		if err != nil {
-			log.Errorf("%s %s failed with %s, %s\n", evt.Payload.DaemonPath, command, err, out)
+			return err
+		}
+		out, err := runCommand(ctx, command, envVars)
+		if err != nil {
+			log.Errorf("%s failed with %s, %s\n", command, err, out)
 			return err
 		}
 	}
 	return
 }
 
-// EditConfigs edits the config.toml of every node to have the same persistent_peers.
-func EditConfigs(settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
+// EditConfigs copies the genesis.json of the first validator to the other
+// nodes and edits the p2p section of the config.toml of every node to match
+// its role, see peerTopology.
+func EditConfigs(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
 	log.Infoln("Copying node 0's genesis.json to others and setting up p2p.persistent_peers")
 
-	// Although we just generated the genesis.json for every node (makes it
-	// easy to debug things) we only need one. Copy node 0's genesis.json to
+	// Although we just generated the genesis.json for every validator (makes
+	// it easy to debug things) we only need one. Copy node 0's genesis.json to
 	// other node folders.
-	_, valAccounts := evt.Validators()
-	pathToNode0Genesis := path.Join(valAccounts[0].ConfigLocation.DaemonConfigDir, "config/genesis.json")
-	for _, valAcc := range valAccounts[1:] {
+	nodes := evt.NodeNames()
+	pathToNode0Genesis := path.Join(evt.NodeConfigLocation(nodes[0]).DaemonConfigDir, "config/genesis.json")
+	for _, name := range nodes[1:] {
 		node0Genesis, err := os.Open(pathToNode0Genesis)
 		if err != nil {
 			log.Errorf("cannot open file genesis descriptor: %s: %v", pathToNode0Genesis, err)
 			return err
 		}
-		otherGenesis := path.Join(valAcc.ConfigLocation.DaemonConfigDir, "config/genesis.json")
+		otherGenesis := path.Join(evt.NodeConfigLocation(name).DaemonConfigDir, "config/genesis.json")
 		log.Infof("otherGenesis: %s\n", otherGenesis)
 		err = os.Remove(otherGenesis)
 		if err != nil {
@@ -262,25 +343,31 @@ func EditConfigs(settings *config.Schema, evt *model.Event, runCommand cmdrunner
 		log.Debugf("Copied %v bytes to %s", written, otherGenesis)
 	}
 
-	// Build the persistent peer list.
-	persistentPeerList := []string{}
-	for email, state := range evt.State {
-		fmt.Printf("%s's node is %s \n", email, state.TendermintPeerNodeID())
-		persistentPeerList = append(persistentPeerList, state.TendermintPeerNodeID())
+	for _, name := range nodes {
+		log.Infof("%s's %s node is %s", name, evt.NodeRole(name), evt.State[name].TendermintPeerNodeID())
 	}
 
-	// Insert the persistent peer list into each node's config.toml
+	// Insert the peers into each node's config.toml
 	// Don't create blocks if there are no txs (to save space when chain is idle)
-	for name := range evt.State {
-		configPath := path.Join(evt.Accounts[name].ConfigLocation.DaemonConfigDir, "config/config.toml")
+	for name, p2p := range peerTopology(evt) {
+		configPath := path.Join(evt.NodeConfigLocation(name).DaemonConfigDir, "config/config.toml")
 		t, err := toml.LoadFile(configPath)
 		if err != nil {
 			log.Errorf("Reading toml from file %s failed with %s", configPath, err)
 			return err
 		}
-		t.SetPathWithComment([]string{"p2p", "persistent_peers"}, "persistent_peers has been automatically set by lctrld", false, strings.Join(persistentPeerList, ","))
+		t.SetPathWithComment([]string{"p2p", "persistent_peers"}, "persistent_peers has been automatically set by lctrld", false, strings.Join(p2p.PersistentPeers, ","))
+		t.SetPathWithComment([]string{"p2p", "seeds"}, "seeds has been automatically set by lctrld", false, strings.Join(p2p.Seeds, ","))
+		t.SetPathWithComment([]string{"p2p", "pex"}, "pex has been automatically set by lctrld", false, p2p.PEX)
+		t.SetPathWithComment([]string{"p2p", "private_peer_ids"}, "private_peer_ids has been automatically set by lctrld", false, strings.Join(p2p.PrivatePeerIDs, ","))
+		t.SetPathWithComment([]string{"p2p", "seed_mode"}, "seed_mode has been automatically set by lctrld", false, p2p.SeedMode)
 		t.SetPathWithComment([]string{"rpc", "laddr"}, "laddr has been automatically set by lctrld", false, "tcp://0.0.0.0:26657")
 		t.SetPathWithComment([]string{"consensus", "create_empty_blocks"}, "Don't create blocks if there are no txs: automatically set by lctrld", false, false)
+		if p := plannerFrom(ctx); p != nil {
+			for _, k := range []string{"p2p.persistent_peers", "p2p.seeds", "p2p.pex", "p2p.private_peer_ids", "p2p.seed_mode", "rpc.laddr", "consensus.create_empty_blocks"} {
+				p.edit(name, configPath, k, t.Get(k))
+			}
+		}
 
 		w, err := os.Create(configPath)
 		if err != nil {
@@ -297,7 +384,7 @@ func EditConfigs(settings *config.Schema, evt *model.Event, runCommand cmdrunner
 }
 
 // GenerateFaucetConfig generates a configuration for the faucet given what it knows about the event
-func GenerateFaucetConfig(settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
+func GenerateFaucetConfig(ctx context.Context, settings *config.Schema, evt *model.Event, runCommand cmdrunner.CommandRunner) (err error) {
 	log.Infoln("Generating faucet configuration")
 
 	// Use the first ExtraAccount as a faucet account
@@ -305,10 +392,18 @@ func GenerateFaucetConfig(settings *config.Schema, evt *model.Event, runCommand
 	if faucetAccount == nil {
 		return errors.New("at this stage we expect every blockchain deployment to have a Faucet account")
 	}
-	// The faucet should connect to one of the validator nodes
-	v, _ := evt.Validators()
-	nodeIP := evt.State[v[0]].Instance.IPAddress
-	out, err := runCommand([]string{"docker", "pull", evt.Payload.DockerImage}, []string{})
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return
+	}
+	// The faucet connects to the node it runs on
+	args := profileArgs(evt)
+	args.Address, args.IP = faucetAccount.Address, evt.State[evt.ServicesNode()].Instance.IPAddress
+	entrypoint, err := profile.Render(profile.Entrypoints.FaucetConfig, args)
+	if err != nil {
+		return
+	}
+	out, err := runCommand(ctx, []string{"docker", "pull", evt.Payload.DockerImage}, []string{})
 	if err != nil {
 		return
 	}
@@ -322,66 +417,232 @@ func GenerateFaucetConfig(settings *config.Schema, evt *model.Event, runCommand
 	// docker image permissions problems again - faucet cannot write to mounted volume
 	os.Chmod(filepath.Join(evtsDir, "nodeconfig"), 0777)
 
-	command := []string{"docker", "run", "-v", fmt.Sprintf("%s:/payload/config", filepath.Join(evtsDir, "nodeconfig")), evt.Payload.DockerImage, "/payload/configurefaucet.sh", evt.ID(), faucetAccount.Address, evt.TokenSymbol, nodeIP}
-	out, err = runCommand(command, []string{})
+	command := append([]string{"docker", "run", "-v", fmt.Sprintf("%s:/payload/config", filepath.Join(evtsDir, "nodeconfig")), evt.Payload.DockerImage}, entrypoint...)
+	out, err = runCommand(ctx, command, []string{})
 	log.Debugln(out)
 	return
 }
 
-func configurePayload(settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
-	err = DownloadPayloadBinary(settings, evt, cmdRunner)
-	if err != nil {
+// payloadStep is a step of the payload configuration pipeline
+type payloadStep struct {
+	Name string
+	Run  func(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) error
+}
+
+// payloadSteps are the steps to configure a payload, in the order they are run
+var payloadSteps = []payloadStep{
+	{Name: "download", Run: DownloadPayloadBinary},
+	{Name: "init", Run: func(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
+		if _, err = InitDaemon(ctx, settings, evt, cmdRunner); err != nil {
+			return
+		}
+		return saveInitGenesis(settings, evt)
+	}},
+	{Name: "keys", Run: func(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
+		_, err = GenerateKeys(ctx, settings, evt, cmdRunner)
 		return
+	}},
+	{Name: "genesis-accounts", Run: AddGenesisAccounts},
+	{Name: "gentxs", Run: GenesisTxs},
+	{Name: "collect-gentxs", Run: CollectGenesisTxs},
+	{Name: "genesis-params", Run: SetGenesisParams},
+	{Name: "edit-configs", Run: EditConfigs},
+	{Name: "node-config", Run: ApplyNodeConfig},
+	{Name: "verify-genesis", Run: verifyGenesisStep},
+	{Name: "faucet-config", Run: GenerateFaucetConfig},
+}
+
+// PayloadSteps returns the names of the payload configuration steps, in the
+// order they are run
+func PayloadSteps() (names []string) {
+	for _, s := range payloadSteps {
+		names = append(names, s.Name)
 	}
-	evt, err = InitDaemon(settings, evt, cmdRunner)
-	if err != nil {
-		return
+	return
+}
+
+// payloadStepIndex returns the position of a step in the pipeline
+func payloadStepIndex(name string) (int, error) {
+	for i, s := range payloadSteps {
+		if s.Name == name {
+			return i, nil
+		}
 	}
-	err = StoreEvent(settings, evt)
+	return 0, fmt.Errorf("unknown payload step %s, valid steps are: %s", name, strings.Join(PayloadSteps(), ", "))
+}
+
+// configurePayload runs the pipeline starting from the step at position from,
+// recording each completed step in the event descriptor
+func configurePayload(ctx context.Context, settings *config.Schema, evt *model.Event, from int, cmdRunner cmdrunner.CommandRunner) (err error) {
+	// the steps being rerun are not completed anymore
+	evt.PayloadSteps = PayloadSteps()[:from]
+	if err = restoreStepInputs(settings, evt, from); err != nil {
+		return fmt.Errorf("cannot restore the configuration for step %s: %w", payloadSteps[from].Name, err)
+	}
+	for _, s := range payloadSteps[from:] {
+		log.Infof("Running payload step %s", s.Name)
+		if err = s.Run(cmdrunner.WithStep(ctx, s.Name), settings, evt, cmdRunner); err != nil {
+			return fmt.Errorf("payload step %s failed: %w", s.Name, err)
+		}
+		evt.PayloadSteps = append(evt.PayloadSteps, s.Name)
+		if err = StoreEvent(settings, evt); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// initGenesisDir returns the folder with the genesis.json of the validators
+// as written by the daemon init
+func initGenesisDir(settings *config.Schema, evt *model.Event) (string, error) {
+	basePath, err := settings.ConfigDir(evt.ID())
 	if err != nil {
-		return
+		return "", err
 	}
-	evt, err = GenerateKeys(settings, evt, cmdRunner)
+	return path.Join(basePath, "genesis_init"), nil
+}
+
+// saveInitGenesis keeps a copy of the genesis.json of the validators written
+// by the daemon init, the genesis accounts are added again to it when the
+// pipeline is resumed
+func saveInitGenesis(settings *config.Schema, evt *model.Event) (err error) {
+	dir, err := initGenesisDir(settings, evt)
 	if err != nil {
 		return
 	}
-	err = StoreEvent(settings, evt)
-	if err != nil {
+	if err = os.MkdirAll(dir, 0700); err != nil {
 		return
 	}
-	err = AddGenesisAccounts(settings, evt, cmdRunner)
-	if err != nil {
+	v, _ := evt.Validators()
+	for _, name := range v {
+		genesisPath := path.Join(evt.Accounts[name].ConfigLocation.DaemonConfigDir, "config/genesis.json")
+		if err = copyFile(genesisPath, path.Join(dir, evt.State[name].ID()+".json")); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// restoreStepInputs undoes what the steps that run again have done, since the
+// keys and the genesis accounts cannot be added twice: the daemon init starts
+// from an empty configuration folder, the keys from empty keyrings and the
+// genesis accounts from the genesis.json written by the daemon init
+func restoreStepInputs(settings *config.Schema, evt *model.Event, from int) (err error) {
+	if from >= len(payloadSteps) {
 		return
 	}
-	err = GenesisTxs(settings, evt, cmdRunner)
+	nodeconfigPath, err := settings.ConfigDir(evt.ID())
 	if err != nil {
 		return
 	}
-	err = CollectGenesisTxs(settings, evt, cmdRunner)
+	init, _ := payloadStepIndex("init")
+	keys, _ := payloadStepIndex("keys")
+	genesisAccounts, _ := payloadStepIndex("genesis-accounts")
+	if from <= init {
+		return os.RemoveAll(nodeconfigPath)
+	}
+	v, validators := evt.Validators()
+	if from <= keys {
+		var homes []string
+		for _, acc := range validators {
+			homes = append(homes, acc.ConfigLocation.CLIConfigDir)
+		}
+		for _, acc := range evt.ExtraAccounts() {
+			if !acc.External {
+				dir, err := settings.ExtraAccountConfigDir(evt.ID(), acc.Name)
+				if err != nil {
+					return err
+				}
+				homes = append(homes, dir)
+			}
+		}
+		for _, home := range homes {
+			if home == "" {
+				continue
+			}
+			keyrings, err := filepath.Glob(path.Join(home, "keyring-*"))
+			if err != nil {
+				return err
+			}
+			for _, k := range keyrings {
+				log.Debugf("removing the keyring %s", k)
+				if err = os.RemoveAll(k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if from <= genesisAccounts {
+		dir, err := initGenesisDir(settings, evt)
+		if err != nil {
+			return err
+		}
+		for _, name := range v {
+			saved := path.Join(dir, evt.State[name].ID()+".json")
+			if !utils.FileExists(saved) {
+				return fmt.Errorf("the genesis.json written by init for %s is missing, resume from the init step", name)
+			}
+			if err = copyFile(saved, path.Join(evt.Accounts[name].ConfigLocation.DaemonConfigDir, "config/genesis.json")); err != nil {
+				return err
+			}
+		}
+	}
+	return
+}
+
+// copyFile copies a file, the copy is readable only by the owner
+func copyFile(src, dst string) (err error) {
+	data, err := ioutil.ReadFile(src)
 	if err != nil {
 		return
 	}
-	err = EditConfigs(settings, evt, cmdRunner)
-	if err != nil {
+	return ioutil.WriteFile(dst, data, 0600)
+}
+
+// runConfigurePayload runs the pipeline from a step, taking care of the event lifecycle
+func runConfigurePayload(ctx context.Context, settings *config.Schema, evt *model.Event, from int, cmdRunner cmdrunner.CommandRunner) (err error) {
+	if err = evt.CanTransition(model.StatusConfigured); err != nil {
 		return
 	}
-	err = GenerateFaucetConfig(settings, evt, cmdRunner)
-	if err != nil {
+	cmdRunner = journalRunner(settings, evt, cmdRunner)
+	// the configuration is kept on failure, so the pipeline can be resumed
+	if err = configurePayload(ctx, settings, evt, from, cmdRunner); err != nil {
+		return failEvent(settings, evt, err)
+	}
+	if err = evt.Transition(model.StatusConfigured, ""); err != nil {
 		return
 	}
-	return
+	return StoreEvent(settings, evt)
 }
 
 // ConfigurePayload is a wrapper function that runs all the needed steps to
 // generate a payload's configuration and fills out the evt object with said information.
-func ConfigurePayload(settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
-	nodeconfigPath, err := settings.ConfigDir(evt.ID())
+func ConfigurePayload(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) (err error) {
+	return runConfigurePayload(ctx, settings, evt, 0, cmdRunner)
+}
+
+// ResumeConfigurePayload continues the payload configuration of an event. If
+// fromStep is empty it continues from the first step that was not completed,
+// otherwise the named step and the ones following it are run again.
+func ResumeConfigurePayload(ctx context.Context, settings *config.Schema, evt *model.Event, fromStep string, cmdRunner cmdrunner.CommandRunner) (err error) {
+	from, err := resumeStep(evt, fromStep)
 	if err != nil {
 		return
 	}
-	err = configurePayload(settings, evt, cmdRunner)
-	if err != nil {
-		os.RemoveAll(nodeconfigPath)
+	return runConfigurePayload(ctx, settings, evt, from, cmdRunner)
+}
+
+// resumeStep returns the position of the step the payload configuration
+// resumes from, see ResumeConfigurePayload
+func resumeStep(evt *model.Event, fromStep string) (from int, err error) {
+	if fromStep != "" {
+		return payloadStepIndex(fromStep)
+	}
+	for from < len(payloadSteps) && from < len(evt.PayloadSteps) && evt.PayloadSteps[from] == payloadSteps[from].Name {
+		from++
+	}
+	if from < len(payloadSteps) {
+		log.Infof("Resuming the payload configuration from step %s", payloadSteps[from].Name)
 	}
 	return
 }
@@ -0,0 +1,50 @@
+package lctrld
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKeysRecover(t *testing.T) {
+	settings := &config.Schema{Workspace: t.TempDir()}
+	mnemonic := strings.TrimSpace(strings.Repeat("abandon ", 11)) + " about"
+	evt := model.NewEvent("drop", "owner@apeunit.com", "virtualbox", []model.GenesisAccount{
+		{Name: "alice", GenesisBalance: model.MustParseCoins("100stake"), Validator: true, Mnemonic: secrets.Secret(mnemonic)},
+		{Name: "bob", GenesisBalance: model.MustParseCoins("100stake"), Validator: true},
+		{Name: "sponsor", GenesisBalance: model.MustParseCoins("100drop"), Address: "cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0p"},
+	}, model.PayloadLocation{CLIPath: "launchpayloadcli"})
+
+	var commands []string
+	runner := func(ctx context.Context, command, envVars []string) (string, error) {
+		commands = append(commands, strings.Join(command, " "))
+		stdin, recovered := cmdrunner.StdinFrom(ctx)
+		if recovered {
+			// the recovered mnemonic is not printed
+			assert.Equal(t, mnemonic+"\n", stdin)
+			return fmt.Sprintf(`{"name":"%s","address":"cosmos1recovered"}`, command[3]), nil
+		}
+		return fmt.Sprintf(`{"name":"%s","address":"cosmos1new","mnemonic":"new words"}`, command[3]), nil
+	}
+	_, err := GenerateKeys(context.Background(), settings, evt, runner)
+	require.Nil(t, err)
+
+	require.Len(t, commands, 2)
+	assert.True(t, strings.HasSuffix(commands[0], "--recover"))
+	assert.NotContains(t, commands[0], "abandon")
+	assert.Equal(t, "cosmos1recovered", evt.Accounts["alice"].Address)
+	assert.Equal(t, secrets.Secret(mnemonic), evt.Accounts["alice"].Mnemonic)
+	assert.Equal(t, "cosmos1new", evt.Accounts["bob"].Address)
+	assert.Equal(t, secrets.Secret("new words"), evt.Accounts["bob"].Mnemonic)
+	// external accounts keep their address and have no keys
+	assert.Equal(t, "cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0p", evt.Accounts["sponsor"].Address)
+	assert.Empty(t, evt.Accounts["sponsor"].ConfigLocation.CLIConfigDir)
+}
@@ -0,0 +1,312 @@
+package lctrld
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// record runs the pipeline tests against the real infrastructure and
+// overwrites their cassettes, e.g.
+// go test ./pkg/lctrld -run TestPipeline -record
+// the payload binaries are taken from the default payload location
+var record = flag.Bool("record", false, "record the cassettes running the real commands")
+
+// recordRunner is the runner used when recording the cassettes
+var recordRunner cmdrunner.CommandRunner = cmdrunner.RunCommand
+
+// cassetteRunner returns a runner that replays the named cassette from
+// testdata/cassettes, or records it when the tests run with -record. The
+// returned function must be called once the test is done.
+func cassetteRunner(t *testing.T, settings *config.Schema, name string) (runner cmdrunner.CommandRunner, done func()) {
+	cassette := filepath.Join("testdata", "cassettes", name+".json")
+	replacements := map[string]string{
+		"$WORKSPACE": settings.Workspace,
+		"$PATH":      os.Getenv("PATH"),
+	}
+	if *record {
+		r := cmdrunner.NewRecorder(recordRunner, settings.Workspace, replacements)
+		return r.Run, func() {
+			require.Nil(t, r.Save(cassette))
+		}
+	}
+	r, err := cmdrunner.NewReplayer(cassette, settings.Workspace, replacements)
+	require.Nil(t, err)
+	return r.Run, func() {
+		assert.Empty(t, r.Unused(), "recorded commands have not been run")
+	}
+}
+
+// installPayloadBinaries puts the payload binaries in the payload cache so
+// they are not downloaded, when replaying the binaries are never run and
+// empty files are enough
+func installPayloadBinaries(t *testing.T, settings *config.Schema) (payload model.PayloadLocation) {
+	payload = model.NewDefaultPayloadLocation()
+	entry := &CachedPayload{
+		Key:       payloadCacheKey(strings.Repeat("0", 64)),
+		URL:       payload.BinaryURL,
+		Version:   payload.Version,
+		Binaries:  make(map[string]string),
+		CreatedOn: time.Now(),
+	}
+	require.Nil(t, os.MkdirAll(entry.Dir(settings), 0755))
+	for _, from := range []string{payload.DaemonPath, payload.CLIPath} {
+		var data []byte
+		if *record {
+			var err error
+			data, err = ioutil.ReadFile(from)
+			require.Nil(t, err)
+		}
+		to := filepath.Join(entry.Dir(settings), filepath.Base(from))
+		require.Nil(t, ioutil.WriteFile(to, data, 0755))
+		sum, err := utils.SHA256File(to)
+		require.Nil(t, err)
+		entry.Binaries[filepath.Base(from)] = sum
+	}
+	require.Nil(t, utils.StoreJSON(filepath.Join(entry.Dir(settings), PayloadCacheManifest), entry))
+	return
+}
+
+func TestPipeline(t *testing.T) {
+	settings := &config.Schema{
+		Workspace: t.TempDir(),
+		DockerMachine: config.DockerMachine{
+			Binary: "docker-machine",
+		},
+		Provisioning: config.Provisioning{Workers: 1},
+	}
+	require.Nil(t, SetupWorkspace(settings))
+	payload := installPayloadBinaries(t, settings)
+
+	req, err := model.LoadEventRequestFromFile("../../examples/simple_event_w_faucet.yml")
+	require.Nil(t, err)
+	evt := model.NewEvent(req.TokenSymbol, req.Owner, "virtualbox", req.GenesisAccounts, payload)
+	require.Nil(t, CreateEvent(settings, evt))
+
+	runner, done := cassetteRunner(t, settings, "pipeline")
+	defer done()
+	ctx := context.Background()
+
+	require.Nil(t, ProvisionEvent(ctx, settings, evt, runner))
+	assert.Len(t, evt.State, 2)
+	for _, m := range evt.State {
+		assert.NotEmpty(t, m.Instance.IPAddress)
+	}
+
+	require.Nil(t, ConfigurePayload(ctx, settings, evt, runner))
+	assert.Equal(t, PayloadSteps(), evt.PayloadSteps)
+	for _, acc := range evt.Accounts {
+		assert.NotEmpty(t, acc.Address)
+	}
+	for _, m := range evt.State {
+		assert.NotEmpty(t, m.TendermintNodeID)
+	}
+	evtDir, err := settings.Evts(evt.ID())
+	require.Nil(t, err)
+	assert.FileExists(t, filepath.Join(evtDir, "nodeconfig", "faucetconfig.yml"))
+
+	require.Nil(t, DeployPayload(ctx, settings, evt, runner))
+	assert.Equal(t, model.StatusDeployed, evt.CurrentStatus())
+
+	stored, err := LoadEvent(settings, evt.ID())
+	require.Nil(t, err)
+	assert.Equal(t, model.StatusDeployed, stored.CurrentStatus())
+
+	// every command has been journaled, with its step
+	journal, err := EventJournal(settings, evt.ID())
+	require.Nil(t, err)
+	steps := make(map[string]bool)
+	for _, e := range journal {
+		steps[e.Step] = true
+		if e.Step == "deploy" {
+			assert.NotEmpty(t, e.Machine)
+		}
+		// the mnemonics of the new keys are never journaled
+		assert.NotContains(t, e.Output, "mnemonic")
+		if e.Step == "keys" {
+			assert.True(t, e.SecretOutput)
+		}
+	}
+	for _, s := range []string{"provision", "init", "keys", "gentxs", "deploy"} {
+		assert.True(t, steps[s], s)
+	}
+}
+
+// newPipelineEvent creates an event of the workspace for the pipeline tests,
+// running the payload with a payload profile
+func newPipelineEvent(t *testing.T, profile string) (settings *config.Schema, evt *model.Event) {
+	settings = &config.Schema{
+		Workspace: t.TempDir(),
+		DockerMachine: config.DockerMachine{
+			Binary: "docker-machine",
+		},
+		Provisioning: config.Provisioning{Workers: 1},
+	}
+	require.Nil(t, SetupWorkspace(settings))
+	payload := installPayloadBinaries(t, settings)
+	payload.Profile = profile
+	req, err := model.LoadEventRequestFromFile("../../examples/simple_event_w_faucet.yml")
+	require.Nil(t, err)
+	evt = model.NewEvent(req.TokenSymbol, req.Owner, "virtualbox", req.GenesisAccounts, payload)
+	require.Nil(t, CreateEvent(settings, evt))
+	return
+}
+
+// failingRunner fails the nth command matching the subcommand without
+// running it, the other commands are run by runner
+func failingRunner(runner cmdrunner.CommandRunner, subcommand []string, n int) cmdrunner.CommandRunner {
+	var mu sync.Mutex
+	return func(ctx context.Context, command, envVars []string) (string, error) {
+		if len(command) > len(subcommand) && reflect.DeepEqual(command[1:len(subcommand)+1], subcommand) {
+			mu.Lock()
+			n--
+			failed := n == 0
+			mu.Unlock()
+			if failed {
+				return "", &cmdrunner.CommandError{Command: command, ExitCode: 1, Stderr: "killed"}
+			}
+		}
+		return runner(ctx, command, envVars)
+	}
+}
+
+// genesisAccounts returns the addresses of the accounts in a genesis.json
+func genesisAccounts(t *testing.T, genesisPath string) (addresses []string) {
+	var genesis struct {
+		AppState struct {
+			Auth struct {
+				Accounts []struct {
+					Value struct {
+						Address string `json:"address"`
+					} `json:"value"`
+				} `json:"accounts"`
+			} `json:"auth"`
+		} `json:"app_state"`
+	}
+	require.Nil(t, utils.LoadJSON(genesisPath, &genesis))
+	for _, a := range genesis.AppState.Auth.Accounts {
+		addresses = append(addresses, a.Value.Address)
+	}
+	return
+}
+
+func TestPipelineResume(t *testing.T) {
+	settings, evt := newPipelineEvent(t, config.ProfileLegacy)
+	runner, done := cassetteRunner(t, settings, "pipeline_resume")
+	defer done()
+	ctx := context.Background()
+	require.Nil(t, ProvisionEvent(ctx, settings, evt, runner))
+
+	// the second key fails after the first one has been added
+	err := ConfigurePayload(ctx, settings, evt, failingRunner(runner, []string{"keys", "add"}, 2))
+	require.NotNil(t, err)
+	assert.Equal(t, []string{"download", "init"}, evt.PayloadSteps)
+	assert.Equal(t, model.StatusFailed, evt.CurrentStatus())
+	nodeconfig, err := settings.ConfigDir(evt.ID())
+	require.Nil(t, err)
+	keys, err := filepath.Glob(filepath.Join(nodeconfig, "*", "cli", "keyring-test", "*.info"))
+	require.Nil(t, err)
+	assert.Len(t, keys, 1)
+
+	// the keys step runs again from empty keyrings
+	require.Nil(t, ResumeConfigurePayload(ctx, settings, evt, "", runner))
+	assert.Equal(t, PayloadSteps(), evt.PayloadSteps)
+	assert.Equal(t, model.StatusConfigured, evt.CurrentStatus())
+	_, validators := evt.Validators()
+	assert.Len(t, genesisAccounts(t, filepath.Join(validators[0].ConfigLocation.DaemonConfigDir, "config", "genesis.json")), len(evt.Accounts))
+	assert.Nil(t, VerifyGenesis(settings, evt))
+}
+
+func TestPipelineFromStep(t *testing.T) {
+	settings, evt := newPipelineEvent(t, config.ProfileLegacy)
+	runner, done := cassetteRunner(t, settings, "pipeline_from_step")
+	defer done()
+	ctx := context.Background()
+	require.Nil(t, ProvisionEvent(ctx, settings, evt, runner))
+	require.Nil(t, ConfigurePayload(ctx, settings, evt, runner))
+	addresses := make(map[string]string)
+	for name, acc := range evt.Accounts {
+		addresses[name] = acc.Address
+	}
+	_, validators := evt.Validators()
+	stale := filepath.Join(validators[0].ConfigLocation.CLIConfigDir, "keyring-test", "stale.info")
+	require.Nil(t, ioutil.WriteFile(stale, []byte("stale"), 0600))
+
+	// the genesis accounts are added again to the genesis written by init
+	checked := false
+	checking := func(ctx context.Context, command, envVars []string) (string, error) {
+		if len(command) > 1 && command[1] == "add-genesis-account" && !checked {
+			checked = true
+			assert.Empty(t, genesisAccounts(t, filepath.Join(argValue(command, "--home"), "config", "genesis.json")))
+		}
+		return runner(ctx, command, envVars)
+	}
+	require.Nil(t, ResumeConfigurePayload(ctx, settings, evt, "keys", checking))
+	assert.True(t, checked)
+	assert.Equal(t, PayloadSteps(), evt.PayloadSteps)
+	assert.NoFileExists(t, stale)
+	// the keys are recovered from the mnemonics of the first run
+	for name, acc := range evt.Accounts {
+		assert.Equal(t, addresses[name], acc.Address, name)
+	}
+	assert.Len(t, genesisAccounts(t, filepath.Join(validators[0].ConfigLocation.DaemonConfigDir, "config", "genesis.json")), len(evt.Accounts))
+	assert.Nil(t, VerifyGenesis(settings, evt))
+}
+
+func TestPipelineStargate(t *testing.T) {
+	settings, evt := newPipelineEvent(t, config.ProfileStargate)
+	evt.GenesisParams = &model.GenesisParams{UnbondingTime: "10m"}
+	runner, done := cassetteRunner(t, settings, "pipeline_stargate")
+	defer done()
+	ctx := context.Background()
+	require.Nil(t, ProvisionEvent(ctx, settings, evt, runner))
+
+	require.Nil(t, ConfigurePayload(ctx, settings, evt, runner))
+	assert.Equal(t, PayloadSteps(), evt.PayloadSteps)
+	_, validators := evt.Validators()
+	for _, acc := range validators {
+		assert.Equal(t, acc.ConfigLocation.DaemonConfigDir, acc.ConfigLocation.CLIConfigDir)
+	}
+	var genesis struct {
+		AppState struct {
+			Bank struct {
+				Balances []interface{} `json:"balances"`
+			} `json:"bank"`
+			Staking struct {
+				Params struct {
+					UnbondingTime string `json:"unbonding_time"`
+				} `json:"params"`
+			} `json:"staking"`
+		} `json:"app_state"`
+	}
+	require.Nil(t, utils.LoadJSON(filepath.Join(validators[0].ConfigLocation.DaemonConfigDir, "config", "genesis.json"), &genesis))
+	assert.Len(t, genesis.AppState.Bank.Balances, len(evt.Accounts))
+	assert.Equal(t, "600s", genesis.AppState.Staking.Params.UnbondingTime)
+	assert.Nil(t, VerifyGenesis(settings, evt))
+
+	require.Nil(t, DeployPayload(ctx, settings, evt, runner))
+	assert.Equal(t, model.StatusDeployed, evt.CurrentStatus())
+
+	// the keys are added by the daemon, the payload has a single binary
+	journal, err := EventJournal(settings, evt.ID())
+	require.Nil(t, err)
+	for _, e := range journal {
+		if e.Step == "keys" {
+			assert.Equal(t, "launchpayloadd", filepath.Base(e.Command[0]))
+		}
+	}
+}
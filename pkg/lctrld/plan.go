@@ -0,0 +1,547 @@
+package lctrld
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+)
+
+// Plan describes what an operation on an event is going to do
+type Plan struct {
+	Operation       string            `json:"operation"`
+	EventID         string            `json:"event_id"`
+	Provider        string            `json:"provider"`
+	Machines        []PlannedMachine  `json:"machines"`
+	GenesisAccounts []PlannedAccount  `json:"genesis_accounts"`
+	Ports           []PlannedPort     `json:"ports"`
+	Downloads       []PlannedDownload `json:"downloads"`
+	Copies          []PlannedCopy     `json:"copies"`
+	ConfigEdits     []PlannedEdit     `json:"config_edits"`
+	Checks          []string          `json:"checks"`
+	Commands        []PlannedCommand  `json:"commands"`
+}
+
+// PlannedMachine is a machine of the event
+type PlannedMachine struct {
+	Name      string         `json:"name"`
+	Account   string         `json:"account"`
+	Role      model.NodeRole `json:"role"`
+	IPAddress string         `json:"ip_address"`
+}
+
+// PlannedAccount is an account in the genesis of the event
+type PlannedAccount struct {
+	Name      string `json:"name"`
+	Balance   string `json:"balance"`
+	Validator bool   `json:"validator"`
+	Faucet    bool   `json:"faucet"`
+	Stake     string `json:"stake,omitempty"`
+}
+
+// PlannedPort is a port published by a container, the machine is empty for
+// the containers run on the lctrld host
+type PlannedPort struct {
+	Machine       string `json:"machine"`
+	Image         string `json:"image"`
+	HostPort      string `json:"host_port"`
+	ContainerPort string `json:"container_port"`
+}
+
+// PlannedDownload is a file downloaded to the lctrld host
+type PlannedDownload struct {
+	URL         string `json:"url"`
+	Destination string `json:"destination"`
+}
+
+// PlannedCopy is a path copied from the lctrld host to a machine
+type PlannedCopy struct {
+	Machine     string `json:"machine"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// PlannedEdit is a value set by lctrld in a configuration file of a node
+type PlannedEdit struct {
+	Node  string `json:"node"`
+	File  string `json:"file"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// PlannedCommand is a command run by lctrld, the machine is set for the
+// commands that run on, or against, a machine of the event
+type PlannedCommand struct {
+	Machine string   `json:"machine,omitempty"`
+	Command []string `json:"command"`
+}
+
+type plannerKey struct{}
+
+// withPlanner marks a context as used to build a plan
+func withPlanner(ctx context.Context, p *Planner) context.Context {
+	return context.WithValue(ctx, plannerKey{}, p)
+}
+
+// plannerFrom returns the planner of a context, nil if the context is not
+// used to build a plan
+func plannerFrom(ctx context.Context) *Planner {
+	p, _ := ctx.Value(plannerKey{}).(*Planner)
+	return p
+}
+
+// Planner is a CommandRunner that records the commands instead of running
+// them. The outputs the operations depend on, like the key addresses or the
+// machine addresses, are replaced by placeholders.
+type Planner struct {
+	settings  *config.Schema
+	evt       *model.Event
+	commands  []PlannedCommand
+	downloads []PlannedDownload
+	edits     []PlannedEdit
+	checks    []string
+	sync.Mutex
+}
+
+// NewPlanner creates a Planner for an event
+func NewPlanner(settings *config.Schema, evt *model.Event) *Planner {
+	return &Planner{settings: settings, evt: evt}
+}
+
+// download records a download
+func (p *Planner) download(url, destination string) {
+	p.Lock()
+	defer p.Unlock()
+	p.downloads = append(p.downloads, PlannedDownload{URL: url, Destination: destination})
+}
+
+// edit records a value set in a configuration file
+func (p *Planner) edit(node, file, key string, value interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	p.edits = append(p.edits, PlannedEdit{Node: node, File: file, Key: key, Value: fmt.Sprint(value)})
+}
+
+// check records a verification of the configuration
+func (p *Planner) check(description string) {
+	p.Lock()
+	defer p.Unlock()
+	p.checks = append(p.checks, description)
+}
+
+// Run records a command and returns what the operations expect from it
+func (p *Planner) Run(ctx context.Context, command, envVars []string) (out string, err error) {
+	p.Lock()
+	p.commands = append(p.commands, PlannedCommand{Machine: commandMachine(command, envVars), Command: command})
+	p.Unlock()
+
+	args := command[1:]
+	switch command[0] {
+	case p.settings.DmBin():
+		sub := firstArg(args)
+		name := command[len(command)-1]
+		switch sub {
+		case "create":
+			// lctrld reads the machine configuration written by docker-machine
+			dir := filepath.Join(envValue(envVars, "MACHINE_STORAGE_PATH"), "machines", name)
+			if err = os.MkdirAll(dir, 0700); err != nil {
+				return
+			}
+			err = utils.StoreJSON(filepath.Join(dir, "config.json"), map[string]interface{}{
+				"Name":   name,
+				"Driver": map[string]string{"IPAddress": p.ip(name), "MachineName": name},
+			})
+		case "ip":
+			out = p.ip(name)
+		}
+	case "docker":
+		switch {
+		case len(args) > 1 && args[0] == "network" && args[1] == "inspect":
+			err = errors.New("planned network does not exist yet")
+		case len(args) > 0 && args[0] == "inspect":
+			out = p.ip(command[len(command)-1])
+		}
+	case p.evt.Payload.DaemonPath, p.evt.Payload.CLIPath:
+		home := argValue(args, "--home")
+		switch firstArg(args) {
+		case "init":
+			// the configuration files the following steps edit
+			if err = os.MkdirAll(filepath.Join(home, "config"), 0700); err != nil {
+				return
+			}
+			if err = ioutil.WriteFile(filepath.Join(home, "config", "config.toml"), nil, 0600); err != nil {
+				return
+			}
+			err = ioutil.WriteFile(filepath.Join(home, "config", "genesis.json"), []byte("{}"), 0600)
+		case "tendermint":
+			out = fmt.Sprintf("<node id of node %s>", filepath.Base(filepath.Dir(home)))
+		case "keys":
+			// single binary payloads run the keys commands with the daemon
+			if len(args) > 2 && args[1] == "add" {
+				var data []byte
+				data, err = json.Marshal(map[string]string{
+					"address":  fmt.Sprintf("<address of %s>", args[2]),
+					"mnemonic": fmt.Sprintf("<mnemonic of %s>", args[2]),
+				})
+				out = string(data)
+			}
+		}
+	}
+	return
+}
+
+// ip returns the address of a machine, a placeholder if it is not known yet
+func (p *Planner) ip(machineName string) string {
+	for _, m := range p.evt.State {
+		if m.ID() == machineName && m.Instance.IPAddress != "" {
+			return m.Instance.IPAddress
+		}
+	}
+	return fmt.Sprintf("<ip of %s>", machineName)
+}
+
+// plan builds the plan from the recorded commands, the paths are changed
+// with the replacer
+func (p *Planner) plan(operation string, evt *model.Event, paths *strings.Replacer) (plan *Plan) {
+	p.Lock()
+	defer p.Unlock()
+	plan = &Plan{
+		Operation:       operation,
+		EventID:         evt.ID(),
+		Provider:        evt.Provider,
+		Machines:        make([]PlannedMachine, 0),
+		GenesisAccounts: make([]PlannedAccount, 0),
+		Ports:           make([]PlannedPort, 0),
+		Downloads:       make([]PlannedDownload, 0),
+		Copies:          make([]PlannedCopy, 0),
+		ConfigEdits:     make([]PlannedEdit, 0),
+		Checks:          append([]string{}, p.checks...),
+		Commands:        make([]PlannedCommand, 0),
+	}
+	for name, m := range evt.State {
+		plan.Machines = append(plan.Machines, PlannedMachine{Name: m.ID(), Account: name, Role: evt.NodeRole(name), IPAddress: m.Instance.IPAddress})
+	}
+	sort.Slice(plan.Machines, func(i, j int) bool { return plan.Machines[i].Name < plan.Machines[j].Name })
+	names := make([]string, 0, len(evt.Accounts))
+	for name := range evt.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		acc := evt.Accounts[name]
+		pa := PlannedAccount{Name: name, Balance: acc.GenesisBalance.String(), Validator: acc.Validator, Faucet: acc.Faucet}
+		if acc.Validator {
+			pa.Stake = acc.Stake().String()
+		}
+		plan.GenesisAccounts = append(plan.GenesisAccounts, pa)
+	}
+	for _, d := range p.downloads {
+		plan.Downloads = append(plan.Downloads, PlannedDownload{URL: d.URL, Destination: paths.Replace(d.Destination)})
+	}
+	for _, e := range p.edits {
+		e.File = paths.Replace(e.File)
+		plan.ConfigEdits = append(plan.ConfigEdits, e)
+	}
+	sort.SliceStable(plan.ConfigEdits, func(i, j int) bool { return plan.ConfigEdits[i].Node < plan.ConfigEdits[j].Node })
+	for _, c := range p.commands {
+		command := make([]string, len(c.Command))
+		for i, a := range c.Command {
+			command[i] = paths.Replace(a)
+		}
+		plan.Commands = append(plan.Commands, PlannedCommand{Machine: c.Machine, Command: command})
+		plan.Ports = append(plan.Ports, publishedPorts(c.Machine, command)...)
+		if cp := copiedPath(command); cp != nil {
+			plan.Copies = append(plan.Copies, *cp)
+		}
+	}
+	return
+}
+
+// WriteText writes the plan in a readable form
+func (plan *Plan) WriteText(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "Plan to %s event %s on %s\n", plan.Operation, plan.EventID, plan.Provider)
+	fmt.Fprintln(w, "\nMachines:")
+	for _, m := range plan.Machines {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", m.Name, m.Account, m.Role, m.IPAddress)
+	}
+	fmt.Fprintln(w, "\nGenesis accounts:")
+	for _, a := range plan.GenesisAccounts {
+		role := "account"
+		switch {
+		case a.Validator:
+			role = fmt.Sprintf("validator, stake %s", a.Stake)
+		case a.Faucet:
+			role = "faucet"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", a.Name, a.Balance, role)
+	}
+	if len(plan.Ports) > 0 {
+		fmt.Fprintln(w, "\nPort mappings:")
+		for _, p := range plan.Ports {
+			machine := p.Machine
+			if machine == "" {
+				machine = "(lctrld host)"
+			}
+			fmt.Fprintf(w, "  %s\t%s -> %s\t%s\n", machine, p.HostPort, p.ContainerPort, p.Image)
+		}
+	}
+	if len(plan.Downloads) > 0 {
+		fmt.Fprintln(w, "\nDownloads:")
+		for _, d := range plan.Downloads {
+			fmt.Fprintf(w, "  %s\t-> %s\n", d.URL, d.Destination)
+		}
+	}
+	if len(plan.Copies) > 0 {
+		fmt.Fprintln(w, "\nFiles copied:")
+		for _, c := range plan.Copies {
+			fmt.Fprintf(w, "  %s\t-> %s:%s\n", c.Source, c.Machine, c.Destination)
+		}
+	}
+	if len(plan.ConfigEdits) > 0 {
+		fmt.Fprintln(w, "\nConfiguration edits:")
+		for _, e := range plan.ConfigEdits {
+			fmt.Fprintf(w, "  %s\t%s\t%s = %s\n", e.Node, e.File, e.Key, e.Value)
+		}
+	}
+	if len(plan.Checks) > 0 {
+		fmt.Fprintln(w, "\nChecks:")
+		for _, c := range plan.Checks {
+			fmt.Fprintf(w, "  %s\n", c)
+		}
+	}
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range plan.Commands {
+		fmt.Fprintf(w, "  %s\n", strings.Join(c.Command, " "))
+	}
+}
+
+// PlanProvisionEvent returns the plan of ProvisionEvent
+func PlanProvisionEvent(ctx context.Context, settings *config.Schema, evt *model.Event) (plan *Plan, err error) {
+	return planOperation(ctx, settings, evt, "provision", false, ProvisionEvent)
+}
+
+// PlanConfigurePayload returns the plan of ConfigurePayload, or of
+// ResumeConfigurePayload if resume is set
+func PlanConfigurePayload(ctx context.Context, settings *config.Schema, evt *model.Event, fromStep string, resume bool) (plan *Plan, err error) {
+	from := 0
+	if resume {
+		if from, err = resumeStep(evt, fromStep); err != nil {
+			return
+		}
+	}
+	// a resumed configuration builds on the existing files
+	init, _ := payloadStepIndex("init")
+	return planOperation(ctx, settings, evt, "configure", from > init, func(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) error {
+		return runConfigurePayload(ctx, settings, evt, from, cmdRunner)
+	})
+}
+
+// PlanDeployPayload returns the plan of DeployPayload
+func PlanDeployPayload(ctx context.Context, settings *config.Schema, evt *model.Event) (plan *Plan, err error) {
+	return planOperation(ctx, settings, evt, "deploy", false, DeployPayload)
+}
+
+// PlanUndeployPayload returns the plan of UndeployPayload
+func PlanUndeployPayload(ctx context.Context, settings *config.Schema, evt *model.Event) (plan *Plan, err error) {
+	return planOperation(ctx, settings, evt, "undeploy", false, UndeployPayload)
+}
+
+// planOperation runs an operation with a Planner on a copy of the event in a
+// scratch workspace, so that neither the event nor its files are changed
+func planOperation(ctx context.Context, settings *config.Schema, evt *model.Event, operation string, withConfig bool,
+	run func(context.Context, *config.Schema, *model.Event, cmdrunner.CommandRunner) error) (plan *Plan, err error) {
+	workspace, err := filepath.Abs(settings.Workspace)
+	if err != nil {
+		return
+	}
+	scratch, err := ioutil.TempDir("", "lctrld-plan")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(scratch)
+	planSettings := *settings
+	planSettings.Workspace = scratch
+	if err = SetupWorkspace(&planSettings); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	planEvt := new(model.Event)
+	if err = json.Unmarshal(data, planEvt); err != nil {
+		return
+	}
+	// the configuration of the event is read and written in the scratch workspace
+	toScratch := strings.NewReplacer(workspace, scratch)
+	for _, acc := range planEvt.Accounts {
+		acc.ConfigLocation.DaemonConfigDir = toScratch.Replace(acc.ConfigLocation.DaemonConfigDir)
+		acc.ConfigLocation.CLIConfigDir = toScratch.Replace(acc.ConfigLocation.CLIConfigDir)
+	}
+	if err = CreateEvent(&planSettings, planEvt); err != nil {
+		return
+	}
+	if withConfig {
+		src, _ := settings.ConfigDir(evt.ID())
+		dst, _ := planSettings.ConfigDir(evt.ID())
+		if err = copyDir(src, dst); err != nil {
+			return
+		}
+	}
+
+	planner := NewPlanner(&planSettings, planEvt)
+	if err = run(withPlanner(ctx, planner), &planSettings, planEvt, planner.Run); err != nil {
+		return
+	}
+	plan = planner.plan(operation, planEvt, strings.NewReplacer(scratch, workspace))
+	return
+}
+
+// copyDir copies the files of a directory tree
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, info.Mode().Perm())
+	})
+}
+
+// commandMachine returns the machine a command runs on or against
+func commandMachine(command, envVars []string) string {
+	if name := envValue(envVars, "DOCKER_MACHINE_NAME"); name != "" {
+		return name
+	}
+	if len(command) > 2 && (command[1] == "exec" || command[1] == "ssh") {
+		return command[2]
+	}
+	if cp := copiedPath(command); cp != nil {
+		return cp.Machine
+	}
+	return ""
+}
+
+// publishedPorts returns the ports published by a docker run command
+func publishedPorts(machine string, command []string) (ports []PlannedPort) {
+	start := -1
+	for i := 1; i < len(command); i++ {
+		if command[i] == "run" && filepath.Base(command[i-1]) == "docker" {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return
+	}
+	var published []string
+	image := ""
+	for i := start; i < len(command) && image == ""; i++ {
+		a := command[i]
+		switch {
+		case a == "-p" || a == "--publish":
+			if i+1 < len(command) {
+				published = append(published, command[i+1])
+			}
+			i++
+		case strings.HasPrefix(a, "--publish="):
+			published = append(published, strings.TrimPrefix(a, "--publish="))
+		case dockerRunValueFlags[a]:
+			i++
+		case strings.HasPrefix(a, "-"):
+		default:
+			image = a
+		}
+	}
+	for _, p := range published {
+		hc := strings.SplitN(p, ":", 2)
+		port := PlannedPort{Machine: machine, Image: image, HostPort: hc[0], ContainerPort: hc[0]}
+		if len(hc) == 2 {
+			port.ContainerPort = hc[1]
+		}
+		ports = append(ports, port)
+	}
+	return
+}
+
+// dockerRunValueFlags are the docker run flags used by lctrld that take a value
+var dockerRunValueFlags = map[string]bool{
+	"-v": true, "--volume": true, "-e": true, "--env": true, "--name": true,
+	"--network": true, "--label": true, "--hostname": true,
+	"--restart": true, "--cpus": true, "--memory": true,
+}
+
+// copiedPath returns the copy made by a docker-machine scp or docker cp
+// command, nil for other commands
+func copiedPath(command []string) *PlannedCopy {
+	if len(command) < 4 {
+		return nil
+	}
+	isCopy := command[1] == "scp" || (filepath.Base(command[0]) == "docker" && command[1] == "cp")
+	if !isCopy {
+		return nil
+	}
+	src, dst := command[len(command)-2], command[len(command)-1]
+	md := strings.SplitN(dst, ":", 2)
+	if len(md) != 2 {
+		return nil
+	}
+	return &PlannedCopy{Machine: md[0], Source: src, Destination: md[1]}
+}
+
+// firstArg returns the first argument that is not a flag
+func firstArg(args []string) string {
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			return a
+		}
+	}
+	return ""
+}
+
+// argValue returns the value of a flag
+func argValue(args []string, flag string) string {
+	for i, a := range args {
+		if a == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// envValue returns the value of a variable in a list of environment variables
+func envValue(envVars []string, name string) string {
+	for _, e := range envVars {
+		if strings.HasPrefix(e, name+"=") {
+			return strings.TrimPrefix(e, name+"=")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,308 @@
+package lctrld
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	settings := &config.Schema{
+		Workspace:     t.TempDir(),
+		DockerMachine: config.DockerMachine{Binary: "docker-machine"},
+	}
+	req, err := model.LoadEventRequestFromFile("../../examples/simple_event_w_faucet.yml")
+	require.Nil(t, err)
+	payload := model.NewDefaultPayloadLocation()
+	payload.DaemonPath = settings.Bin("launchpayloadd")
+	payload.CLIPath = settings.Bin("launchpayloadcli")
+	evt := model.NewEvent(req.TokenSymbol, req.Owner, "virtualbox", req.GenesisAccounts, payload)
+	ctx := context.Background()
+
+	plan, err := PlanProvisionEvent(ctx, settings, evt)
+	require.Nil(t, err)
+	assert.Len(t, plan.Machines, 2)
+	assert.Len(t, plan.Commands, 2)
+	assert.Equal(t, "<ip of "+evt.NodeID(0)+">", plan.Machines[0].IPAddress)
+	assert.Equal(t, "100000000stake", plan.GenesisAccounts[0].Stake)
+	// planning changes nothing
+	assert.Len(t, evt.State, 0)
+	assert.False(t, utils.FileExists(filepath.Join(settings.Workspace, "evts")))
+
+	// pretend the machines have been provisioned
+	for i, name := range []string{"alice@apeunit.com", "bob@apeunit.com"} {
+		evt.State[name] = &model.Machine{N: fmt.Sprint(i), EventID: evt.ID(), Instance: model.MachineNetworkConfig{IPAddress: fmt.Sprintf("10.0.0.%d", i+1)}}
+	}
+	assert.Nil(t, evt.Transition(model.StatusProvisioned, ""))
+	plan, err = PlanConfigurePayload(ctx, settings, evt, "", false)
+	require.Nil(t, err)
+	assert.Equal(t, []PlannedDownload{{URL: payload.BinaryURL, Destination: settings.PayloadCache("")}}, plan.Downloads)
+	gentxs := 0
+	for _, c := range plan.Commands {
+		if c.Command[1] == "gentx" {
+			gentxs++
+			// the paths are the ones of the real workspace
+			assert.True(t, strings.HasPrefix(c.Command[len(c.Command)-1], settings.Workspace))
+		}
+	}
+	assert.Equal(t, 2, gentxs)
+	assert.Len(t, evt.PayloadSteps, 0)
+
+	// pretend the payload has been configured
+	for name, acc := range evt.Accounts {
+		acc.ConfigLocation.CLIConfigDir = filepath.Join(settings.Workspace, name, "cli")
+		acc.ConfigLocation.DaemonConfigDir = filepath.Join(settings.Workspace, name, "daemon")
+	}
+	assert.Nil(t, evt.Transition(model.StatusConfigured, ""))
+	plan, err = PlanDeployPayload(ctx, settings, evt)
+	require.Nil(t, err)
+	var ports []string
+	for _, p := range plan.Ports {
+		ports = append(ports, p.Machine+" "+p.HostPort)
+	}
+	assert.ElementsMatch(t, []string{
+		evt.NodeID(0) + " 26656", evt.NodeID(0) + " 26657", evt.NodeID(0) + " 26658",
+		evt.NodeID(1) + " 26656", evt.NodeID(1) + " 26657", evt.NodeID(1) + " 26658",
+		evt.NodeID(0) + " 1317", evt.NodeID(0) + " 8000",
+	}, ports)
+	assert.Len(t, plan.Copies, 6)
+	assert.Equal(t, model.StatusConfigured, evt.CurrentStatus())
+}
+
+func TestPlanNodeRoles(t *testing.T) {
+	settings := &config.Schema{
+		Workspace:     t.TempDir(),
+		DockerMachine: config.DockerMachine{Binary: "docker-machine"},
+	}
+	req, err := model.LoadEventRequestFromFile("../../examples/sentry_event.yml")
+	require.Nil(t, err)
+	req.PayloadLocation = model.NewDefaultPayloadLocation()
+	req.PayloadLocation.DaemonPath = settings.Bin("launchpayloadd")
+	req.PayloadLocation.CLIPath = settings.Bin("launchpayloadcli")
+	req.Provider = "virtualbox"
+	evt := model.NewEventFromRequest(req)
+	ctx := context.Background()
+
+	// every node has a machine
+	plan, err := PlanProvisionEvent(ctx, settings, evt)
+	require.Nil(t, err)
+	require.Len(t, plan.Machines, 5)
+	roles := make(map[string]model.NodeRole)
+	for _, m := range plan.Machines {
+		roles[m.Account] = m.Role
+	}
+	assert.Equal(t, map[string]model.NodeRole{
+		"alice@apeunit.com": model.RoleValidator, "bob@apeunit.com": model.RoleValidator,
+		"alice-sentry": model.RoleSentry, "rpc": model.RoleFullNode, "seed": model.RoleSeed,
+	}, roles)
+
+	for i, name := range evt.NodeNames() {
+		evt.State[name] = &model.Machine{N: fmt.Sprint(i), EventID: evt.ID(), Instance: model.MachineNetworkConfig{IPAddress: fmt.Sprintf("10.0.0.%d", i+1)}}
+	}
+	assert.Nil(t, evt.Transition(model.StatusProvisioned, ""))
+	plan, err = PlanConfigurePayload(ctx, settings, evt, "", false)
+	require.Nil(t, err)
+	// all the nodes are initialized, only the validators have genesis transactions
+	count := make(map[string]int)
+	for _, c := range plan.Commands {
+		if len(c.Command) > 1 {
+			count[c.Command[1]]++
+		}
+	}
+	assert.Equal(t, 5, count["init"])
+	assert.Equal(t, 2, count["gentx"])
+	assert.Equal(t, 2, count["collect-gentxs"])
+
+	// the light client and the faucet run on the full node
+	for _, location := range []*model.ConfigLocation{evt.NodeConfigLocation("rpc"), &evt.FaucetAccount().ConfigLocation} {
+		location.CLIConfigDir = filepath.Join(settings.Workspace, "cli")
+		location.DaemonConfigDir = filepath.Join(settings.Workspace, "daemon")
+	}
+	for _, name := range evt.NodeNames() {
+		location := evt.NodeConfigLocation(name)
+		location.CLIConfigDir = filepath.Join(settings.Workspace, name, "cli")
+		location.DaemonConfigDir = filepath.Join(settings.Workspace, name, "daemon")
+	}
+	assert.Nil(t, evt.Transition(model.StatusConfigured, ""))
+	plan, err = PlanDeployPayload(ctx, settings, evt)
+	require.Nil(t, err)
+	services := evt.State["rpc"].ID()
+	var servicePorts []string
+	for _, p := range plan.Ports {
+		if p.Machine == services {
+			servicePorts = append(servicePorts, p.HostPort)
+		}
+	}
+	assert.ElementsMatch(t, []string{"26656", "26657", "26658", "1317", "8000"}, servicePorts)
+}
+
+func TestPlanPayloadProfile(t *testing.T) {
+	settings := &config.Schema{
+		Workspace:     t.TempDir(),
+		DockerMachine: config.DockerMachine{Binary: "docker-machine"},
+		Profiles: map[string]config.PayloadProfile{
+			"mychain": {Extends: config.ProfileStargate, Entrypoints: config.ProfileEntrypoints{Node: []string{"mychaind", "start"}}},
+		},
+	}
+	req, err := model.LoadEventRequestFromFile("../../examples/simple_event_w_faucet.yml")
+	require.Nil(t, err)
+	payload := model.NewDefaultPayloadLocation()
+	payload.DaemonPath = settings.Bin("mychaind")
+	payload.CLIPath = ""
+	payload.Profile = "mychain"
+	evt := model.NewEvent(req.TokenSymbol, req.Owner, "virtualbox", req.GenesisAccounts, payload)
+	ctx := context.Background()
+	for i, name := range []string{"alice@apeunit.com", "bob@apeunit.com"} {
+		evt.State[name] = &model.Machine{N: fmt.Sprint(i), EventID: evt.ID(), Instance: model.MachineNetworkConfig{IPAddress: fmt.Sprintf("10.0.0.%d", i+1)}}
+	}
+	assert.Nil(t, evt.Transition(model.StatusProvisioned, ""))
+
+	plan, err := PlanConfigurePayload(ctx, settings, evt, "", false)
+	require.Nil(t, err)
+	keys, gentxs := 0, 0
+	for _, c := range plan.Commands {
+		switch {
+		case filepath.Base(c.Command[0]) != "mychaind":
+		case c.Command[1] == "keys":
+			keys++
+			// there are no CLI homes
+			assert.NotEqual(t, "cli", filepath.Base(argValue(c.Command, "--home")))
+		case c.Command[1] == "gentx":
+			gentxs++
+			assert.Equal(t, evt.Accounts[c.Command[2]].Stake().String(), c.Command[3])
+			assert.Empty(t, argValue(c.Command, "--name"))
+		}
+	}
+	assert.Equal(t, 3, keys)
+	assert.Equal(t, 2, gentxs)
+
+	for _, acc := range evt.Accounts {
+		acc.ConfigLocation.CLIConfigDir = filepath.Join(settings.Workspace, acc.Name, "daemon")
+		acc.ConfigLocation.DaemonConfigDir = acc.ConfigLocation.CLIConfigDir
+	}
+	assert.Nil(t, evt.Transition(model.StatusConfigured, ""))
+	plan, err = PlanDeployPayload(ctx, settings, evt)
+	require.Nil(t, err)
+	// a single home is copied to each node
+	assert.Len(t, plan.Copies, 4)
+	started := 0
+	for _, c := range plan.Commands {
+		if strings.HasSuffix(strings.Join(c.Command, " "), payload.DockerImage+" mychaind start") {
+			started++
+		}
+	}
+	assert.Equal(t, 2, started)
+}
+
+func TestPlanPayloadServices(t *testing.T) {
+	settings := &config.Schema{
+		Workspace:     t.TempDir(),
+		DockerMachine: config.DockerMachine{Binary: "docker-machine"},
+		Payloads: config.PayloadCatalog{Catalog: map[string]config.CatalogPayload{
+			"launchpayload": {
+				DockerImage: "apeunit/launchpayload:v1.0.0",
+				BinaryURL:   "https://example.com/launchpayload.zip",
+				Daemon:      "launchpayloadd",
+				CLI:         "launchpayloadcli",
+				Services: map[string]config.ServiceSpec{
+					"explorer": {Image: "example/explorer:v1", Env: []string{"RPC=http://{{.IP}}:26657"}, Ports: []string{"8080:80"}, Restart: "unless-stopped", Nodes: []string{config.NodesServices}},
+				},
+			},
+		}},
+	}
+	req, err := model.LoadEventRequestFromFile("../../examples/sentry_event.yml")
+	require.Nil(t, err)
+	req.Provider = "virtualbox"
+	req.Services = map[string]config.ServiceSpec{
+		config.ServiceDaemon: {Ports: []string{"26656:26656", "26657:26657", "26658:26658", "9090:9090"}, Memory: "2g"},
+		config.ServiceFaucet: {Disabled: true},
+	}
+	require.Nil(t, req.SetPayload(settings))
+	evt := model.NewEventFromRequest(req)
+	ctx := context.Background()
+	for i, name := range evt.NodeNames() {
+		evt.State[name] = &model.Machine{N: fmt.Sprint(i), EventID: evt.ID(), Instance: model.MachineNetworkConfig{IPAddress: fmt.Sprintf("10.0.0.%d", i+1)}}
+		location := evt.NodeConfigLocation(name)
+		location.CLIConfigDir = filepath.Join(settings.Workspace, name, "cli")
+		location.DaemonConfigDir = filepath.Join(settings.Workspace, name, "daemon")
+	}
+	assert.Nil(t, evt.Transition(model.StatusProvisioned, ""))
+	assert.Nil(t, evt.Transition(model.StatusConfigured, ""))
+	plan, err := PlanDeployPayload(ctx, settings, evt)
+	require.Nil(t, err)
+
+	ports := make(map[string][]string)
+	for _, p := range plan.Ports {
+		ports[p.Machine] = append(ports[p.Machine], p.HostPort)
+	}
+	assert.ElementsMatch(t, []string{"26656", "26657", "26658", "9090", "1317", "8080"}, ports[evt.State["rpc"].ID()])
+	assert.ElementsMatch(t, []string{"26656", "26657", "26658", "9090"}, ports[evt.State["seed"].ID()])
+	explorer := 0
+	for _, c := range plan.Commands {
+		command := strings.Join(c.Command, " ")
+		// the faucet is disabled, its configuration is not copied
+		assert.NotContains(t, command, "faucet")
+		if strings.Contains(command, " run ") && strings.Contains(command, "example/explorer:v1") {
+			explorer++
+			assert.Contains(t, command, "--restart unless-stopped -e RPC=http://10.0.0.4:26657 -p 8080:80 example/explorer:v1")
+		}
+		if strings.Contains(command, " run ") && strings.Contains(command, "-p 9090:9090") {
+			assert.Contains(t, command, "--memory 2g")
+		}
+	}
+	assert.Equal(t, 1, explorer)
+
+	// the overrides cannot change what the operator approved
+	req.Services = map[string]config.ServiceSpec{"explorer": {Image: "evil/explorer"}}
+	assert.NotNil(t, req.SetPayload(settings))
+	req.Services = map[string]config.ServiceSpec{"miner": {}}
+	assert.NotNil(t, req.SetPayload(settings))
+}
+
+func TestPlanConfigEdits(t *testing.T) {
+	settings := &config.Schema{
+		Workspace:     t.TempDir(),
+		DockerMachine: config.DockerMachine{Binary: "docker-machine"},
+	}
+	req, err := model.LoadEventRequestFromFile("../../examples/workshop_event.yml")
+	require.Nil(t, err)
+	req.PayloadLocation = model.NewDefaultPayloadLocation()
+	req.PayloadLocation.DaemonPath = settings.Bin("launchpayloadd")
+	req.PayloadLocation.CLIPath = settings.Bin("launchpayloadcli")
+	req.Provider = "virtualbox"
+	evt := model.NewEventFromRequest(req)
+	for i, name := range evt.NodeNames() {
+		evt.State[name] = &model.Machine{N: fmt.Sprint(i), EventID: evt.ID(), Instance: model.MachineNetworkConfig{IPAddress: fmt.Sprintf("10.0.0.%d", i+1)}}
+	}
+	require.Nil(t, evt.Transition(model.StatusProvisioned, ""))
+
+	plan, err := PlanConfigurePayload(context.Background(), settings, evt, "", false)
+	require.Nil(t, err)
+	edits := make(map[string]string)
+	for _, e := range plan.ConfigEdits {
+		// the paths are the ones of the real workspace
+		assert.True(t, strings.HasPrefix(e.File, settings.Workspace), e.File)
+		edits[e.Node+" "+filepath.Base(e.File)+" "+e.Key] = e.Value
+	}
+	assert.Equal(t, "gov-workshop-1", edits["alice@apeunit.com genesis.json chain_id"])
+	assert.Equal(t, "600000000000", edits["alice@apeunit.com genesis.json app_state.staking.params.unbonding_time"])
+	assert.Equal(t, "everything", edits["alice@apeunit.com app.toml pruning"])
+	assert.Equal(t, "nothing", edits["bob@apeunit.com app.toml pruning"])
+	assert.Equal(t, "1s", edits["bob@apeunit.com config.toml consensus.timeout_commit"])
+	assert.Equal(t, "tcp://0.0.0.0:26657", edits["bob@apeunit.com config.toml rpc.laddr"])
+	assert.Len(t, plan.Checks, 1)
+
+	var text bytes.Buffer
+	plan.WriteText(&text)
+	assert.Contains(t, text.String(), "Configuration edits:")
+	assert.Contains(t, text.String(), "pruning = everything")
+}
@@ -0,0 +1,64 @@
+package lctrld
+
+import (
+	"context"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+)
+
+// Provisioner creates the machines of an event and gives access to them
+type Provisioner interface {
+	// ProvisionMachine creates a machine using the provider
+	ProvisionMachine(ctx context.Context, machineName, provider string, cmdRunner cmdrunner.CommandRunner) (*model.Machine, error)
+	// StopMachine stops and removes a machine
+	StopMachine(ctx context.Context, machineName string, cmdRunner cmdrunner.CommandRunner) error
+	// Status returns the status and the address of a machine
+	Status(ctx context.Context, machineName string, cmdRunner cmdrunner.CommandRunner) (string, error)
+	// RunDocker runs a docker command against the docker daemon of a machine
+	RunDocker(ctx context.Context, machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (string, error)
+	// Run runs a command on a machine
+	Run(ctx context.Context, machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (string, error)
+	// Copy recursively copies a local path to a machine
+	Copy(ctx context.Context, machineName, sourcePath, destPath string, cmdRunner cmdrunner.CommandRunner) error
+}
+
+// NewProvisioner returns the Provisioner for the provider of the event, every
+// provider other than the local docker one is a docker-machine driver
+func NewProvisioner(settings *config.Schema, evt *model.Event) Provisioner {
+	if evt.Provider == LocalDockerProvider {
+		return machineContext{NewLocalDocker(settings, evt.ID())}
+	}
+	return machineContext{NewDockerMachine(settings, evt.ID())}
+}
+
+// machineContext is a Provisioner that sets the machine in the context of
+// the commands it runs, so they are journaled with it
+type machineContext struct {
+	p Provisioner
+}
+
+func (mc machineContext) ProvisionMachine(ctx context.Context, machineName, provider string, cmdRunner cmdrunner.CommandRunner) (*model.Machine, error) {
+	return mc.p.ProvisionMachine(cmdrunner.WithMachine(ctx, machineName), machineName, provider, cmdRunner)
+}
+
+func (mc machineContext) StopMachine(ctx context.Context, machineName string, cmdRunner cmdrunner.CommandRunner) error {
+	return mc.p.StopMachine(cmdrunner.WithMachine(ctx, machineName), machineName, cmdRunner)
+}
+
+func (mc machineContext) Status(ctx context.Context, machineName string, cmdRunner cmdrunner.CommandRunner) (string, error) {
+	return mc.p.Status(cmdrunner.WithMachine(ctx, machineName), machineName, cmdRunner)
+}
+
+func (mc machineContext) RunDocker(ctx context.Context, machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (string, error) {
+	return mc.p.RunDocker(cmdrunner.WithMachine(ctx, machineName), machineName, cmd, cmdRunner)
+}
+
+func (mc machineContext) Run(ctx context.Context, machineName string, cmd []string, cmdRunner cmdrunner.CommandRunner) (string, error) {
+	return mc.p.Run(cmdrunner.WithMachine(ctx, machineName), machineName, cmd, cmdRunner)
+}
+
+func (mc machineContext) Copy(ctx context.Context, machineName, sourcePath, destPath string, cmdRunner cmdrunner.CommandRunner) error {
+	return mc.p.Copy(cmdrunner.WithMachine(ctx, machineName), machineName, sourcePath, destPath, cmdRunner)
+}
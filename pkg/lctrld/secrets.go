@@ -0,0 +1,91 @@
+package lctrld
+
+import (
+	"fmt"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
+	log "github.com/sirupsen/logrus"
+)
+
+// sealEvent seals the plaintext secrets of the event accounts, a nil keeper
+// leaves them in plaintext
+func sealEvent(evt *model.Event, keeper *secrets.Keeper) (err error) {
+	for _, acc := range evt.Accounts {
+		if acc.Mnemonic, err = keeper.Seal(acc.Mnemonic); err != nil {
+			return fmt.Errorf("cannot encrypt the mnemonic of %s: %w", acc.Name, err)
+		}
+	}
+	return
+}
+
+// hasPlaintextSecrets tells whenever the event has secrets that are not sealed
+func hasPlaintextSecrets(evt *model.Event) bool {
+	for _, acc := range evt.Accounts {
+		if acc.Mnemonic != "" && !acc.Mnemonic.IsSealed() {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateSecrets seals and stores the plaintext secrets of an event stored
+// before a master key was configured
+func migrateSecrets(settings *config.Schema, evt *model.Event) (err error) {
+	if !hasPlaintextSecrets(evt) {
+		return
+	}
+	keeper, err := secrets.FromSettings(settings)
+	if err != nil || keeper == nil {
+		return
+	}
+	log.Infof("Encrypting the secrets of event %s with master key %s", evt.ID(), keeper.ID())
+	return storeEvent(settings, evt, keeper)
+}
+
+// RotateSecrets re-encrypts the secrets of all the events with a new master
+// key. The secrets can be sealed with the configured master key, with the new
+// one or be in plaintext, so an interrupted rotation can be run again.
+// It returns the ids of the events that have been re-encrypted.
+func RotateSecrets(settings *config.Schema, newKey []byte) (rotated []string, err error) {
+	current, err := secrets.FromSettings(settings)
+	if err != nil {
+		return
+	}
+	keeper, err := secrets.NewKeeper(newKey)
+	if err != nil {
+		return
+	}
+	opener, _ := secrets.NewKeeper(newKey)
+	opener.Trust(current)
+
+	events, err := ListEvents(settings)
+	if err != nil {
+		return
+	}
+	for i := range events {
+		evt := &events[i]
+		changed := false
+		for _, acc := range evt.Accounts {
+			if acc.Mnemonic == "" || acc.Mnemonic.KeyID() == keeper.ID() {
+				continue
+			}
+			plaintext, err := opener.Open(acc.Mnemonic)
+			if err != nil {
+				return rotated, fmt.Errorf("cannot decrypt the mnemonic of %s in event %s: %w", acc.Name, evt.ID(), err)
+			}
+			acc.Mnemonic = secrets.Secret(plaintext)
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err = storeEvent(settings, evt, keeper); err != nil {
+			return
+		}
+		log.Infof("Re-encrypted the secrets of event %s with master key %s", evt.ID(), keeper.ID())
+		rotated = append(rotated, evt.ID())
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package lctrld
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventSecrets(t *testing.T) {
+	os.Unsetenv(secrets.MasterKeyEnv)
+	settings := &config.Schema{Workspace: t.TempDir()}
+	mnemonic := "abandon abandon about"
+	evt := model.NewEvent("drop", "owner@apeunit.com", "virtualbox", []model.GenesisAccount{
+		{Name: "alice", GenesisBalance: model.MustParseCoins("100stake"), Validator: true, Mnemonic: secrets.Secret(mnemonic)},
+	}, model.PayloadLocation{})
+	evtFile, err := settings.EvtFile(evt.ID())
+	require.Nil(t, err)
+	storedMnemonic := func() secrets.Secret {
+		stored, err := model.LoadEvent(evtFile)
+		require.Nil(t, err)
+		return stored.Accounts["alice"].Mnemonic
+	}
+
+	// without a master key the mnemonic is stored in plaintext
+	require.Nil(t, CreateEvent(settings, evt))
+	assert.Equal(t, secrets.Secret(mnemonic), storedMnemonic())
+
+	// once a master key is configured, loading the event encrypts it
+	settings.Secrets.MasterKey, _ = secrets.GenerateKey()
+	loaded, err := LoadEvent(settings, evt.ID())
+	require.Nil(t, err)
+	sealed := storedMnemonic()
+	assert.True(t, sealed.IsSealed())
+	data, err := ioutil.ReadFile(evtFile)
+	require.Nil(t, err)
+	assert.NotContains(t, string(data), "abandon")
+	keeper, err := secrets.FromSettings(settings)
+	require.Nil(t, err)
+	plaintext, err := keeper.Open(loaded.Accounts["alice"].Mnemonic)
+	require.Nil(t, err)
+	assert.Equal(t, mnemonic, plaintext)
+
+	// rotating re-encrypts with the new key, rotating again changes nothing
+	newEncoded, _ := secrets.GenerateKey()
+	newKey, _ := secrets.DecodeKey(newEncoded)
+	rotated, err := RotateSecrets(settings, newKey)
+	require.Nil(t, err)
+	assert.Equal(t, []string{evt.ID()}, rotated)
+	rotated, err = RotateSecrets(settings, newKey)
+	require.Nil(t, err)
+	assert.Empty(t, rotated)
+
+	settings.Secrets.MasterKey = newEncoded
+	keeper, err = secrets.FromSettings(settings)
+	require.Nil(t, err)
+	assert.Equal(t, keeper.ID(), storedMnemonic().KeyID())
+	plaintext, err = keeper.Open(storedMnemonic())
+	require.Nil(t, err)
+	assert.Equal(t, mnemonic, plaintext)
+}
@@ -0,0 +1,65 @@
+package lctrld
+
+import (
+	"github.com/apeunit/LaunchControlD/pkg/model"
+)
+
+// p2pConfig is the p2p section of the config.toml of a node
+type p2pConfig struct {
+	PersistentPeers []string
+	Seeds           []string
+	PEX             bool
+	PrivatePeerIDs  []string
+	SeedMode        bool
+}
+
+// peerTopology returns the p2p configuration of every node of the event.
+// A validator with sentries is hidden: it only connects to its sentries,
+// with the peer exchange disabled, and its sentries do not gossip its
+// address. All the other nodes but the seeds are public, they connect to
+// each other and use the seeds to discover more peers.
+func peerTopology(evt *model.Event) map[string]p2pConfig {
+	hidden := make(map[string]bool)
+	var public, seeds []string
+	for _, name := range evt.NodeNames() {
+		switch {
+		case evt.NodeRole(name) == model.RoleSeed:
+			seeds = append(seeds, evt.State[name].TendermintPeerNodeID())
+		case evt.NodeRole(name) == model.RoleValidator && len(evt.Sentries(name)) > 0:
+			hidden[name] = true
+		default:
+			public = append(public, name)
+		}
+	}
+	// peers returns the addresses of the nodes, except the node itself
+	peers := func(self string, names ...string) (addresses []string) {
+		addresses = make([]string, 0, len(names))
+		for _, name := range names {
+			if name != self {
+				addresses = append(addresses, evt.State[name].TendermintPeerNodeID())
+			}
+		}
+		return
+	}
+
+	topology := make(map[string]p2pConfig)
+	for _, name := range evt.NodeNames() {
+		switch role := evt.NodeRole(name); {
+		case hidden[name]:
+			topology[name] = p2pConfig{PersistentPeers: peers(name, evt.Sentries(name)...), PEX: false}
+		case role == model.RoleSentry:
+			validator := evt.Nodes[name].Validator
+			topology[name] = p2pConfig{
+				PersistentPeers: append(peers(name, public...), peers(name, validator)...),
+				Seeds:           seeds,
+				PEX:             true,
+				PrivatePeerIDs:  []string{evt.State[validator].TendermintNodeID},
+			}
+		case role == model.RoleSeed:
+			topology[name] = p2pConfig{PersistentPeers: peers(name, public...), PEX: true, SeedMode: true}
+		default:
+			topology[name] = p2pConfig{PersistentPeers: peers(name, public...), Seeds: seeds, PEX: true}
+		}
+	}
+	return topology
+}
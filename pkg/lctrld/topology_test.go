@@ -0,0 +1,50 @@
+package lctrld
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerTopology(t *testing.T) {
+	req, err := model.LoadEventRequestFromFile("../../examples/sentry_event.yml")
+	require.Nil(t, err)
+	evt := model.NewEventFromRequest(req)
+	peer := make(map[string]string)
+	for i, name := range evt.NodeNames() {
+		evt.State[name] = &model.Machine{N: fmt.Sprint(i), EventID: evt.ID(), TendermintNodeID: fmt.Sprintf("id%d", i), Instance: model.MachineNetworkConfig{IPAddress: fmt.Sprintf("10.0.0.%d", i)}}
+		peer[name] = evt.State[name].TendermintPeerNodeID()
+	}
+	topology := peerTopology(evt)
+	require.Len(t, topology, 5)
+
+	// alice is hidden behind her sentry
+	assert.Equal(t, p2pConfig{PersistentPeers: []string{peer["alice-sentry"]}}, topology["alice@apeunit.com"])
+	assert.Equal(t, p2pConfig{
+		PersistentPeers: []string{peer["bob@apeunit.com"], peer["rpc"], peer["alice@apeunit.com"]},
+		Seeds:           []string{peer["seed"]},
+		PEX:             true,
+		PrivatePeerIDs:  []string{"id0"},
+	}, topology["alice-sentry"])
+	// the public nodes connect to each other, not to alice
+	assert.Equal(t, p2pConfig{
+		PersistentPeers: []string{peer["alice-sentry"], peer["rpc"]},
+		Seeds:           []string{peer["seed"]},
+		PEX:             true,
+	}, topology["bob@apeunit.com"])
+	assert.Equal(t, []string{peer["bob@apeunit.com"], peer["alice-sentry"]}, topology["rpc"].PersistentPeers)
+	assert.True(t, topology["seed"].SeedMode)
+	assert.Empty(t, topology["seed"].Seeds)
+	assert.Len(t, topology["seed"].PersistentPeers, 3)
+
+	// without roles every validator connects to all the others
+	delete(evt.State, "alice-sentry")
+	delete(evt.State, "seed")
+	delete(evt.State, "rpc")
+	evt.Nodes = nil
+	topology = peerTopology(evt)
+	assert.Equal(t, p2pConfig{PersistentPeers: []string{peer["bob@apeunit.com"]}, PEX: true}, topology["alice@apeunit.com"])
+}
@@ -0,0 +1,282 @@
+package lctrld
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// GenesisError lists the differences found between the genesis of an event
+// and the event itself
+type GenesisError struct {
+	Path       string
+	Violations []string
+}
+
+func (e *GenesisError) Error() string {
+	return fmt.Sprintf("genesis %s does not match the event:\n- %s", e.Path, strings.Join(e.Violations, "\n- "))
+}
+
+// genesisCoin is a coin in a genesis.json
+type genesisCoin struct {
+	Denom  string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+// genesisBalance is the balance of an account in a genesis.json
+type genesisBalance struct {
+	Address string        `json:"address"`
+	Coins   []genesisCoin `json:"coins"`
+}
+
+// genesisDelegation is the delegator and the stake of a create validator
+// message
+type genesisDelegation struct {
+	DelegatorAddress string      `json:"delegator_address"`
+	Value            genesisCoin `json:"value"`
+}
+
+// genesisTx is a genesis transaction, with its create validator messages
+type genesisTx struct {
+	Delegations []genesisDelegation
+	Memo        string
+}
+
+// genesisDoc is the part of a genesis.json checked by VerifyGenesis, in
+// any of the genesis layouts
+type genesisDoc struct {
+	ChainID  string
+	Balances []genesisBalance
+	Gentxs   []genesisTx
+}
+
+// legacyGenesisDoc is the part of a cosmos-sdk 0.39 genesis.json checked by
+// VerifyGenesis
+type legacyGenesisDoc struct {
+	ChainID  string `json:"chain_id"`
+	AppState struct {
+		Auth struct {
+			Accounts []struct {
+				Value genesisBalance `json:"value"`
+			} `json:"accounts"`
+		} `json:"auth"`
+		Genutil struct {
+			Gentxs []struct {
+				Value struct {
+					Msg []struct {
+						Type  string            `json:"type"`
+						Value genesisDelegation `json:"value"`
+					} `json:"msg"`
+					Memo string `json:"memo"`
+				} `json:"value"`
+			} `json:"gentxs"`
+		} `json:"genutil"`
+	} `json:"app_state"`
+}
+
+// stargateGenesisDoc is the part of a cosmos-sdk 0.40+ genesis.json checked
+// by VerifyGenesis
+type stargateGenesisDoc struct {
+	ChainID  string `json:"chain_id"`
+	AppState struct {
+		Bank struct {
+			Balances []genesisBalance `json:"balances"`
+		} `json:"bank"`
+		Genutil struct {
+			GenTxs []struct {
+				Body struct {
+					Messages []struct {
+						Type             string      `json:"@type"`
+						DelegatorAddress string      `json:"delegator_address"`
+						Value            genesisCoin `json:"value"`
+					} `json:"messages"`
+					Memo string `json:"memo"`
+				} `json:"body"`
+			} `json:"gen_txs"`
+		} `json:"genutil"`
+	} `json:"app_state"`
+}
+
+// decodeGenesis reads the chain id, the balances and the genesis
+// transactions of a genesis.json in a genesis layout
+func decodeGenesis(data []byte, layout string) (genesis genesisDoc, err error) {
+	switch layout {
+	case config.GenesisStargate:
+		var doc stargateGenesisDoc
+		if err = json.Unmarshal(data, &doc); err != nil {
+			return
+		}
+		genesis.ChainID = doc.ChainID
+		genesis.Balances = doc.AppState.Bank.Balances
+		for _, tx := range doc.AppState.Genutil.GenTxs {
+			gentx := genesisTx{Memo: tx.Body.Memo}
+			for _, msg := range tx.Body.Messages {
+				if msg.Type == "/cosmos.staking.v1beta1.MsgCreateValidator" {
+					gentx.Delegations = append(gentx.Delegations, genesisDelegation{DelegatorAddress: msg.DelegatorAddress, Value: msg.Value})
+				}
+			}
+			genesis.Gentxs = append(genesis.Gentxs, gentx)
+		}
+	case config.GenesisLegacy:
+		var doc legacyGenesisDoc
+		if err = json.Unmarshal(data, &doc); err != nil {
+			return
+		}
+		genesis.ChainID = doc.ChainID
+		for _, a := range doc.AppState.Auth.Accounts {
+			genesis.Balances = append(genesis.Balances, a.Value)
+		}
+		for _, tx := range doc.AppState.Genutil.Gentxs {
+			gentx := genesisTx{Memo: tx.Value.Memo}
+			for _, msg := range tx.Value.Msg {
+				if msg.Type == "cosmos-sdk/MsgCreateValidator" {
+					gentx.Delegations = append(gentx.Delegations, msg.Value)
+				}
+			}
+			genesis.Gentxs = append(genesis.Gentxs, gentx)
+		}
+	default:
+		err = fmt.Errorf("unknown genesis layout %s", layout)
+	}
+	return
+}
+
+// formatCoins returns the coins sorted by denom in the genesis balance format
+func formatCoins(coins []genesisCoin) string {
+	sorted := append([]genesisCoin{}, coins...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Denom < sorted[j].Denom })
+	s := make([]string, len(sorted))
+	for i, c := range sorted {
+		s[i] = c.Amount + c.Denom
+	}
+	return strings.Join(s, ",")
+}
+
+// VerifyGenesis checks node 0's genesis.json against the event: the chain id,
+// the address and balance of every account, one genesis transaction for
+// each validator, and that every node, validator or not, has the same genesis. All the
+// differences found are reported in a *GenesisError.
+func VerifyGenesis(settings *config.Schema, evt *model.Event) (err error) {
+	v, valAccounts := evt.Validators()
+	if len(valAccounts) == 0 {
+		return fmt.Errorf("event %s has no validators", evt.ID())
+	}
+	genesisPath := path.Join(valAccounts[0].ConfigLocation.DaemonConfigDir, "config/genesis.json")
+	data, err := ioutil.ReadFile(genesisPath)
+	if err != nil {
+		return
+	}
+	profile, err := payloadProfile(settings, evt)
+	if err != nil {
+		return
+	}
+	genesis, err := decodeGenesis(data, profile.Genesis())
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %w", genesisPath, err)
+	}
+	gErr := &GenesisError{Path: genesisPath}
+	violation := func(format string, a ...interface{}) {
+		gErr.Violations = append(gErr.Violations, fmt.Sprintf(format, a...))
+	}
+
+	if genesis.ChainID != evt.ChainID() {
+		violation("chain_id is %q instead of %q", genesis.ChainID, evt.ChainID())
+	}
+
+	// accounts
+	balances := make(map[string]string)
+	for _, b := range genesis.Balances {
+		balances[b.Address] = formatCoins(b.Coins)
+	}
+	expected := make(map[string]bool)
+	for _, acc := range append(append([]*model.Account{}, valAccounts...), evt.ExtraAccounts()...) {
+		name := acc.Name
+		if acc.Address == "" {
+			violation("account %s has no address", name)
+			continue
+		}
+		expected[acc.Address] = true
+		got, found := balances[acc.Address]
+		switch {
+		case !found:
+			violation("account %s (%s) is missing", name, acc.Address)
+		case got != acc.GenesisBalance.String():
+			violation("account %s (%s) has %s instead of %s", name, acc.Address, got, acc.GenesisBalance)
+		}
+	}
+	for _, b := range genesis.Balances {
+		if !expected[b.Address] {
+			violation("account %s is not an account of the event", b.Address)
+		}
+	}
+
+	// genesis transactions
+	gentxs := make(map[string]int)
+	memos := make(map[string]string)
+	stakes := make(map[string]string)
+	for _, tx := range genesis.Gentxs {
+		for _, d := range tx.Delegations {
+			gentxs[d.DelegatorAddress]++
+			memos[d.DelegatorAddress] = tx.Memo
+			stakes[d.DelegatorAddress] = d.Value.Amount + d.Value.Denom
+		}
+	}
+	if len(genesis.Gentxs) != len(v) {
+		violation("there are %d genesis transactions for %d validators", len(genesis.Gentxs), len(v))
+	}
+	for _, name := range v {
+		acc, m := evt.Accounts[name], evt.State[name]
+		if acc.Address == "" || m == nil {
+			continue
+		}
+		switch n := gentxs[acc.Address]; {
+		case n == 0:
+			violation("validator %s (%s) has no genesis transaction", name, acc.Address)
+		case n > 1:
+			violation("validator %s (%s) has %d genesis transactions", name, acc.Address, n)
+		case stakes[acc.Address] != acc.Stake().String():
+			violation("validator %s (%s) delegates %s instead of %s", name, acc.Address, stakes[acc.Address], acc.Stake())
+		case m.TendermintNodeID != "" && memos[acc.Address] != m.TendermintPeerNodeID():
+			violation("the genesis transaction of validator %s has memo %q instead of %q", name, memos[acc.Address], m.TendermintPeerNodeID())
+		}
+	}
+
+	// the genesis of the other nodes
+	for _, name := range evt.NodeNames()[1:] {
+		other := path.Join(evt.NodeConfigLocation(name).DaemonConfigDir, "config/genesis.json")
+		otherData, rErr := ioutil.ReadFile(other)
+		switch {
+		case rErr != nil:
+			violation("cannot read the genesis of %s %s: %v", evt.NodeRole(name), name, rErr)
+		case !bytes.Equal(data, otherData):
+			violation("the genesis of %s %s (%s) differs", evt.NodeRole(name), name, other)
+		}
+	}
+
+	if len(gErr.Violations) > 0 {
+		return gErr
+	}
+	log.Infof("genesis %s matches event %s", genesisPath, evt.ID())
+	return nil
+}
+
+// verifyGenesisStep runs VerifyGenesis as a payload configuration step, a
+// plan only records the verification since there are no files to verify
+func verifyGenesisStep(ctx context.Context, settings *config.Schema, evt *model.Event, cmdRunner cmdrunner.CommandRunner) error {
+	if p := plannerFrom(ctx); p != nil {
+		p.check("node 0's genesis.json has the chain id, accounts and gentxs of the event and every node has the same genesis")
+		return nil
+	}
+	log.Infoln("Verifying the genesis.json against the event")
+	return VerifyGenesis(settings, evt)
+}
@@ -0,0 +1,111 @@
+package lctrld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// genesisEvent returns the event of a genesis of testdata, with a copy of the
+// genesis for each validator
+func genesisEvent(t *testing.T, genesisFile string) *model.Event {
+	req, err := model.LoadEventRequestFromFile("../../examples/simple_event_w_faucet.yml")
+	require.Nil(t, err)
+	evt := model.NewEventFromRequest(req)
+	addresses := map[string]string{
+		"alice@apeunit.com": "cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0p",
+		"bob@apeunit.com":   "cosmos1tnets25l2wx0w48ml092vl588zsnhg57lm7a0y",
+		"dropgiver":         "cosmos1wxa3uepnt9yrmqycmh6ygzs4pqt6szjhwmmdm9",
+	}
+	nodeIDs := []string{"ef8b8a4da4e0eb35cc0889295de281ec429358bd", "db3ab829487f76d6d7a10b56c8ca194a8114908b"}
+	genesis, err := ioutil.ReadFile(genesisFile)
+	require.Nil(t, err)
+	v, _ := evt.Validators()
+	for i, name := range v {
+		evt.State[name] = &model.Machine{
+			N:                fmt.Sprint(i),
+			EventID:          evt.ID(),
+			TendermintNodeID: nodeIDs[i],
+			Instance:         model.MachineNetworkConfig{IPAddress: fmt.Sprintf("192.168.99.%d", 100+i)},
+		}
+		daemonDir := filepath.Join(t.TempDir(), "daemon")
+		require.Nil(t, os.MkdirAll(filepath.Join(daemonDir, "config"), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(daemonDir, "config", "genesis.json"), genesis, 0644))
+		evt.Accounts[name].ConfigLocation.DaemonConfigDir = daemonDir
+	}
+	for name, acc := range evt.Accounts {
+		acc.Address = addresses[name]
+	}
+	return evt
+}
+
+func TestVerifyGenesis(t *testing.T) {
+	settings := &config.Schema{Workspace: t.TempDir()}
+	evt := genesisEvent(t, "testdata/genesis.json")
+	assert.Nil(t, VerifyGenesis(settings, evt))
+
+	// the stargate layout of the same genesis
+	stargate := genesisEvent(t, "testdata/genesis_stargate.json")
+	stargate.Payload.Profile = config.ProfileStargate
+	assert.Nil(t, VerifyGenesis(settings, stargate))
+	stargate.Accounts["dropgiver"].GenesisBalance = model.MustParseCoins("10drop")
+	err := VerifyGenesis(settings, stargate)
+	var gErr *GenesisError
+	require.True(t, errors.As(err, &gErr))
+	assert.Equal(t, []string{
+		"account dropgiver (cosmos1wxa3uepnt9yrmqycmh6ygzs4pqt6szjhwmmdm9) has 10000000000drop,10000000000evtx instead of 10drop",
+	}, gErr.Violations)
+
+	evt.Accounts["dropgiver"].GenesisBalance = model.MustParseCoins("10drop")
+	stake := model.NewCoin(model.BondDenom, 50000000)
+	evt.Accounts["alice@apeunit.com"].SelfDelegation = &stake
+	evt.Accounts["bob@apeunit.com"].Address = "cosmos1unknown"
+	evt.GenesisParams = &model.GenesisParams{ChainID: "other-chain"}
+	bobGenesis := filepath.Join(evt.Accounts["bob@apeunit.com"].ConfigLocation.DaemonConfigDir, "config", "genesis.json")
+	require.Nil(t, ioutil.WriteFile(bobGenesis, []byte("{}"), 0644))
+
+	err = VerifyGenesis(settings, evt)
+	require.True(t, errors.As(err, &gErr))
+	assert.ElementsMatch(t, []string{
+		`chain_id is "drop-c34efbd55083665002d2" instead of "other-chain"`,
+		"account bob@apeunit.com (cosmos1unknown) is missing",
+		"account dropgiver (cosmos1wxa3uepnt9yrmqycmh6ygzs4pqt6szjhwmmdm9) has 10000000000drop,10000000000evtx instead of 10drop",
+		"account cosmos1tnets25l2wx0w48ml092vl588zsnhg57lm7a0y is not an account of the event",
+		"validator bob@apeunit.com (cosmos1unknown) has no genesis transaction",
+		"validator alice@apeunit.com (cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0p) delegates 100000000stake instead of 50000000stake",
+		"the genesis of validator bob@apeunit.com (" + bobGenesis + ") differs",
+	}, gErr.Violations)
+}
+
+func TestDeployPayloadVerifiesGenesis(t *testing.T) {
+	settings := &config.Schema{Workspace: t.TempDir()}
+	require.Nil(t, SetupWorkspace(settings))
+	evt := genesisEvent(t, "testdata/genesis.json")
+	evt.GenesisParams = &model.GenesisParams{ChainID: "other-chain"}
+	require.Nil(t, evt.Transition(model.StatusProvisioned, ""))
+	require.Nil(t, evt.Transition(model.StatusConfigured, ""))
+	require.Nil(t, CreateEvent(settings, evt))
+	runner := func(ctx context.Context, command, envVars []string) (string, error) {
+		t.Errorf("%v should not run", command)
+		return "", nil
+	}
+
+	// the refused deploy is recorded in the event status
+	err := DeployPayload(context.Background(), settings, evt, runner)
+	var gErr *GenesisError
+	require.True(t, errors.As(err, &gErr))
+	assert.Equal(t, model.StatusFailed, evt.CurrentStatus())
+	stored, err := LoadEvent(settings, evt.ID())
+	require.Nil(t, err)
+	assert.Equal(t, model.StatusFailed, stored.CurrentStatus())
+	assert.Contains(t, stored.StatusHistory[len(stored.StatusHistory)-1].Reason, `chain_id is "drop-c34efbd55083665002d2" instead of "other-chain"`)
+}
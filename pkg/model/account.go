@@ -1,16 +1,33 @@
 package model
 
+import "github.com/apeunit/LaunchControlD/pkg/secrets"
+
 // Account represents an Account for a Event
 type Account struct {
-	Name           string         `json:"name"`
-	Address        string         `json:"address"`
-	Mnemonic       string         `json:"mnemonic"`
-	GenesisBalance string         `json:"genesis_balance"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	// Mnemonic is sealed when the event is stored and a master key is
+	// configured
+	Mnemonic       secrets.Secret `json:"mnemonic" swaggertype:"string"`
+	GenesisBalance Coins          `json:"genesis_balance" swaggertype:"string"`
+	SelfDelegation *Coin          `json:"self_delegation,omitempty" swaggertype:"string"`
 	Validator      bool           `json:"validator"`
 	Faucet         bool           `json:"faucet"`
+	// External accounts have an address supplied with the event request and
+	// no keys
+	External       bool           `json:"external,omitempty"`
 	ConfigLocation ConfigLocation `json:"config_location"`
 }
 
+// Stake returns the amount a validator stakes in its genesis transaction,
+// that is its self delegation or, if not set, its whole bond denom balance
+func (a *Account) Stake() Coin {
+	if a.SelfDelegation != nil {
+		return *a.SelfDelegation
+	}
+	return Coin{Denom: BondDenom, Amount: a.GenesisBalance.AmountOf(BondDenom)}
+}
+
 // ConfigLocation holds the paths to the configuration files for the Cosmos-SDK
 // based node and CLI.
 type ConfigLocation struct {
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Polymod computes the BCH checksum of bech32 values
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+// ValidateAddress checks that an address is a bech32 account address with
+// the prefix of the payload and a 20 bytes payload
+func ValidateAddress(address, prefix string) error {
+	if len(address) > 90 || strings.ToLower(address) != address {
+		return fmt.Errorf("invalid address %s: not a lowercase bech32 string", address)
+	}
+	sep := strings.LastIndex(address, "1")
+	if sep < 1 || sep+7 > len(address) {
+		return fmt.Errorf("invalid address %s: not a bech32 string", address)
+	}
+	hrp, data := address[:sep], address[sep+1:]
+	if hrp != prefix {
+		return fmt.Errorf("invalid address %s: the prefix must be %s", address, prefix)
+	}
+	values := make([]byte, 0, 2*len(hrp)+1+len(data))
+	for _, c := range hrp {
+		values = append(values, byte(c>>5))
+	}
+	values = append(values, 0)
+	for _, c := range hrp {
+		values = append(values, byte(c&31))
+	}
+	for _, c := range data {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return fmt.Errorf("invalid address %s: invalid character %q", address, c)
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(values) != 1 {
+		return fmt.Errorf("invalid address %s: wrong checksum", address)
+	}
+	// 20 bytes are 32 groups of 5 bits, followed by the 6 checksum groups
+	if len(data)-6 != 32 {
+		return fmt.Errorf("invalid address %s: expected 20 bytes", address)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BondDenom is the denom the payload validators stake
+const BondDenom = "stake"
+
+var (
+	// denomFormat matches a valid denom, as the cosmos-sdk 0.39 does
+	denomFormat = regexp.MustCompile(`^[a-z][a-z0-9/]{2,15}$`)
+	// coinFormat matches a coin, i.e. 500drop
+	coinFormat = regexp.MustCompile(`^([0-9]+)([a-z][a-z0-9/]*)$`)
+)
+
+// Coin is an amount of a denom
+type Coin struct {
+	Denom  string
+	Amount *big.Int
+}
+
+// NewCoin creates a coin
+func NewCoin(denom string, amount int64) Coin {
+	return Coin{Denom: denom, Amount: big.NewInt(amount)}
+}
+
+// ParseCoin parses a coin, i.e. 100000000stake
+func ParseCoin(s string) (c Coin, err error) {
+	m := coinFormat.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return c, fmt.Errorf("invalid coin %q: expected an amount followed by a denom, i.e. 100stake", s)
+	}
+	if !denomFormat.MatchString(m[2]) {
+		return c, fmt.Errorf("invalid denom %q: it must be 3 to 16 lowercase letters, digits or /, starting with a letter", m[2])
+	}
+	amount, _ := new(big.Int).SetString(m[1], 10)
+	if amount.Sign() == 0 {
+		return c, fmt.Errorf("invalid coin %q: the amount must be positive", s)
+	}
+	return Coin{Denom: m[2], Amount: amount}, nil
+}
+
+// String formats the coin as amount followed by denom
+func (c Coin) String() string {
+	if c.Amount == nil {
+		return "0" + c.Denom
+	}
+	return c.Amount.String() + c.Denom
+}
+
+// IsZero tells whenever the coin has no amount
+func (c Coin) IsZero() bool {
+	return c.Amount == nil || c.Amount.Sign() == 0
+}
+
+// MarshalText formats the coin as a string
+func (c Coin) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText parses a coin
+func (c *Coin) UnmarshalText(text []byte) (err error) {
+	*c, err = ParseCoin(string(text))
+	return
+}
+
+// Coins is a set of coins with distinct denoms, sorted by denom
+type Coins []Coin
+
+// ParseCoins parses comma separated coins, i.e. 500drop,100000000stake
+func ParseCoins(s string) (coins Coins, err error) {
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		c, err := ParseCoin(part)
+		if err != nil {
+			return nil, err
+		}
+		if seen[c.Denom] {
+			return nil, fmt.Errorf("invalid coins %q: duplicate denom %s", s, c.Denom)
+		}
+		seen[c.Denom] = true
+		coins = append(coins, c)
+	}
+	coins.sort()
+	return
+}
+
+// MustParseCoins is ParseCoins that panics on invalid coins
+func MustParseCoins(s string) Coins {
+	coins, err := ParseCoins(s)
+	if err != nil {
+		panic(err)
+	}
+	return coins
+}
+
+func (cs Coins) sort() {
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Denom < cs[j].Denom })
+}
+
+// String formats the coins comma separated
+func (cs Coins) String() string {
+	s := make([]string, len(cs))
+	for i, c := range cs {
+		s[i] = c.String()
+	}
+	return strings.Join(s, ",")
+}
+
+// MarshalText formats the coins as a string
+func (cs Coins) MarshalText() ([]byte, error) {
+	return []byte(cs.String()), nil
+}
+
+// UnmarshalText parses comma separated coins
+func (cs *Coins) UnmarshalText(text []byte) (err error) {
+	*cs, err = ParseCoins(string(text))
+	return
+}
+
+// AmountOf returns the amount of a denom, zero if the denom is missing
+func (cs Coins) AmountOf(denom string) *big.Int {
+	for _, c := range cs {
+		if c.Denom == denom {
+			return new(big.Int).Set(c.Amount)
+		}
+	}
+	return new(big.Int)
+}
+
+// Denoms returns the denoms of the coins
+func (cs Coins) Denoms() (denoms []string) {
+	for _, c := range cs {
+		denoms = append(denoms, c.Denom)
+	}
+	return
+}
+
+// Add returns the per denom sum of the coins
+func (cs Coins) Add(others ...Coin) (sum Coins) {
+	totals := make(map[string]*big.Int)
+	for _, c := range append(append([]Coin{}, cs...), others...) {
+		if t, ok := totals[c.Denom]; ok {
+			t.Add(t, c.Amount)
+			continue
+		}
+		totals[c.Denom] = new(big.Int).Set(c.Amount)
+	}
+	for denom, amount := range totals {
+		sum = append(sum, Coin{Denom: denom, Amount: amount})
+	}
+	sum.sort()
+	return
+}
+
+// Sub returns the per denom difference of the coins, it is an error if the
+// result has a negative amount. Denoms with a zero amount are removed.
+func (cs Coins) Sub(others ...Coin) (diff Coins, err error) {
+	negated := make([]Coin, len(others))
+	for i, c := range others {
+		negated[i] = Coin{Denom: c.Denom, Amount: new(big.Int).Neg(c.Amount)}
+	}
+	for _, c := range cs.Add(negated...) {
+		switch c.Amount.Sign() {
+		case -1:
+			return nil, fmt.Errorf("insufficient %s: %s is missing", c.Denom, new(big.Int).Neg(c.Amount))
+		case 1:
+			diff = append(diff, c)
+		}
+	}
+	return
+}
+
+// IsAllGTE tells whenever the coins have at least the amount of each of the
+// other coins
+func (cs Coins) IsAllGTE(others ...Coin) bool {
+	_, err := cs.Sub(others...)
+	return err == nil
+}
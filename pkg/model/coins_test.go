@@ -0,0 +1,55 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseCoins(t *testing.T) {
+	coins, err := ParseCoins("500drop, 100000000000000000000000stake,1000000evtx")
+	require.Nil(t, err)
+	assert.Equal(t, "500drop,1000000evtx,100000000000000000000000stake", coins.String())
+	assert.Equal(t, "100000000000000000000000", coins.AmountOf("stake").String())
+	assert.Equal(t, "0", coins.AmountOf("atom").String())
+
+	for _, invalid := range []string{"drop", "500", "500Drop", "0drop", "-5drop", "5d", "1drop,2drop", "1drop,"} {
+		_, err = ParseCoins(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestCoinsArithmetic(t *testing.T) {
+	a := MustParseCoins("500drop,100stake")
+	sum := a.Add(MustParseCoins("20stake,1evtx")...)
+	assert.Equal(t, "500drop,1evtx,120stake", sum.String())
+	// the operands are untouched
+	assert.Equal(t, "500drop,100stake", a.String())
+
+	diff, err := sum.Sub(NewCoin("drop", 500), NewCoin("stake", 20))
+	assert.Nil(t, err)
+	assert.Equal(t, "1evtx,100stake", diff.String())
+	_, err = a.Sub(NewCoin("stake", 101))
+	assert.EqualError(t, err, "insufficient stake: 1 is missing")
+	assert.True(t, a.IsAllGTE(NewCoin("stake", 100)))
+	assert.False(t, a.IsAllGTE(NewCoin("evtx", 1)))
+}
+
+func TestCoinsEncoding(t *testing.T) {
+	var acc GenesisAccount
+	require.Nil(t, yaml.Unmarshal([]byte("genesis_balance: 100stake,5drop\nself_delegation: 60stake\n"), &acc))
+	assert.Equal(t, "5drop,100stake", acc.GenesisBalance.String())
+	assert.Equal(t, "60stake", acc.SelfDelegation.String())
+
+	data, err := json.Marshal(acc)
+	require.Nil(t, err)
+	assert.Contains(t, string(data), `"genesis_balance":"5drop,100stake","self_delegation":"60stake"`)
+	var decoded GenesisAccount
+	require.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, acc.GenesisBalance.String(), decoded.GenesisBalance.String())
+
+	assert.NotNil(t, yaml.Unmarshal([]byte("genesis_balance: 100 stake\n"), &acc))
+}
@@ -3,8 +3,10 @@ package model
 import (
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
 	"github.com/apeunit/LaunchControlD/pkg/utils"
 	"github.com/gosimple/slug"
 )
@@ -26,6 +28,17 @@ type Event struct {
 	EndsOn      time.Time           `json:"ends_on"`
 	State       map[string]*Machine `json:"state"`
 	Payload     PayloadLocation     `json:"payload"`
+	// overrides of the payload genesis parameters
+	GenesisParams *GenesisParams `json:"genesis_params,omitempty"`
+	// overrides of the node configuration files
+	NodeConfig *NodeConfig `json:"node_config,omitempty"`
+	// the nodes other than the validators, by name
+	Nodes map[string]*Node `json:"nodes,omitempty"`
+	// completed steps of the payload configuration
+	PayloadSteps []string `json:"payload_steps"`
+	// lifecycle of the event
+	Status        EventStatus        `json:"status"`
+	StatusHistory []StatusTransition `json:"status_history"`
 }
 
 // NewEvent helper for a new event
@@ -34,9 +47,11 @@ func NewEvent(symbol, owner, provider string, genesisAccounts []GenesisAccount,
 	for _, acc := range genesisAccounts {
 		accounts[acc.Name] = &Account{
 			Name:           acc.Name,
-			Address:        "",
-			Mnemonic:       "",
+			Address:        acc.Address,
+			Mnemonic:       secrets.Secret(strings.Join(strings.Fields(string(acc.Mnemonic)), " ")),
+			External:       acc.Address != "",
 			GenesisBalance: acc.GenesisBalance,
+			SelfDelegation: acc.SelfDelegation,
 			Validator:      acc.Validator,
 			Faucet:         acc.Faucet,
 			ConfigLocation: ConfigLocation{
@@ -45,19 +60,38 @@ func NewEvent(symbol, owner, provider string, genesisAccounts []GenesisAccount,
 			},
 		}
 	}
+	now := time.Now()
 	return &Event{
 		TokenSymbol: symbol,
 		Owner:       owner,
 		Accounts:    accounts,
 		Provider:    provider,
-		CreatedOn:   time.Now(),
-		StartsOn:    time.Now(),
+		CreatedOn:   now,
+		StartsOn:    now,
 		EndsOn:      time.Time{},
 		State:       make(map[string]*Machine),
 		Payload:     payload,
+		Status:      StatusCreated,
+		StatusHistory: []StatusTransition{
+			{To: StatusCreated, At: now},
+		},
 	}
 }
 
+// NewEventFromRequest creates a new event as described by an event request
+func NewEventFromRequest(req *EventRequest) (e *Event) {
+	e = NewEvent(req.TokenSymbol, req.Owner, req.Provider, req.GenesisAccounts, req.PayloadLocation)
+	e.GenesisParams = req.GenesisParams
+	e.NodeConfig = req.NodeConfig
+	if len(req.Nodes) > 0 {
+		e.Nodes = make(map[string]*Node, len(req.Nodes))
+		for _, n := range req.Nodes {
+			e.Nodes[n.Name] = &Node{Name: n.Name, Role: n.Role, Validator: n.Validator}
+		}
+	}
+	return
+}
+
 // LoadEvent is a convenience function that ensures you don't have to manually
 // create an empty models.Event{} struct and use NewEvent() all the time
 func LoadEvent(path string) (evt *Event, err error) {
@@ -80,6 +114,15 @@ func (e *Event) ID() string {
 	return slug.Make(fmt.Sprintf("%v %v", e.TokenSymbol, e.Hash()))
 }
 
+// ChainID returns the chain id of the event, that is the event ID unless
+// overridden by the genesis parameters
+func (e *Event) ChainID() string {
+	if e.GenesisParams != nil && e.GenesisParams.ChainID != "" {
+		return e.GenesisParams.ChainID
+	}
+	return e.ID()
+}
+
 // NodeID generate a node identifier (determinitstic)
 func (e *Event) NodeID(n int) string {
 	return slug.Make(fmt.Sprintf("%v %v %v", e.TokenSymbol, e.Hash(), n))
@@ -1,7 +1,14 @@
 package model
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
 
 	"gopkg.in/yaml.v2"
 )
@@ -10,27 +17,167 @@ import (
 type EventRequest struct {
 	TokenSymbol     string           `yaml:"token_symbol" json:"token_symbol"`
 	GenesisAccounts []GenesisAccount `yaml:"genesis_accounts" json:"genesis_accounts"`
-	PayloadLocation PayloadLocation  `yaml:"payload_location" json:"payload,omitempty"`
-	Owner           string           `yaml:"owner" json:"owner,omitempty"`
-	Provider        string           `yaml:"provider" json:"provider,omitempty"`
+	// Payload is the name of the payload in the catalog, empty for the
+	// default payload
+	Payload string `yaml:"payload" json:"payload,omitempty" example:"launchpayload"`
+	// PayloadLocation is set from the catalog, it cannot be requested
+	PayloadLocation PayloadLocation `yaml:"-" json:"-"`
+	Owner           string          `yaml:"owner" json:"owner,omitempty"`
+	Provider        string          `yaml:"provider" json:"provider,omitempty"`
+	GenesisParams   *GenesisParams  `yaml:"genesis_params" json:"genesis_params,omitempty"`
+	NodeConfig      *NodeConfig     `yaml:"node_config" json:"node_config,omitempty"`
+	// Nodes are the nodes of the event other than the validators
+	Nodes []NodeRequest `yaml:"nodes" json:"nodes,omitempty"`
+	// Services override the ports, env, resource limits and restart policy
+	// of the services of the payload, by name
+	Services map[string]config.ServiceSpec `yaml:"services" json:"services,omitempty"`
 }
 
 // PayloadLocation holds metadata about the copy of the launchpayload that is
 // stored on the machine running LaunchControlD
 type PayloadLocation struct {
+	// Name is the name of the payload in the catalog
+	Name        string `mapstructure:"name" yaml:"name" json:"name,omitempty"`
 	DockerImage string `mapstructure:"docker_image" yaml:"docker_image" json:"docker_image"`
-	BinaryURL   string `mapstructure:"binary_url" yaml:"binary_url" json:"binary_url"`
-	BinaryPath  string `mapstructure:"binary_path" yaml:"binary_path" json:"binary_path"`
-	DaemonPath  string `mapstructure:"daemon_path" yaml:"daemon_path" json:"daemon_path"`
-	CLIPath     string `mapstructure:"cli_path" yaml:"cli_path" json:"cli_path"`
+	// Version is the release of the payload, only for reference
+	Version    string `mapstructure:"version" yaml:"version" json:"version,omitempty"`
+	BinaryURL  string `mapstructure:"binary_url" yaml:"binary_url" json:"binary_url"`
+	BinaryPath string `mapstructure:"binary_path" yaml:"binary_path" json:"binary_path"`
+	DaemonPath string `mapstructure:"daemon_path" yaml:"daemon_path" json:"daemon_path"`
+	CLIPath    string `mapstructure:"cli_path" yaml:"cli_path" json:"cli_path"`
+	// SHA256 is the checksum of the archive at BinaryURL
+	SHA256 string `mapstructure:"sha256" yaml:"sha256" json:"sha256,omitempty"`
+	// Profile is the payload profile describing the command line syntax of
+	// the payload, see config.PayloadProfile
+	Profile string `mapstructure:"profile" yaml:"profile" json:"profile,omitempty" example:"legacy"`
+	// AddressPrefix is the bech32 prefix of the account addresses, see
+	// config.CatalogPayload
+	AddressPrefix string `mapstructure:"address_prefix" yaml:"address_prefix" json:"address_prefix,omitempty" example:"cosmos"`
+	// Services are the containers deployed on the nodes, the default
+	// services of the profile are deployed when there are none
+	Services []config.ServiceSpec `mapstructure:"services" yaml:"services" json:"services,omitempty"`
 }
 
 // GenesisAccount is the configuration of accounts present in the genesis block
 type GenesisAccount struct {
 	Name           string `yaml:"name" json:"name"`
-	GenesisBalance string `yaml:"genesis_balance" json:"genesis_balance"`
-	Validator      bool   `yaml:"validator" json:"validator"`
-	Faucet         bool   `yaml:"faucet" json:"faucet"`
+	GenesisBalance Coins  `yaml:"genesis_balance" json:"genesis_balance" swaggertype:"string" example:"500drop,100000000stake"`
+	// SelfDelegation is the amount a validator stakes, it defaults to the
+	// whole bond denom balance
+	SelfDelegation *Coin `yaml:"self_delegation" json:"self_delegation,omitempty" swaggertype:"string" example:"100000000stake"`
+	Validator      bool  `yaml:"validator" json:"validator"`
+	Faucet         bool  `yaml:"faucet" json:"faucet"`
+	// Mnemonic recovers the key of the account instead of creating a new one
+	Mnemonic secrets.Secret `yaml:"mnemonic" json:"mnemonic,omitempty" swaggertype:"string"`
+	// Address is an existing address that gets a genesis balance, there are
+	// no keys for it, so it cannot be a validator or the faucet
+	Address string `yaml:"address" json:"address,omitempty"`
+}
+
+// Validate checks that the event request describes a chain that can be
+// configured: named accounts with a balance, and validators staking bond
+// denom coins they own. The addresses are checked with the prefix of the
+// payload set by SetPayload, cosmos if it is not set.
+func (er *EventRequest) Validate() (err error) {
+	if strings.TrimSpace(er.TokenSymbol) == "" {
+		return errors.New("the token_symbol is missing")
+	}
+	if len(er.GenesisAccounts) == 0 {
+		return errors.New("there are no genesis_accounts")
+	}
+	prefix := er.PayloadLocation.AddressPrefix
+	if prefix == "" {
+		prefix = config.DefaultAddressPrefix
+	}
+	names := make(map[string]bool)
+	addresses := make(map[string]bool)
+	var validators []string
+	for _, acc := range er.GenesisAccounts {
+		if strings.TrimSpace(acc.Name) == "" {
+			return errors.New("a genesis account has no name")
+		}
+		if names[acc.Name] {
+			return fmt.Errorf("the genesis account %s is listed twice", acc.Name)
+		}
+		names[acc.Name] = true
+		if len(acc.GenesisBalance) == 0 {
+			return fmt.Errorf("the genesis account %s has no genesis_balance", acc.Name)
+		}
+		if err = acc.validateKeys(prefix); err != nil {
+			return
+		}
+		if acc.Address != "" {
+			if addresses[acc.Address] {
+				return fmt.Errorf("the address of the genesis account %s is used by another account", acc.Name)
+			}
+			addresses[acc.Address] = true
+		}
+		if !acc.Validator {
+			if acc.SelfDelegation != nil {
+				return fmt.Errorf("the genesis account %s has a self_delegation but is not a validator", acc.Name)
+			}
+			continue
+		}
+		validators = append(validators, acc.Name)
+		a := Account{GenesisBalance: acc.GenesisBalance, SelfDelegation: acc.SelfDelegation}
+		stake := a.Stake()
+		if stake.Denom != BondDenom {
+			return fmt.Errorf("the validator %s delegates %s, only %s can be delegated", acc.Name, stake, BondDenom)
+		}
+		if stake.IsZero() {
+			return fmt.Errorf("the validator %s has no %s to delegate", acc.Name, BondDenom)
+		}
+		if !acc.GenesisBalance.IsAllGTE(stake) {
+			return fmt.Errorf("the validator %s delegates %s, more than its genesis_balance %s", acc.Name, stake, acc.GenesisBalance)
+		}
+	}
+	if len(validators) == 0 {
+		return errors.New("there are no validators")
+	}
+	if er.GenesisParams != nil {
+		if err = er.GenesisParams.Validate(); err != nil {
+			return
+		}
+	}
+	if err = validateNodes(er.Nodes, er.GenesisAccounts); err != nil {
+		return
+	}
+	if er.NodeConfig != nil {
+		nodes := validators
+		for _, n := range er.Nodes {
+			nodes = append(nodes, n.Name)
+		}
+		err = er.NodeConfig.Validate(nodes)
+	}
+	return
+}
+
+// validateKeys checks the mnemonic or the address the keys of an account
+// come from
+func (acc *GenesisAccount) validateKeys(prefix string) (err error) {
+	switch {
+	case acc.Mnemonic != "" && acc.Address != "":
+		return fmt.Errorf("the genesis account %s has both a mnemonic and an address, only one can be set", acc.Name)
+	case acc.Mnemonic != "":
+		// do not echo the mnemonic in the errors
+		words := strings.Fields(string(acc.Mnemonic))
+		if n := len(words); n < 12 || n > 24 || n%3 != 0 {
+			return fmt.Errorf("the mnemonic of the genesis account %s has %d words, it must have 12, 15, 18, 21 or 24", acc.Name, n)
+		}
+		for _, w := range words {
+			if strings.Trim(w, "abcdefghijklmnopqrstuvwxyz") != "" {
+				return fmt.Errorf("the mnemonic of the genesis account %s must only have lowercase words", acc.Name)
+			}
+		}
+	case acc.Address != "":
+		if err = ValidateAddress(acc.Address, prefix); err != nil {
+			return fmt.Errorf("the genesis account %s has an %w", acc.Name, err)
+		}
+		if acc.Validator || acc.Faucet {
+			return fmt.Errorf("the genesis account %s has an address without keys, it cannot be a validator or the faucet", acc.Name)
+		}
+	}
+	return
 }
 
 // LoadEventRequestFromFile is as convenience function to unmarshal a EventRequest from a YAML file
@@ -46,10 +193,57 @@ func LoadEventRequestFromFile(path string) (eq *EventRequest, err error) {
 	return eq, nil
 }
 
+// SetPayload sets the payload location and the services of the event request
+// from the payload of the catalog it chooses
+func (er *EventRequest) SetPayload(settings *config.Schema) (err error) {
+	payload, err := settings.CatalogPayload(er.Payload)
+	if err != nil {
+		return
+	}
+	services, err := settings.PayloadServices(payload, er.Services)
+	if err != nil {
+		return
+	}
+	for _, s := range services {
+		for _, n := range s.Nodes {
+			switch NodeRole(n) {
+			case config.NodesAll, config.NodesServices, RoleValidator, RoleFullNode, RoleSeed, RoleSentry:
+			default:
+				return fmt.Errorf("service %s of the payload %s runs on unknown nodes %s", s.Name, payload.Name, n)
+			}
+		}
+	}
+	er.PayloadLocation = NewPayloadLocation(payload, settings.Bin(""))
+	er.PayloadLocation.Services = services
+	return
+}
+
+// NewPayloadLocation returns the location of a payload of the catalog, the
+// binaries are in binDir until they are resolved to the payload cache
+func NewPayloadLocation(p config.CatalogPayload, binDir string) PayloadLocation {
+	cli := p.CLI
+	if cli == "" {
+		cli = p.Daemon
+	}
+	return PayloadLocation{
+		Name:          p.Name,
+		DockerImage:   p.DockerImage,
+		Version:       p.Version,
+		BinaryURL:     p.BinaryURL,
+		BinaryPath:    binDir,
+		DaemonPath:    filepath.Join(binDir, p.Daemon),
+		CLIPath:       filepath.Join(binDir, cli),
+		SHA256:        p.SHA256,
+		Profile:       p.Profile,
+		AddressPrefix: p.AddressPrefix,
+	}
+}
+
 // NewDefaultPayloadLocation is a placeholder to help code refactoring and reduce import cycles
 func NewDefaultPayloadLocation() PayloadLocation {
 	return PayloadLocation{
 		DockerImage: "apeunit/launchpayload:v1.0.0",
+		Version:     "v0.0.0",
 		BinaryURL:   "https://github.com/apeunit/LaunchPayload/releases/download/v0.0.0/launchpayload-v0.0.0.zip",
 		BinaryPath:  "/tmp/workspace/bin",
 		DaemonPath:  "/tmp/workspace/bin/launchpayloadd",
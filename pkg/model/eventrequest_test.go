@@ -0,0 +1,71 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventRequestValidate(t *testing.T) {
+	er, err := LoadEventRequestFromFile("../../examples/simple_event_w_faucet.yml")
+	require.Nil(t, err)
+	assert.Nil(t, er.Validate())
+
+	stake := func(s string) *Coin {
+		c, err := ParseCoin(s)
+		require.Nil(t, err)
+		return &c
+	}
+	er.GenesisAccounts[0].SelfDelegation = stake("1000stake")
+	assert.Nil(t, er.Validate())
+
+	er.GenesisAccounts[0].SelfDelegation = stake("100000001stake")
+	assert.EqualError(t, er.Validate(), "the validator alice@apeunit.com delegates 100000001stake, more than its genesis_balance 500drop,1000000evtx,100000000stake")
+
+	er.GenesisAccounts[0].SelfDelegation = stake("500drop")
+	assert.EqualError(t, er.Validate(), "the validator alice@apeunit.com delegates 500drop, only stake can be delegated")
+
+	er.GenesisAccounts[0].SelfDelegation = nil
+	er.GenesisAccounts[1].GenesisBalance = MustParseCoins("500drop")
+	assert.EqualError(t, er.Validate(), "the validator bob@apeunit.com has no stake to delegate")
+
+	er.GenesisAccounts[1] = er.GenesisAccounts[0]
+	assert.EqualError(t, er.Validate(), "the genesis account alice@apeunit.com is listed twice")
+
+	er.GenesisAccounts[1] = GenesisAccount{Name: "bob@apeunit.com", GenesisBalance: MustParseCoins("100stake"), Validator: true, Mnemonic: "one two three"}
+	assert.EqualError(t, er.Validate(), "the mnemonic of the genesis account bob@apeunit.com has 3 words, it must have 12, 15, 18, 21 or 24")
+	er.GenesisAccounts[1].Mnemonic = secrets.Secret(strings.TrimSpace(strings.Repeat("abandon ", 11)) + " about")
+	assert.Nil(t, er.Validate())
+	// the debug dumps of the request do not print the mnemonics
+	assert.NotContains(t, fmt.Sprintf("%#v", er), "abandon")
+
+	er.GenesisAccounts[2].Address = "cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0p"
+	assert.EqualError(t, er.Validate(), "the genesis account dropgiver has an address without keys, it cannot be a validator or the faucet")
+	er.GenesisAccounts[2].Faucet = false
+	assert.Nil(t, er.Validate())
+	// the address prefix is the one of the payload
+	er.PayloadLocation.AddressPrefix = "terra"
+	assert.EqualError(t, er.Validate(), "the genesis account dropgiver has an invalid address cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0p: the prefix must be terra")
+	er.GenesisAccounts[2].Address = "terra1dgax2lq5gttc5x7tfmca69z480hhtm4dghdsdp"
+	assert.Nil(t, er.Validate())
+	er.GenesisAccounts[2].Mnemonic = er.GenesisAccounts[1].Mnemonic
+	assert.EqualError(t, er.Validate(), "the genesis account dropgiver has both a mnemonic and an address, only one can be set")
+}
+
+func TestValidateAddress(t *testing.T) {
+	assert.Nil(t, ValidateAddress("cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0p", "cosmos"))
+	assert.Nil(t, ValidateAddress("terra1dgax2lq5gttc5x7tfmca69z480hhtm4dghdsdp", "terra"))
+	for _, invalid := range []string{
+		"cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0q", // checksum
+		"COSMOS1DGAX2LQ5GTTC5X7TFMCA69Z480HHTM4DWNHS0P", // uppercase
+		"terra1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhs0p",  // prefix
+		"cosmos1dgax2lq5gttc5x7tfmca69z480hhtm4dwnhsbp", // character
+		"cosmos",
+	} {
+		assert.NotNil(t, ValidateAddress(invalid, "cosmos"), invalid)
+	}
+}
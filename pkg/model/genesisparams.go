@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxChainIDLength is the maximum length of a Tendermint chain id
+const maxChainIDLength = 50
+
+// decimalFraction matches a decimal between 0 and 1 with the precision of
+// the cosmos-sdk decimals
+var decimalFraction = regexp.MustCompile(`^(0(\.\d{1,18})?|1(\.0{1,18})?)$`)
+
+// GenesisParams overrides the parameters of the genesis.json generated by the
+// payload, empty fields keep the payload defaults
+type GenesisParams struct {
+	// ChainID replaces the event ID as chain id
+	ChainID string `yaml:"chain_id" json:"chain_id,omitempty"`
+	// GenesisTime is the RFC3339 time the chain starts producing blocks
+	GenesisTime string `yaml:"genesis_time" json:"genesis_time,omitempty"`
+	// UnbondingTime is the staking unbonding time, i.e. "10m"
+	UnbondingTime string `yaml:"unbonding_time" json:"unbonding_time,omitempty"`
+	// MaxValidators is the maximum number of bonded validators
+	MaxValidators int `yaml:"max_validators" json:"max_validators,omitempty"`
+	// VotingPeriod is the governance proposals voting period, i.e. "5m"
+	VotingPeriod string `yaml:"voting_period" json:"voting_period,omitempty"`
+	// Inflation is the fixed yearly inflation rate, i.e. "0.05"
+	Inflation string `yaml:"inflation" json:"inflation,omitempty"`
+	// BlockMaxGas is the maximum gas of a block, -1 means no limit
+	BlockMaxGas int64 `yaml:"block_max_gas" json:"block_max_gas,omitempty"`
+}
+
+// Validate checks the format of the genesis parameters
+func (p *GenesisParams) Validate() (err error) {
+	if len(p.ChainID) > maxChainIDLength || strings.ContainsAny(p.ChainID, " \t\n") {
+		return fmt.Errorf("invalid chain_id %q: it must be at most %d characters without spaces", p.ChainID, maxChainIDLength)
+	}
+	if p.GenesisTime != "" {
+		if _, err = time.Parse(time.RFC3339, p.GenesisTime); err != nil {
+			return fmt.Errorf("invalid genesis_time %q: %w", p.GenesisTime, err)
+		}
+	}
+	for name, d := range map[string]string{"unbonding_time": p.UnbondingTime, "voting_period": p.VotingPeriod} {
+		if _, err = ParseGenesisDuration(d); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", name, d, err)
+		}
+	}
+	if p.MaxValidators < 0 || p.MaxValidators > 65535 {
+		return fmt.Errorf("invalid max_validators %d: it must be between 1 and 65535", p.MaxValidators)
+	}
+	if p.Inflation != "" && !decimalFraction.MatchString(p.Inflation) {
+		return fmt.Errorf("invalid inflation %q: it must be a decimal between 0 and 1", p.Inflation)
+	}
+	if p.BlockMaxGas < -1 {
+		return fmt.Errorf("invalid block_max_gas %d: it must be -1 or positive", p.BlockMaxGas)
+	}
+	return
+}
+
+// ParseGenesisDuration parses a duration of the genesis parameters, an empty
+// duration is zero
+func ParseGenesisDuration(s string) (d time.Duration, err error) {
+	if s == "" {
+		return
+	}
+	if d, err = time.ParseDuration(s); err != nil {
+		return
+	}
+	if d <= 0 {
+		err = fmt.Errorf("the duration must be positive")
+	}
+	return
+}
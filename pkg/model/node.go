@@ -0,0 +1,137 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NodeRole is the role of a node in the network of an event
+type NodeRole string
+
+// Node roles
+const (
+	// RoleValidator nodes sign blocks, they are the genesis accounts with
+	// validator: true
+	RoleValidator NodeRole = "validator"
+	// RoleFullNode nodes follow the chain, they run the light client and the
+	// faucet if there is one
+	RoleFullNode NodeRole = "full"
+	// RoleSeed nodes only crawl the network to share the peers addresses
+	RoleSeed NodeRole = "seed"
+	// RoleSentry nodes shield a validator, which only connects to its sentries
+	RoleSentry NodeRole = "sentry"
+)
+
+// NodeRequest is a node of the event that is not a validator
+type NodeRequest struct {
+	Name string   `yaml:"name" json:"name"`
+	Role NodeRole `yaml:"role" json:"role" enums:"full,seed,sentry"`
+	// Validator is the validator shielded by a sentry
+	Validator string `yaml:"validator" json:"validator,omitempty"`
+}
+
+// Node is a node of the event that is not a validator, the validator nodes
+// are described by their account
+type Node struct {
+	Name           string         `json:"name"`
+	Role           NodeRole       `json:"role"`
+	Validator      string         `json:"validator,omitempty"`
+	ConfigLocation ConfigLocation `json:"config_location"`
+}
+
+// validateNodes checks the nodes of an event request against its accounts
+func validateNodes(nodes []NodeRequest, accounts []GenesisAccount) (err error) {
+	validators := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, acc := range accounts {
+		names[acc.Name] = true
+		validators[acc.Name] = acc.Validator
+	}
+	for _, n := range nodes {
+		if strings.TrimSpace(n.Name) == "" {
+			return errors.New("a node has no name")
+		}
+		if names[n.Name] {
+			return fmt.Errorf("the node name %s is used by another node or account", n.Name)
+		}
+		names[n.Name] = true
+		switch n.Role {
+		case RoleFullNode, RoleSeed:
+			if n.Validator != "" {
+				return fmt.Errorf("the node %s is a %s node, only sentries shield a validator", n.Name, n.Role)
+			}
+		case RoleSentry:
+			if !validators[n.Validator] {
+				return fmt.Errorf("the sentry %s must shield a validator, %q is not one", n.Name, n.Validator)
+			}
+		case RoleValidator:
+			return fmt.Errorf("the node %s cannot be a validator, validators are the genesis accounts with validator: true", n.Name)
+		default:
+			return fmt.Errorf("the node %s has an invalid role %q, it must be %s, %s or %s", n.Name, n.Role, RoleFullNode, RoleSeed, RoleSentry)
+		}
+	}
+	return
+}
+
+// NodeNames returns the names of all the nodes of the event: the validators,
+// then the other nodes sorted by name. The position of a node is the N of
+// its machine.
+func (e *Event) NodeNames() (names []string) {
+	names, _ = e.Validators()
+	others := make([]string, 0, len(e.Nodes))
+	for name := range e.Nodes {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+// NodeRole returns the role of a node, empty if there is no such node
+func (e *Event) NodeRole(name string) NodeRole {
+	if n, found := e.Nodes[name]; found {
+		return n.Role
+	}
+	if acc, found := e.Accounts[name]; found && acc.Validator {
+		return RoleValidator
+	}
+	return ""
+}
+
+// NodeConfigLocation returns the configuration folders of a node, nil if
+// there is no such node
+func (e *Event) NodeConfigLocation(name string) *ConfigLocation {
+	if n, found := e.Nodes[name]; found {
+		return &n.ConfigLocation
+	}
+	if acc, found := e.Accounts[name]; found && acc.Validator {
+		return &acc.ConfigLocation
+	}
+	return nil
+}
+
+// Sentries returns the names of the sentries shielding a validator
+func (e *Event) Sentries(validator string) (sentries []string) {
+	for _, name := range e.NodeNames() {
+		if n := e.Nodes[name]; n != nil && n.Role == RoleSentry && n.Validator == validator {
+			sentries = append(sentries, name)
+		}
+	}
+	return
+}
+
+// ServicesNode returns the node running the light client and the faucet, the
+// first full node or, if there are none, the first validator
+func (e *Event) ServicesNode() string {
+	names := e.NodeNames()
+	for _, name := range names {
+		if e.NodeRole(name) == RoleFullNode {
+			return name
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
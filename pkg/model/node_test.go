@@ -0,0 +1,43 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodes(t *testing.T) {
+	er, err := LoadEventRequestFromFile("../../examples/sentry_event.yml")
+	require.Nil(t, err)
+	require.Nil(t, er.Validate())
+	evt := NewEventFromRequest(er)
+
+	// the validators come first, so their machines keep their number
+	assert.Equal(t, []string{"alice@apeunit.com", "bob@apeunit.com", "alice-sentry", "rpc", "seed"}, evt.NodeNames())
+	assert.Equal(t, RoleValidator, evt.NodeRole("bob@apeunit.com"))
+	assert.Equal(t, RoleSentry, evt.NodeRole("alice-sentry"))
+	assert.Equal(t, NodeRole(""), evt.NodeRole("dropgiver"))
+	assert.Nil(t, evt.NodeConfigLocation("dropgiver"))
+	assert.Equal(t, []string{"alice-sentry"}, evt.Sentries("alice@apeunit.com"))
+	assert.Empty(t, evt.Sentries("bob@apeunit.com"))
+	assert.Equal(t, "rpc", evt.ServicesNode())
+	delete(evt.Nodes, "rpc")
+	assert.Equal(t, "alice@apeunit.com", evt.ServicesNode())
+
+	nodes := er.Nodes
+	for _, tc := range []struct {
+		node NodeRequest
+		err  string
+	}{
+		{NodeRequest{Name: "dropgiver", Role: RoleFullNode}, "the node name dropgiver is used by another node or account"},
+		{NodeRequest{Name: "rpc", Role: RoleFullNode}, "the node name rpc is used by another node or account"},
+		{NodeRequest{Name: "archive", Role: "archive"}, `the node archive has an invalid role "archive", it must be full, seed or sentry`},
+		{NodeRequest{Name: "bob-sentry", Role: RoleSentry, Validator: "dropgiver"}, `the sentry bob-sentry must shield a validator, "dropgiver" is not one`},
+		{NodeRequest{Name: "rpc-2", Role: RoleFullNode, Validator: "bob@apeunit.com"}, "the node rpc-2 is a full node, only sentries shield a validator"},
+		{NodeRequest{Name: "carol", Role: RoleValidator}, "the node carol cannot be a validator, validators are the genesis accounts with validator: true"},
+	} {
+		er.Nodes = append(append([]NodeRequest{}, nodes...), tc.node)
+		assert.EqualError(t, er.Validate(), tc.err)
+	}
+}
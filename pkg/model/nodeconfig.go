@@ -0,0 +1,112 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// lctrldConfigKeys are the config.toml keys set by lctrld, they cannot be
+// overridden
+var lctrldConfigKeys = map[string]bool{
+	"p2p.persistent_peers": true,
+	"p2p.seeds":            true,
+	"p2p.private_peer_ids": true,
+	"p2p.seed_mode":        true,
+	"p2p.pex":              true,
+	"rpc.laddr":            true,
+}
+
+// ConfigOverrides are the values to set in the node configuration files, by
+// dotted key path, i.e. consensus.timeout_commit
+type ConfigOverrides struct {
+	// Config overrides config.toml
+	Config map[string]interface{} `yaml:"config" json:"config,omitempty"`
+	// App overrides app.toml
+	App map[string]interface{} `yaml:"app" json:"app,omitempty"`
+}
+
+// NodeConfig overrides the configuration files of the nodes, the overrides
+// of a node take precedence over the ones for all the nodes
+type NodeConfig struct {
+	ConfigOverrides `yaml:",inline"`
+	// Nodes are the overrides of specific nodes, by node name
+	Nodes map[string]ConfigOverrides `yaml:"nodes" json:"nodes,omitempty"`
+}
+
+// For returns the overrides of a node
+func (nc *NodeConfig) For(node string) (o ConfigOverrides) {
+	o = ConfigOverrides{Config: make(map[string]interface{}), App: make(map[string]interface{})}
+	for _, src := range []ConfigOverrides{nc.ConfigOverrides, nc.Nodes[node]} {
+		for k, v := range src.Config {
+			o.Config[k] = v
+		}
+		for k, v := range src.App {
+			o.App[k] = v
+		}
+	}
+	return
+}
+
+// Validate checks the format of the overrides and that they are for nodes of
+// the event, the keys are checked against the configuration files when they
+// are applied
+func (nc *NodeConfig) Validate(nodes []string) (err error) {
+	if err = nc.ConfigOverrides.validate("node_config"); err != nil {
+		return
+	}
+	isNode := make(map[string]bool)
+	for _, n := range nodes {
+		isNode[n] = true
+	}
+	names := make([]string, 0, len(nc.Nodes))
+	for name := range nc.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !isNode[name] {
+			return fmt.Errorf("node_config has overrides for %s, which is not a node of the event", name)
+		}
+		if err = nc.Nodes[name].validate("node_config of " + name); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// validate checks the key paths and the values of the overrides
+func (o ConfigOverrides) validate(where string) (err error) {
+	for file, overrides := range map[string]map[string]interface{}{"config": o.Config, "app": o.App} {
+		for key, value := range overrides {
+			for _, k := range strings.Split(key, ".") {
+				if strings.TrimSpace(k) == "" {
+					return fmt.Errorf("%s: invalid %s key %q", where, file, key)
+				}
+			}
+			if file == "config" && lctrldConfigKeys[key] {
+				return fmt.Errorf("%s: %s is set by lctrld and cannot be overridden", where, key)
+			}
+			if !isConfigValue(value) {
+				return fmt.Errorf("%s: the %s key %s must be a string, a number, a boolean or a list of them, use dotted keys to set tables", where, file, key)
+			}
+		}
+	}
+	return
+}
+
+// isConfigValue tells whenever a value can be set in a configuration file
+func isConfigValue(value interface{}) bool {
+	switch v := value.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return true
+	case []interface{}:
+		for _, e := range v {
+			if _, isList := e.([]interface{}); isList || !isConfigValue(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeConfig(t *testing.T) {
+	er, err := LoadEventRequestFromFile("../../examples/workshop_event.yml")
+	require.Nil(t, err)
+	require.Nil(t, er.Validate())
+	nc := er.NodeConfig
+	require.NotNil(t, nc)
+
+	// the overrides of a node take precedence
+	alice := nc.For("alice@apeunit.com")
+	assert.Equal(t, "everything", alice.App["pruning"])
+	assert.Equal(t, "0.025gov", alice.App["minimum-gas-prices"])
+	assert.Equal(t, true, alice.Config["instrumentation.prometheus"])
+	assert.Equal(t, "nothing", nc.For("bob@apeunit.com").App["pruning"])
+
+	validators := []string{"alice@apeunit.com", "bob@apeunit.com"}
+	nc.Nodes["govgiver"] = ConfigOverrides{App: map[string]interface{}{"pruning": "nothing"}}
+	assert.EqualError(t, nc.Validate(validators), "node_config has overrides for govgiver, which is not a node of the event")
+	delete(nc.Nodes, "govgiver")
+
+	nc.Config["p2p.persistent_peers"] = ""
+	assert.EqualError(t, nc.Validate(validators), "node_config: p2p.persistent_peers is set by lctrld and cannot be overridden")
+	delete(nc.Config, "p2p.persistent_peers")
+
+	// the peer exchange is disabled on the validators behind sentries
+	nc.Config["p2p.pex"] = true
+	assert.EqualError(t, nc.Validate(validators), "node_config: p2p.pex is set by lctrld and cannot be overridden")
+	delete(nc.Config, "p2p.pex")
+
+	nc.Config["consensus..timeout_commit"] = "1s"
+	assert.EqualError(t, nc.Validate(validators), `node_config: invalid config key "consensus..timeout_commit"`)
+	delete(nc.Config, "consensus..timeout_commit")
+
+	nc.App["pruning"] = map[interface{}]interface{}{"keep": 1}
+	assert.EqualError(t, nc.Validate(validators), "node_config: the app key pruning must be a string, a number, a boolean or a list of them, use dotted keys to set tables")
+	nc.App["pruning"] = []interface{}{"a", 1}
+	assert.Nil(t, nc.Validate(validators))
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EventStatus is the lifecycle status of an event
+type EventStatus string
+
+// Lifecycle statuses of an event
+const (
+	StatusCreated     EventStatus = "created"
+	StatusProvisioned EventStatus = "provisioned"
+	StatusConfigured  EventStatus = "configured"
+	StatusDeployed    EventStatus = "deployed"
+	StatusFailed      EventStatus = "failed"
+	StatusTornDown    EventStatus = "torn_down"
+)
+
+// ErrInvalidTransition is returned when an event is asked to move to a status
+// that cannot be reached from the current one
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// transitions lists, for each status, the statuses that can follow it.
+// Failed and torn down are handled separately: any live event can fail or be
+// torn down, and a failed event behaves like the last status it reached
+// before failing, so the step that failed can be retried. A deployed event
+// is configured again once its payload is undeployed.
+var transitions = map[EventStatus][]EventStatus{
+	StatusCreated:     {StatusProvisioned},
+	StatusProvisioned: {StatusConfigured},
+	StatusConfigured:  {StatusConfigured, StatusDeployed},
+	StatusDeployed:    {StatusConfigured, StatusDeployed},
+}
+
+// StatusTransition records a change in the lifecycle status of an event
+type StatusTransition struct {
+	From   EventStatus `json:"from"`
+	To     EventStatus `json:"to"`
+	Reason string      `json:"reason,omitempty"`
+	At     time.Time   `json:"at"`
+}
+
+// CurrentStatus returns the lifecycle status of the event. Events stored
+// before the status was tracked get one inferred from their content.
+func (e *Event) CurrentStatus() EventStatus {
+	if e.Status != "" {
+		return e.Status
+	}
+	if len(e.State) == 0 {
+		return StatusCreated
+	}
+	for _, m := range e.State {
+		if m.TendermintNodeID != "" {
+			return StatusConfigured
+		}
+	}
+	return StatusProvisioned
+}
+
+// EffectiveStatus returns the current status, or for failed events the last
+// status that was reached before the failure
+func (e *Event) EffectiveStatus() EventStatus {
+	current := e.CurrentStatus()
+	if current != StatusFailed {
+		return current
+	}
+	for i := len(e.StatusHistory) - 1; i >= 0; i-- {
+		if t := e.StatusHistory[i]; t.To == StatusFailed && t.From != StatusFailed && t.From != "" {
+			return t.From
+		}
+	}
+	return StatusCreated
+}
+
+// LastTransition returns the most recent status transition, nil if there is none
+func (e *Event) LastTransition() *StatusTransition {
+	if len(e.StatusHistory) == 0 {
+		return nil
+	}
+	return &e.StatusHistory[len(e.StatusHistory)-1]
+}
+
+// CanTransition tells whenever the event can move to the status to
+func (e *Event) CanTransition(to EventStatus) error {
+	current := e.CurrentStatus()
+	if current == StatusTornDown {
+		return fmt.Errorf("%w: event %s has been torn down", ErrInvalidTransition, e.ID())
+	}
+	if to == StatusFailed || to == StatusTornDown {
+		return nil
+	}
+	from := e.EffectiveStatus()
+	for _, s := range transitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: event %s is %s and cannot become %s", ErrInvalidTransition, e.ID(), from, to)
+}
+
+// Transition moves the event to the status to, recording the reason and time
+// of the change
+func (e *Event) Transition(to EventStatus, reason string) (err error) {
+	if err = e.CanTransition(to); err != nil {
+		return
+	}
+	e.StatusHistory = append(e.StatusHistory, StatusTransition{
+		From:   e.CurrentStatus(),
+		To:     to,
+		Reason: reason,
+		At:     time.Now(),
+	})
+	e.Status = to
+	return
+}
+
+// Fail marks the event as failed, using the error as the reason
+func (e *Event) Fail(cause error) {
+	reason := "unknown error"
+	if cause != nil {
+		reason = cause.Error()
+	}
+	// only a torn down event cannot fail, in that case there is nothing to record
+	e.Transition(StatusFailed, reason)
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventTransitions(t *testing.T) {
+	evt := NewEvent("drop", "owner@email.com", "virtualbox", nil, PayloadLocation{})
+	assert.Equal(t, StatusCreated, evt.CurrentStatus())
+
+	// skipping a step is not allowed
+	err := evt.Transition(StatusDeployed, "")
+	assert.True(t, errors.Is(err, ErrInvalidTransition))
+
+	assert.Nil(t, evt.Transition(StatusProvisioned, ""))
+	evt.Fail(errors.New("payload download failed"))
+	assert.Equal(t, StatusFailed, evt.CurrentStatus())
+	assert.Equal(t, StatusProvisioned, evt.EffectiveStatus())
+	assert.Equal(t, "payload download failed", evt.LastTransition().Reason)
+
+	// the failed step can be retried
+	assert.Nil(t, evt.Transition(StatusConfigured, ""))
+	assert.Nil(t, evt.Transition(StatusDeployed, ""))
+	assert.Nil(t, evt.Transition(StatusTornDown, ""))
+	assert.NotNil(t, evt.CanTransition(StatusFailed))
+	assert.Len(t, evt.StatusHistory, 6)
+}
+
+func TestEventLegacyStatus(t *testing.T) {
+	evt := &Event{State: map[string]*Machine{"alice": {N: "0"}}}
+	assert.Equal(t, StatusProvisioned, evt.CurrentStatus())
+	evt.State["alice"].TendermintNodeID = "abc"
+	assert.Equal(t, StatusConfigured, evt.CurrentStatus())
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// PassphraseIterations is the number of PBKDF2 iterations deriving the key
+// from a passphrase
+const PassphraseIterations = 100000
+
+// saltedMagic starts the files encrypted by openssl enc
+var saltedMagic = []byte("Salted__")
+
+// EncryptWithPassphrase encrypts data in the format of openssl enc, so it can
+// be decrypted with "openssl enc -d -aes-256-cbc -pbkdf2 -iter 100000"
+func EncryptWithPassphrase(data []byte, passphrase string) (encrypted []byte, err error) {
+	if passphrase == "" {
+		return nil, errors.New("the passphrase is empty")
+	}
+	salt := make([]byte, 8)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return
+	}
+	block, iv, err := passphraseCipher(passphrase, salt)
+	if err != nil {
+		return
+	}
+	// PKCS#7 padding
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted = append(append([]byte{}, saltedMagic...), salt...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	return append(encrypted, ciphertext...), nil
+}
+
+// DecryptWithPassphrase decrypts the output of EncryptWithPassphrase
+func DecryptWithPassphrase(encrypted []byte, passphrase string) (data []byte, err error) {
+	header := len(saltedMagic) + 8
+	if len(encrypted) < header+aes.BlockSize || !bytes.HasPrefix(encrypted, saltedMagic) || (len(encrypted)-header)%aes.BlockSize != 0 {
+		return nil, errors.New("the data is not encrypted with a passphrase")
+	}
+	block, iv, err := passphraseCipher(passphrase, encrypted[len(saltedMagic):header])
+	if err != nil {
+		return
+	}
+	data = make([]byte, len(encrypted)-header)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, encrypted[header:])
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(data[len(data)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("wrong passphrase")
+	}
+	return data[:len(data)-padding], nil
+}
+
+// passphraseCipher derives the AES-256 key and the IV from the passphrase
+func passphraseCipher(passphrase string, salt []byte) (block cipher.Block, iv []byte, err error) {
+	derived := pbkdf2.Key([]byte(passphrase), salt, PassphraseIterations, 32+aes.BlockSize, sha256.New)
+	block, err = aes.NewCipher(derived[:32])
+	return block, derived[32:], err
+}
@@ -0,0 +1,255 @@
+// Package secrets encrypts the secrets stored in the workspace, like the
+// mnemonics of the event accounts.
+//
+// Secrets are envelope encrypted: each secret is encrypted with AES-256-GCM
+// using a random data key, and the data key is encrypted with the master key.
+// The sealed secret records the id of the master key, so secrets sealed by
+// a previous master key can be recognized and re-encrypted.
+//
+// The TLS certificates and SSH keys of docker-machine are not encrypted,
+// docker-machine reads them from the event folder on every command. They are
+// only readable by the lctrld user and are deleted with the event.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+)
+
+// MasterKeyEnv is the environment variable that holds the master key, it
+// takes precedence over the configuration
+const MasterKeyEnv = "LCTRLD_MASTER_KEY"
+
+// KeySize is the size in bytes of the master key
+const KeySize = 32
+
+// sealedPrefix marks a sealed secret, followed by the master key id, the
+// encrypted data key and the encrypted secret
+const sealedPrefix = "enc:v1:"
+
+var (
+	// ErrorNoMasterKey is returned when opening a sealed secret without a master key
+	ErrorNoMasterKey = errors.New("the secret is encrypted but no master key is configured")
+	// ErrorUnknownKey is returned when a secret was sealed with another master key
+	ErrorUnknownKey = errors.New("the secret is encrypted with an unknown master key")
+)
+
+// Secret is a sensitive value, in plaintext or sealed by a Keeper
+type Secret string
+
+// IsSealed tells whenever the secret is encrypted
+func (s Secret) IsSealed() bool {
+	return strings.HasPrefix(string(s), sealedPrefix)
+}
+
+// GoString redacts the secret when it is printed with %#v, i.e. in the debug
+// dumps of the events
+func (s Secret) GoString() string {
+	if s == "" {
+		return `""`
+	}
+	return `"REDACTED"`
+}
+
+// KeyID returns the id of the master key that sealed the secret, empty for
+// plaintext secrets
+func (s Secret) KeyID() string {
+	if !s.IsSealed() {
+		return ""
+	}
+	return strings.SplitN(strings.TrimPrefix(string(s), sealedPrefix), ":", 2)[0]
+}
+
+// Keeper seals and opens secrets with a master key. A nil Keeper keeps the
+// secrets in plaintext.
+type Keeper struct {
+	id   string
+	keys map[string][]byte
+}
+
+// NewKeeper creates a keeper sealing the secrets with a master key
+func NewKeeper(masterKey []byte) (k *Keeper, err error) {
+	if len(masterKey) != KeySize {
+		return nil, fmt.Errorf("the master key must be %d bytes, got %d", KeySize, len(masterKey))
+	}
+	id := keyID(masterKey)
+	return &Keeper{id: id, keys: map[string][]byte{id: masterKey}}, nil
+}
+
+// FromSettings creates the keeper for the master key in the environment
+// variable LCTRLD_MASTER_KEY, in the configuration or in the configured key
+// file, in this order. The keeper is nil if there is no master key.
+func FromSettings(settings *config.Schema) (k *Keeper, err error) {
+	encoded := os.Getenv(MasterKeyEnv)
+	if encoded == "" {
+		encoded = settings.Secrets.MasterKey
+	}
+	if encoded == "" && settings.Secrets.KeyFile != "" {
+		if encoded, err = ReadKeyFile(settings.Secrets.KeyFile); err != nil {
+			return
+		}
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := DecodeKey(encoded)
+	if err != nil {
+		return
+	}
+	return NewKeeper(key)
+}
+
+// GenerateKey returns a new random master key, base64 encoded
+func GenerateKey() (encoded string, err error) {
+	key := make([]byte, KeySize)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// DecodeKey decodes a base64 encoded master key
+func DecodeKey(encoded string) (key []byte, err error) {
+	key, err = base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("the master key is not valid base64: %w", err)
+	}
+	return
+}
+
+// ReadKeyFile reads a base64 encoded master key from a file
+func ReadKeyFile(path string) (encoded string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// keyID identifies a master key without revealing it
+func keyID(key []byte) string {
+	h := sha256.Sum256(key)
+	return hex.EncodeToString(h[:4])
+}
+
+// ID returns the id of the master key sealing new secrets
+func (k *Keeper) ID() string {
+	if k == nil {
+		return ""
+	}
+	return k.id
+}
+
+// Trust allows the keeper to open the secrets sealed by another keeper,
+// the secrets are still sealed with the keeper own master key
+func (k *Keeper) Trust(other *Keeper) {
+	if k == nil || other == nil {
+		return
+	}
+	for id, key := range other.keys {
+		k.keys[id] = key
+	}
+}
+
+// Seal encrypts a plaintext secret, sealed secrets are returned unchanged
+func (k *Keeper) Seal(s Secret) (sealed Secret, err error) {
+	if k == nil || s == "" || s.IsSealed() {
+		return s, nil
+	}
+	dataKey := make([]byte, KeySize)
+	if _, err = io.ReadFull(rand.Reader, dataKey); err != nil {
+		return
+	}
+	wrappedKey, err := encrypt(k.keys[k.id], dataKey, []byte(k.id))
+	if err != nil {
+		return
+	}
+	ciphertext, err := encrypt(dataKey, []byte(s), nil)
+	if err != nil {
+		return
+	}
+	enc := base64.RawStdEncoding
+	return Secret(sealedPrefix + k.id + ":" + enc.EncodeToString(wrappedKey) + ":" + enc.EncodeToString(ciphertext)), nil
+}
+
+// Open returns the plaintext of a secret
+func (k *Keeper) Open(s Secret) (plaintext string, err error) {
+	if !s.IsSealed() {
+		return string(s), nil
+	}
+	if k == nil {
+		return "", ErrorNoMasterKey
+	}
+	parts := strings.Split(strings.TrimPrefix(string(s), sealedPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("the secret is malformed")
+	}
+	masterKey, found := k.keys[parts[0]]
+	if !found {
+		return "", fmt.Errorf("%w %s", ErrorUnknownKey, parts[0])
+	}
+	enc := base64.RawStdEncoding
+	wrappedKey, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return
+	}
+	ciphertext, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return
+	}
+	dataKey, err := decrypt(masterKey, wrappedKey, []byte(parts[0]))
+	if err != nil {
+		return
+	}
+	data, err := decrypt(dataKey, ciphertext, nil)
+	return string(data), err
+}
+
+// encrypt encrypts with AES-GCM, the nonce is prepended to the ciphertext
+func encrypt(key, plaintext, additionalData []byte) (ciphertext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// decrypt decrypts the output of encrypt
+func decrypt(key, ciphertext, additionalData []byte) (plaintext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("the secret is malformed")
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	if plaintext, err = gcm.Open(nil, nonce, ciphertext, additionalData); err != nil {
+		return nil, errors.New("the secret cannot be decrypted, it has been tampered with")
+	}
+	return
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
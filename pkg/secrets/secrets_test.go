@@ -0,0 +1,121 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apeunit/LaunchControlD/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeeper(t *testing.T) *Keeper {
+	encoded, err := GenerateKey()
+	require.Nil(t, err)
+	key, err := DecodeKey(encoded)
+	require.Nil(t, err)
+	k, err := NewKeeper(key)
+	require.Nil(t, err)
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := newTestKeeper(t)
+	mnemonic := Secret("abandon abandon about")
+
+	sealed, err := k.Seal(mnemonic)
+	require.Nil(t, err)
+	assert.True(t, sealed.IsSealed())
+	assert.Equal(t, k.ID(), sealed.KeyID())
+	assert.NotContains(t, string(sealed), "abandon")
+	// sealing twice gives different ciphertexts, sealed secrets are kept
+	other, _ := k.Seal(mnemonic)
+	assert.NotEqual(t, sealed, other)
+	again, _ := k.Seal(sealed)
+	assert.Equal(t, sealed, again)
+
+	plaintext, err := k.Open(sealed)
+	require.Nil(t, err)
+	assert.Equal(t, string(mnemonic), plaintext)
+	// plaintext secrets are returned as they are
+	plaintext, err = k.Open(mnemonic)
+	require.Nil(t, err)
+	assert.Equal(t, string(mnemonic), plaintext)
+
+	// tampering is detected
+	tampered := Secret(strings.TrimSuffix(string(sealed), string(sealed[len(sealed)-2:])) + "AA")
+	_, err = k.Open(tampered)
+	assert.NotNil(t, err)
+
+	// another key cannot open the secret until it trusts the first one
+	rotated := newTestKeeper(t)
+	_, err = rotated.Open(sealed)
+	assert.True(t, errors.Is(err, ErrorUnknownKey))
+	rotated.Trust(k)
+	plaintext, err = rotated.Open(sealed)
+	require.Nil(t, err)
+	assert.Equal(t, string(mnemonic), plaintext)
+
+	// without a keeper secrets stay in plaintext
+	var none *Keeper
+	kept, err := none.Seal(mnemonic)
+	require.Nil(t, err)
+	assert.Equal(t, mnemonic, kept)
+	_, err = none.Open(sealed)
+	assert.Equal(t, ErrorNoMasterKey, err)
+
+	// the debug dumps do not print the secrets
+	assert.Equal(t, `"REDACTED"`, fmt.Sprintf("%#v", mnemonic))
+	assert.Equal(t, `""`, fmt.Sprintf("%#v", Secret("")))
+	settings := config.Secrets{MasterKey: "a2V5", KeyFile: "key.txt"}
+	assert.Equal(t, `config.Secrets{MasterKey:"REDACTED", KeyFile:"key.txt"}`, fmt.Sprintf("%#v", settings))
+}
+
+func TestFromSettings(t *testing.T) {
+	os.Unsetenv(MasterKeyEnv)
+	k, err := FromSettings(&config.Schema{})
+	require.Nil(t, err)
+	assert.Nil(t, k)
+
+	key, _ := GenerateKey()
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	require.Nil(t, ioutil.WriteFile(keyFile, []byte(key+"\n"), 0600))
+	fromFile, err := FromSettings(&config.Schema{Secrets: config.Secrets{KeyFile: keyFile}})
+	require.Nil(t, err)
+	fromConfig, err := FromSettings(&config.Schema{Secrets: config.Secrets{MasterKey: key}})
+	require.Nil(t, err)
+	assert.Equal(t, fromConfig.ID(), fromFile.ID())
+	_, err = FromSettings(&config.Schema{Secrets: config.Secrets{MasterKey: "c2hvcnQ="}})
+	assert.NotNil(t, err)
+
+	// the environment takes precedence
+	envKey, _ := GenerateKey()
+	os.Setenv(MasterKeyEnv, envKey)
+	defer os.Unsetenv(MasterKeyEnv)
+	fromEnv, err := FromSettings(&config.Schema{Secrets: config.Secrets{MasterKey: key}})
+	require.Nil(t, err)
+	assert.NotEqual(t, fromConfig.ID(), fromEnv.ID())
+}
+
+func TestPassphrase(t *testing.T) {
+	data := []byte("the bundle")
+	encrypted, err := EncryptWithPassphrase(data, "correct horse")
+	require.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(encrypted), "Salted__"))
+
+	decrypted, err := DecryptWithPassphrase(encrypted, "correct horse")
+	require.Nil(t, err)
+	assert.Equal(t, data, decrypted)
+
+	_, err = DecryptWithPassphrase(encrypted, "wrong horse")
+	assert.NotNil(t, err)
+	_, err = DecryptWithPassphrase(data, "correct horse")
+	assert.NotNil(t, err)
+	_, err = EncryptWithPassphrase(data, "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,326 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// error definitions
+var (
+	ErrorJobNotFound   = errors.New("job not found")
+	ErrorJobInProgress = errors.New("another job is in progress for the event")
+	ErrorJobNotActive  = errors.New("job is not active")
+)
+
+// JobStatus is the execution status of a job
+type JobStatus string
+
+// Job statuses
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Job tracks a long running operation on an event
+type Job struct {
+	ID         string    `json:"id"`
+	EventID    string    `json:"event_id"`
+	Kind       string    `json:"kind"`
+	Status     JobStatus `json:"status"`
+	Step       string    `json:"step"`
+	StepsDone  int       `json:"steps_done"`
+	StepsTotal int       `json:"steps_total"`
+	Logs       []JobLog  `json:"logs"`
+	// Commands are the journal entries of the commands run by the job, with
+	// their output. They are read from the event journal, not stored.
+	Commands   []cmdrunner.JournalEntry `json:"commands,omitempty"`
+	Result     interface{}              `json:"result,omitempty"`
+	Error      string                   `json:"error,omitempty"`
+	CreatedOn  time.Time                `json:"created_on"`
+	StartedOn  time.Time                `json:"started_on"`
+	FinishedOn time.Time                `json:"finished_on"`
+}
+
+// JobLog is a log line of a job
+type JobLog struct {
+	At      time.Time `json:"at"`
+	Message string    `json:"message"`
+}
+
+// JobStep is a named unit of work of a job
+type JobStep struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// IsActive tells whenever the job is still queued or running
+func (j *Job) IsActive() bool {
+	return j.Status == JobQueued || j.Status == JobRunning
+}
+
+// WithCommands returns the job with the entries of the event journal of the
+// commands started while the job was running
+func (j Job) WithCommands(journal []cmdrunner.JournalEntry) Job {
+	j.Commands = nil
+	if j.StartedOn.IsZero() {
+		return j
+	}
+	for _, e := range journal {
+		if e.Time.Before(j.StartedOn) || (!j.FinishedOn.IsZero() && e.Time.After(j.FinishedOn)) {
+			continue
+		}
+		j.Commands = append(j.Commands, e)
+	}
+	return j
+}
+
+// log append a message to the job logs
+func (j *Job) log(format string, args ...interface{}) {
+	j.Logs = append(j.Logs, JobLog{At: time.Now(), Message: fmt.Sprintf(format, args...)})
+}
+
+// JobsDB keeps track of the jobs and runs them in the background
+type JobsDB struct {
+	dbPath  string
+	jobs    map[string]*Job
+	cancels map[string]context.CancelFunc
+	// reserved are the events that cannot get new jobs, see Reserve
+	reserved map[string]bool
+	sync.RWMutex
+}
+
+// NewJobsDB create or read an existing jobs database from a path
+func NewJobsDB(dbPath string) (db *JobsDB, err error) {
+	log.Debug("jobsDb: initialize new db at: ", dbPath)
+	db = &JobsDB{
+		dbPath:   dbPath,
+		jobs:     make(map[string]*Job),
+		cancels:  make(map[string]context.CancelFunc),
+		reserved: make(map[string]bool),
+	}
+	if !utils.FileExists(dbPath) {
+		return
+	}
+	if err = utils.LoadJSON(dbPath, &db.jobs); err != nil {
+		return
+	}
+	// jobs that were active when the service stopped are lost
+	for _, j := range db.jobs {
+		if j.IsActive() {
+			j.Status = JobFailed
+			j.Error = "interrupted by a service restart"
+			j.FinishedOn = time.Now()
+		}
+	}
+	log.Debugln("jobsDb: db loaded with", len(db.jobs), "records")
+	err = db.store()
+	return
+}
+
+// Submit queues a job for an event and runs its steps in the background.
+// The result function is called once all the steps have succeeded and its
+// value is stored in the job.
+func (db *JobsDB) Submit(eventID, kind string, steps []JobStep, result func() interface{}) (job Job, err error) {
+	db.Lock()
+	defer db.Unlock()
+	if db.reserved[eventID] || db.hasActive(eventID) {
+		err = ErrorJobInProgress
+		return
+	}
+	id, err := utils.GenerateRandomHash()
+	if err != nil {
+		return
+	}
+	j := &Job{
+		ID:         id[:16],
+		EventID:    eventID,
+		Kind:       kind,
+		Status:     JobQueued,
+		StepsTotal: len(steps),
+		Logs:       make([]JobLog, 0),
+		CreatedOn:  time.Now(),
+	}
+	db.jobs[j.ID] = j
+	if err = db.store(); err != nil {
+		return
+	}
+	// the job is not bound to the request, so it survives client disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+	db.cancels[j.ID] = cancel
+	go db.run(ctx, j, steps, result)
+	job = db.snapshot(j)
+	return
+}
+
+// Reserve keeps the jobs from being submitted for an event until release is
+// called, i.e. while the event is destroyed. It fails with
+// ErrorJobInProgress if a job of the event is active.
+func (db *JobsDB) Reserve(eventID string) (release func(), err error) {
+	db.Lock()
+	defer db.Unlock()
+	if db.reserved[eventID] || db.hasActive(eventID) {
+		return nil, ErrorJobInProgress
+	}
+	db.reserved[eventID] = true
+	release = func() {
+		db.Lock()
+		defer db.Unlock()
+		delete(db.reserved, eventID)
+	}
+	return
+}
+
+// hasActive tells if an event has an active job, the caller holds the lock
+func (db *JobsDB) hasActive(eventID string) bool {
+	for _, j := range db.jobs {
+		if j.EventID == eventID && j.IsActive() {
+			return true
+		}
+	}
+	return false
+}
+
+// Cancel stops a running job, the command in progress is killed
+func (db *JobsDB) Cancel(eventID, jobID string) (err error) {
+	db.Lock()
+	defer db.Unlock()
+	j, found := db.jobs[jobID]
+	if !found || j.EventID != eventID {
+		return ErrorJobNotFound
+	}
+	cancel, found := db.cancels[jobID]
+	if !found || !j.IsActive() {
+		return ErrorJobNotActive
+	}
+	j.log("cancellation requested")
+	if err = db.store(); err != nil {
+		log.Errorf("jobsDb: failed to store job %s: %v", j.ID, err)
+	}
+	cancel()
+	return nil
+}
+
+// run executes the steps of a job, stopping at the first failure
+func (db *JobsDB) run(ctx context.Context, j *Job, steps []JobStep, result func() interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Warn("recovered from panic in job ", j.ID, ": ", r)
+			db.finish(j, fmt.Errorf("operation failed"), nil)
+		}
+	}()
+	defer func() {
+		db.Lock()
+		defer db.Unlock()
+		if cancel, found := db.cancels[j.ID]; found {
+			cancel()
+			delete(db.cancels, j.ID)
+		}
+	}()
+	db.update(j, func() {
+		j.Status = JobRunning
+		j.StartedOn = time.Now()
+	})
+	for _, s := range steps {
+		start := time.Now()
+		db.update(j, func() {
+			j.Step = s.Name
+			j.log("step %s started", s.Name)
+		})
+		if err := s.Run(ctx); err != nil {
+			// keep the step error, the killed command tells where it stopped
+			if ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+				err = fmt.Errorf("%w: %v", ctx.Err(), err)
+			}
+			db.finish(j, err, nil)
+			return
+		}
+		db.update(j, func() {
+			j.StepsDone++
+			j.log("step %s completed in %s", s.Name, time.Since(start))
+		})
+	}
+	db.finish(j, nil, result())
+}
+
+// finish marks a job as completed
+func (db *JobsDB) finish(j *Job, err error, result interface{}) {
+	db.update(j, func() {
+		j.FinishedOn = time.Now()
+		if errors.Is(err, context.Canceled) {
+			j.Status = JobCancelled
+			j.Error = err.Error()
+			j.log("step %s cancelled", j.Step)
+			return
+		}
+		if err != nil {
+			j.Status = JobFailed
+			j.Error = err.Error()
+			j.log("step %s failed: %v", j.Step, err)
+			return
+		}
+		j.Status = JobSucceeded
+		j.Result = result
+		j.log("job completed in %s", j.FinishedOn.Sub(j.StartedOn))
+	})
+}
+
+// update applies a change to a job and saves the db
+func (db *JobsDB) update(j *Job, change func()) {
+	db.Lock()
+	defer db.Unlock()
+	change()
+	if err := db.store(); err != nil {
+		log.Errorf("jobsDb: failed to store job %s: %v", j.ID, err)
+	}
+}
+
+// Get retrieve a job of an event
+func (db *JobsDB) Get(eventID, jobID string) (job Job, err error) {
+	db.RLock()
+	defer db.RUnlock()
+	j, found := db.jobs[jobID]
+	if !found || j.EventID != eventID {
+		err = ErrorJobNotFound
+		return
+	}
+	job = db.snapshot(j)
+	return
+}
+
+// List retrieve the jobs of an event, most recent first
+func (db *JobsDB) List(eventID string) (jobs []Job) {
+	db.RLock()
+	defer db.RUnlock()
+	jobs = make([]Job, 0)
+	for _, j := range db.jobs {
+		if j.EventID == eventID {
+			jobs = append(jobs, db.snapshot(j))
+		}
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].CreatedOn.After(jobs[k].CreatedOn) })
+	return
+}
+
+// snapshot copies a job so it can be read while the job runs
+func (db *JobsDB) snapshot(j *Job) Job {
+	c := *j
+	c.Logs = append([]JobLog{}, j.Logs...)
+	return c
+}
+
+// store store the jobs db on file
+func (db *JobsDB) store() (err error) {
+	err = utils.StoreJSON(db.dbPath, db.jobs)
+	return
+}
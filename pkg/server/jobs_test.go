@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
+	"github.com/apeunit/LaunchControlD/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitJob polls a job until it is not active anymore
+func waitJob(t *testing.T, db *JobsDB, eventID, jobID string) Job {
+	for i := 0; i < 100; i++ {
+		j, err := db.Get(eventID, jobID)
+		assert.Nil(t, err)
+		if !j.IsActive() {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job did not complete in time")
+	return Job{}
+}
+
+func TestJobsDB(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "jobs.json")
+	db, err := NewJobsDB(dbPath)
+	assert.Nil(t, err)
+
+	release := make(chan struct{})
+	steps := []JobStep{
+		{Name: "first", Run: func(ctx context.Context) error { <-release; return nil }},
+		{Name: "second", Run: func(ctx context.Context) error { return nil }},
+	}
+	job, err := db.Submit("evt-1", "deploy", steps, func() interface{} { return "done" })
+	assert.Nil(t, err)
+	assert.Equal(t, 2, job.StepsTotal)
+
+	// only one job at the time for an event
+	_, err = db.Submit("evt-1", "deploy", steps, nil)
+	assert.Equal(t, ErrorJobInProgress, err)
+	// an event cannot be reserved while it has an active job
+	_, err = db.Reserve("evt-1")
+	assert.Equal(t, ErrorJobInProgress, err)
+
+	close(release)
+	job = waitJob(t, db, "evt-1", job.ID)
+	assert.Equal(t, JobSucceeded, job.Status)
+	assert.Equal(t, 2, job.StepsDone)
+	assert.Equal(t, "done", job.Result)
+
+	// a failing step stops the job
+	failing := []JobStep{
+		{Name: "first", Run: func(ctx context.Context) error { return errors.New("boom") }},
+		{Name: "second", Run: func(ctx context.Context) error { t.Error("should not run"); return nil }},
+	}
+	failed, err := db.Submit("evt-1", "deploy", failing, nil)
+	assert.Nil(t, err)
+	failed = waitJob(t, db, "evt-1", failed.ID)
+	assert.Equal(t, JobFailed, failed.Status)
+	assert.Equal(t, "first", failed.Step)
+	assert.Equal(t, "boom", failed.Error)
+
+	assert.Len(t, db.List("evt-1"), 2)
+	assert.Len(t, db.List("evt-2"), 0)
+	_, err = db.Get("evt-2", job.ID)
+	assert.Equal(t, ErrorJobNotFound, err)
+
+	// a cancelled job stops at the running step
+	blocking := []JobStep{
+		{Name: "first", Run: func(ctx context.Context) error { <-ctx.Done(); return errors.New("killed") }},
+	}
+	cancelled, err := db.Submit("evt-1", "deploy", blocking, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Cancel("evt-1", cancelled.ID))
+	cancelled = waitJob(t, db, "evt-1", cancelled.ID)
+	assert.Equal(t, JobCancelled, cancelled.Status)
+	assert.Equal(t, "context canceled: killed", cancelled.Error)
+	assert.Equal(t, ErrorJobNotActive, db.Cancel("evt-1", cancelled.ID))
+
+	// the cancellation request is stored while the step is stopping
+	started, stopping := make(chan struct{}), make(chan struct{})
+	slow := []JobStep{
+		{Name: "first", Run: func(ctx context.Context) error { close(started); <-stopping; return ctx.Err() }},
+	}
+	slowJob, err := db.Submit("evt-2", "deploy", slow, nil)
+	assert.Nil(t, err)
+	<-started
+	assert.Nil(t, db.Cancel("evt-2", slowJob.ID))
+	stored := make(map[string]*Job)
+	require.Nil(t, utils.LoadJSON(dbPath, &stored))
+	require.Contains(t, stored, slowJob.ID)
+	logs := stored[slowJob.ID].Logs
+	require.NotEmpty(t, logs)
+	assert.Equal(t, "cancellation requested", logs[len(logs)-1].Message)
+	close(stopping)
+	slowJob = waitJob(t, db, "evt-2", slowJob.ID)
+	assert.Equal(t, JobCancelled, slowJob.Status)
+	assert.Equal(t, "context canceled", slowJob.Error)
+
+	// no jobs are submitted for a reserved event
+	releaseEvt, err := db.Reserve("evt-3")
+	require.Nil(t, err)
+	_, err = db.Submit("evt-3", "deploy", steps, nil)
+	assert.Equal(t, ErrorJobInProgress, err)
+	_, err = db.Reserve("evt-3")
+	assert.Equal(t, ErrorJobInProgress, err)
+	releaseEvt()
+	reserved, err := db.Submit("evt-3", "deploy", steps, nil)
+	require.Nil(t, err)
+	waitJob(t, db, "evt-3", reserved.ID)
+
+	// the jobs survive a restart
+	db, err = NewJobsDB(dbPath)
+	assert.Nil(t, err)
+	assert.Len(t, db.List("evt-1"), 3)
+}
+
+func TestJobWithCommands(t *testing.T) {
+	start := time.Now()
+	journal := []cmdrunner.JournalEntry{
+		{Time: start.Add(-time.Minute), Step: "before"},
+		{Time: start.Add(time.Second), Step: "deploy", Output: "container started"},
+		{Time: start.Add(time.Hour), Step: "after"},
+	}
+	j := Job{Status: JobQueued}
+	assert.Empty(t, j.WithCommands(journal).Commands)
+
+	// a running job gets the commands run so far
+	j.Status, j.StartedOn = JobRunning, start
+	assert.Equal(t, []string{"deploy", "after"}, commandSteps(j.WithCommands(journal)))
+
+	j.Status, j.FinishedOn = JobSucceeded, start.Add(time.Minute)
+	assert.Equal(t, []string{"deploy"}, commandSteps(j.WithCommands(journal)))
+	assert.Equal(t, "container started", j.WithCommands(journal).Commands[0].Output)
+}
+
+// commandSteps returns the steps of the commands of a job
+func commandSteps(j Job) (steps []string) {
+	for _, c := range j.Commands {
+		steps = append(steps, c.Step)
+	}
+	return
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/apeunit/LaunchControlD/pkg/config"
 	"github.com/apeunit/LaunchControlD/pkg/model"
 )
 
@@ -49,10 +50,14 @@ type APIEvent struct {
 	Owner       string                      `json:"owner"`        // email address of the owner
 	Accounts    map[string]APIAccount       `json:"accounts"`
 	Provider    string                      `json:"provider"` // provider for provisioning
+	Payload     string                      `json:"payload"`  // name of the payload in the catalog
 	CreatedOn   time.Time                   `json:"created_on"`
 	StartsOn    time.Time                   `json:"starts_on"`
 	EndsOn      time.Time                   `json:"ends_on"`
 	State       map[string]APIMachineConfig `json:"state"`
+	// lifecycle of the event
+	Status        model.EventStatus        `json:"status"`
+	StatusHistory []model.StatusTransition `json:"status_history"`
 }
 
 // APIAccount API safe account object
@@ -66,9 +71,38 @@ type APIAccount struct {
 
 // APIMachineConfig API safe machine config
 type APIMachineConfig struct {
-	TendermintNodeID string `json:"tendermint_node_id"`
-	IPAddress        string `json:"IPAddress"`
-	MachineName      string `json:"MachineName"`
+	TendermintNodeID string         `json:"tendermint_node_id"`
+	IPAddress        string         `json:"IPAddress"`
+	MachineName      string         `json:"MachineName"`
+	Role             model.NodeRole `json:"role"`
+}
+
+// APIPayload API safe payload of the catalog
+type APIPayload struct {
+	Name        string `json:"name" example:"launchpayload"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version,omitempty" example:"v0.0.0"`
+	DockerImage string `json:"docker_image" example:"apeunit/launchpayload:v1.0.0"`
+	Profile     string `json:"profile" example:"legacy"`
+	Default     bool   `json:"default"`
+}
+
+// ToAPIPayloads converts the payloads of the catalog to their API safe
+// version, the default payload is the one chosen by the event requests
+// that do not name a payload
+func ToAPIPayloads(payloads []config.CatalogPayload, defaultPayload string) (aPayloads []APIPayload) {
+	aPayloads = make([]APIPayload, 0, len(payloads))
+	for _, p := range payloads {
+		aPayloads = append(aPayloads, APIPayload{
+			Name:        p.Name,
+			Description: p.Description,
+			Version:     p.Version,
+			DockerImage: p.DockerImage,
+			Profile:     p.Profile,
+			Default:     p.Name == defaultPayload,
+		})
+	}
+	return
 }
 
 // ToAPIEvents copy a list of events to a API save version
@@ -84,22 +118,25 @@ func ToAPIEvents(evts *[]model.Event) (aEvts []APIEvent) {
 // safe to publish via REST API Endpoints
 func ToAPIEvent(evt *model.Event) (aEvt APIEvent) {
 	aEvt = APIEvent{
-		ID:          evt.ID(),
-		TokenSymbol: evt.TokenSymbol,
-		Owner:       evt.Owner,
-		Provider:    evt.Provider,
-		CreatedOn:   evt.CreatedOn,
-		StartsOn:    evt.StartsOn,
-		EndsOn:      evt.EndsOn,
-		Accounts:    make(map[string]APIAccount, len(evt.Accounts)),
-		State:       make(map[string]APIMachineConfig, len(evt.State)),
+		ID:            evt.ID(),
+		TokenSymbol:   evt.TokenSymbol,
+		Owner:         evt.Owner,
+		Provider:      evt.Provider,
+		Payload:       evt.Payload.Name,
+		CreatedOn:     evt.CreatedOn,
+		StartsOn:      evt.StartsOn,
+		EndsOn:        evt.EndsOn,
+		Accounts:      make(map[string]APIAccount, len(evt.Accounts)),
+		State:         make(map[string]APIMachineConfig, len(evt.State)),
+		Status:        evt.CurrentStatus(),
+		StatusHistory: evt.StatusHistory,
 	}
 	// fill up the accounts
 	for k, v := range evt.Accounts {
 		aEvt.Accounts[k] = APIAccount{
 			Name:           v.Name,
 			Address:        v.Address,
-			GenesisBalance: v.GenesisBalance,
+			GenesisBalance: v.GenesisBalance.String(),
 			Validator:      v.Validator,
 			Faucet:         v.Faucet,
 		}
@@ -110,6 +147,7 @@ func ToAPIEvent(evt *model.Event) (aEvt APIEvent) {
 			TendermintNodeID: v.TendermintNodeID,
 			IPAddress:        v.Instance.IPAddress,
 			MachineName:      v.Instance.MachineName,
+			Role:             evt.NodeRole(k),
 		}
 	}
 	return
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"net/url"
 	"time"
 
 	"github.com/apeunit/LaunchControlD/pkg/cmdrunner"
@@ -23,11 +26,15 @@ import (
 const (
 	sessionKeyUserHash = "user_hash"
 	headerAuthToken    = "X-LCTRLD-TOKEN"
+	// headerPassphrase encrypts the key bundles, it is not a query parameter
+	// to keep it out of the logs
+	headerPassphrase = "X-LCTRLD-PASSPHRASE"
 )
 
 var (
 	appSettings *config.Schema
 	usersDb     *UsersDB
+	jobsDb      *JobsDB
 )
 
 // ServeHTTP starts the http service
@@ -47,6 +54,10 @@ func ServeHTTP(settings *config.Schema) (err error) {
 	if err != nil {
 		return
 	}
+	jobsDb, err = NewJobsDB(utils.GetPath(settings.Workspace, settings.Web.JobsDbFile))
+	if err != nil {
+		return
+	}
 	// setup the web framework
 	app := fiber.New(fiber.Config{DisableStartupMessage: true})
 	// enable cors
@@ -84,9 +95,20 @@ func ServeHTTP(settings *config.Schema) (err error) {
 	// register the routes
 	events.Post("/", eventCreate)
 	events.Put("/:eventID/deploy", eventDeploy)
+	events.Delete("/:eventID/deploy", eventUndeploy)
+	events.Get("/:eventID/jobs", listEventJobs)
+	events.Get("/:eventID/jobs/:jobID", getEventJob)
+	events.Delete("/:eventID/jobs/:jobID", cancelEventJob)
+	events.Get("/:eventID/health", getEventHealth)
+	events.Get("/:eventID/journal", getEventJournal)
+	events.Get("/:eventID/accounts/:name/bundle", getAccountBundle)
 	events.Delete("/:eventID", deleteEvent)
 	events.Get("/:eventID", getEvent)
 	events.Get("/", listEvents)
+	// payloads api
+	payloads := v1.Group("/payloads")
+	payloads.Use(auth)
+	payloads.Get("/", listPayloads)
 	// run the web server
 	err = app.Listen(settings.Web.ListenAddress)
 	return
@@ -224,36 +246,26 @@ func eventCreate(c *fiber.Ctx) error {
 	}
 	//parse the event requests
 	var er model.EventRequest
-	c.BodyParser(&er)
+	if err = c.BodyParser(&er); err != nil {
+		return c.JSON(APIReplyErr(http.StatusBadRequest, err.Error()))
+	}
 	log.Debugf("REST: event request %#v", er)
 	// TODO: find a better way for defaults
 	er.Provider = appSettings.Web.DefaultProvider
-	er.PayloadLocation = model.NewDefaultPayloadLocation()
 	// override the owner
 	er.Owner = ownerEmail
-	// validate the event request
-	if strings.TrimSpace(er.TokenSymbol) == "" {
-		return c.JSON(fiber.ErrBadRequest)
-	}
-	// count the number of accounts
-	if len(er.GenesisAccounts) == 0 {
-		return c.JSON(fiber.ErrBadRequest)
+	// only the payloads of the catalog can be chosen
+	if err = er.SetPayload(appSettings); err != nil {
+		return c.JSON(APIReplyErr(http.StatusBadRequest, err.Error()))
 	}
-	// check that the names are set
-	for _, g := range er.GenesisAccounts {
-		if strings.TrimSpace(g.Name) == "" {
-			return c.JSON(fiber.ErrBadRequest)
-		}
+	// validate the event request, with the address prefix of the payload
+	if err = er.Validate(); err != nil {
+		return c.JSON(APIReplyErr(http.StatusBadRequest, err.Error()))
 	}
 	// now create a new event
-	event := model.NewEvent(er.TokenSymbol,
-		er.Owner,
-		er.Provider,
-		er.GenesisAccounts,
-		er.PayloadLocation,
-	)
+	event := model.NewEventFromRequest(&er)
 	err = lctrld.CreateEvent(appSettings, event)
-	log.Debug("Creating event %#v\n", event)
+	log.Debugf("Creating event %#v\n", event)
 	if err != nil {
 		return c.JSON(APIReplyErr(http.StatusInternalServerError, err.Error()))
 	}
@@ -266,11 +278,12 @@ func eventCreate(c *fiber.Ctx) error {
 }
 
 // @Summary Provision the insfrastructure and deploy the event
+// @Description The deployment runs in the background, poll the returned job for progress
 // @Tags event
 // @Accept  json
 // @Produce  json
 // @Param id path string true "Event ID"
-// @Success 200 {object} APIEvent
+// @Success 202 {object} Job
 // @Router /v1/events/{id}/deploy [put]
 func eventDeploy(c *fiber.Ctx) error {
 	// TODO: workaround to handle log.Error in lib
@@ -286,21 +299,277 @@ func eventDeploy(c *fiber.Ctx) error {
 		return c.JSON(fiber.ErrNotFound)
 	}
 
-	/// deploy
-	err = lctrld.ProvisionEvent(appSettings, &event, cmdrunner.RunCommand)
+	/// deploy, resuming from where a previous deployment stopped
+	steps := deploySteps(&event)
+	if len(steps) == 0 {
+		return c.JSON(APIReplyErr(http.StatusConflict, fmt.Sprintf("event is %s and cannot be deployed", event.CurrentStatus())))
+	}
+	job, err := jobsDb.Submit(event.ID(), "deploy", steps, func() interface{} { return ToAPIEvent(&event) })
+	if err == ErrorJobInProgress {
+		return c.JSON(APIReplyErr(http.StatusConflict, err.Error()))
+	}
 	if err != nil {
-		return c.JSON(APIReplyErr(http.StatusInternalServerError, "There was a problem provisioning the infrastructure for your chain. Our loggers must've caught it, so just let us know you had a problem."))
+		return c.JSON(APIReplyErr(http.StatusInternalServerError, err.Error()))
 	}
-	err = lctrld.ConfigurePayload(appSettings, &event, cmdrunner.RunCommand)
+	return c.Status(http.StatusAccepted).JSON(job)
+}
+
+// @Summary Stop and remove the containers of the event
+// @Description The containers and the node configuration are removed from the machines, which stay provisioned. The undeployment runs in the background, poll the returned job for progress
+// @Tags event
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Event ID"
+// @Success 202 {object} Job
+// @Router /v1/events/{id}/deploy [delete]
+func eventUndeploy(c *fiber.Ctx) error {
+	// TODO: workaround to handle log.Error in lib
+	defer handlePanic(c)
+
+	eventID := c.Params("eventID")
+	event, err := lctrld.GetEventByID(appSettings, eventID)
 	if err != nil {
-		return c.JSON(APIReplyErr(http.StatusInternalServerError, "There was a problem generating the configuration files for your chain. Our loggers must've caught it, so just let us know you had a problem."))
+		return c.JSON(fiber.ErrNotFound)
+	}
+	// if it is not owned than hide it
+	if !isCurrentEventOwner(c, &event) {
+		return c.JSON(fiber.ErrNotFound)
+	}
+
+	if status := event.EffectiveStatus(); status != model.StatusConfigured && status != model.StatusDeployed {
+		return c.JSON(APIReplyErr(http.StatusConflict, fmt.Sprintf("event is %s and cannot be undeployed", event.CurrentStatus())))
+	}
+	undeploy := JobStep{Name: "undeploy", Run: func(ctx context.Context) error {
+		if err := lctrld.UndeployPayload(ctx, appSettings, &event, cmdrunner.NewRunner(appSettings)); err != nil {
+			return fmt.Errorf("there was a problem removing your chain from the virtual machines: %v", err)
+		}
+		return nil
+	}}
+	job, err := jobsDb.Submit(event.ID(), "undeploy", []JobStep{undeploy}, func() interface{} { return ToAPIEvent(&event) })
+	if err == ErrorJobInProgress {
+		return c.JSON(APIReplyErr(http.StatusConflict, err.Error()))
 	}
-	err = lctrld.DeployPayload(appSettings, &event, cmdrunner.RunCommand)
 	if err != nil {
-		return c.JSON(APIReplyErr(http.StatusInternalServerError, "Your chain was configured and virtual machines deployed, but ther was an error starting your chain. Our loggers must've caught it, so just let us know you had a problem."))
+		return c.JSON(APIReplyErr(http.StatusInternalServerError, err.Error()))
 	}
+	return c.Status(http.StatusAccepted).JSON(job)
+}
 
-	return c.JSON(ToAPIEvent(&event))
+// deploySteps returns the steps still needed to get the event deployed
+func deploySteps(event *model.Event) (steps []JobStep) {
+	runner := cmdrunner.NewRunner(appSettings)
+	provision := JobStep{Name: "provision", Run: func(ctx context.Context) error {
+		if err := lctrld.ProvisionEvent(ctx, appSettings, event, runner); err != nil {
+			return fmt.Errorf("there was a problem provisioning the infrastructure for your chain: %v", err)
+		}
+		return nil
+	}}
+	configure := JobStep{Name: "configure", Run: func(ctx context.Context) error {
+		// continue from the checkpoint left by a previous attempt, if any
+		if err := lctrld.ResumeConfigurePayload(ctx, appSettings, event, "", runner); err != nil {
+			return fmt.Errorf("there was a problem generating the configuration files for your chain: %v", err)
+		}
+		return nil
+	}}
+	deploy := JobStep{Name: "deploy", Run: func(ctx context.Context) error {
+		if err := lctrld.DeployPayload(ctx, appSettings, event, runner); err != nil {
+			return fmt.Errorf("your chain was configured and virtual machines deployed, but there was an error starting your chain: %v", err)
+		}
+		return nil
+	}}
+	switch event.EffectiveStatus() {
+	case model.StatusCreated:
+		steps = []JobStep{provision, configure, deploy}
+	case model.StatusProvisioned:
+		steps = []JobStep{configure, deploy}
+	case model.StatusConfigured:
+		steps = []JobStep{deploy}
+	}
+	return
+}
+
+// @Summary Retrieve the jobs of an event
+// @Tags event
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Event ID"
+// @Success 200 {array} Job
+// @Router /v1/events/{id}/jobs [get]
+func listEventJobs(c *fiber.Ctx) error {
+	// TODO: workaround to handle log.Error in lib
+	defer handlePanic(c)
+
+	eventID := c.Params("eventID")
+	event, err := lctrld.GetEventByID(appSettings, eventID)
+	if err != nil {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	// if it is not owned than hide it
+	if !isCurrentEventOwner(c, &event) {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	return c.JSON(jobsDb.List(event.ID()))
+}
+
+// @Summary Check the health of the chain of a deployed event
+// @Tags event
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Event ID"
+// @Success 200 {object} lctrld.EventHealth
+// @Router /v1/events/{id}/health [get]
+func getEventHealth(c *fiber.Ctx) error {
+	// TODO: workaround to handle log.Error in lib
+	defer handlePanic(c)
+
+	eventID := c.Params("eventID")
+	event, err := lctrld.GetEventByID(appSettings, eventID)
+	if err != nil {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	// if it is not owned than hide it
+	if !isCurrentEventOwner(c, &event) {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	health, err := lctrld.CheckEventHealth(c.Context(), appSettings, &event)
+	if err != nil {
+		return c.JSON(APIReplyErr(http.StatusInternalServerError, err.Error()))
+	}
+	return c.JSON(health)
+}
+
+// @Summary Retrieve the journal of the commands run for an event
+// @Tags event
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Event ID"
+// @Success 200 {array} cmdrunner.JournalEntry
+// @Router /v1/events/{id}/journal [get]
+func getEventJournal(c *fiber.Ctx) error {
+	// TODO: workaround to handle log.Error in lib
+	defer handlePanic(c)
+
+	eventID := c.Params("eventID")
+	event, err := lctrld.GetEventByID(appSettings, eventID)
+	if err != nil {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	// if it is not owned than hide it
+	if !isCurrentEventOwner(c, &event) {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	entries, err := lctrld.EventJournal(appSettings, event.ID())
+	if err != nil {
+		return c.JSON(APIReplyErr(http.StatusInternalServerError, err.Error()))
+	}
+	return c.JSON(entries)
+}
+
+// @Summary Download the key bundle of an account
+// @Description The tar.gz archive with the mnemonic, the address and the keyring of the account and the chain endpoints. If the X-LCTRLD-PASSPHRASE header is set the archive is encrypted with it, as openssl enc -aes-256-cbc -pbkdf2 -iter 100000 does.
+// @Tags event
+// @Produce  application/octet-stream
+// @Param id path string true "Event ID"
+// @Param name path string true "Account name"
+// @Param X-LCTRLD-PASSPHRASE header string false "Passphrase encrypting the bundle"
+// @Success 200 {file} file
+// @Router /v1/events/{id}/accounts/{name}/bundle [get]
+func getAccountBundle(c *fiber.Ctx) error {
+	// TODO: workaround to handle log.Error in lib
+	defer handlePanic(c)
+
+	eventID := c.Params("eventID")
+	event, err := lctrld.GetEventByID(appSettings, eventID)
+	if err != nil {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	// if it is not owned than hide it
+	if !isCurrentEventOwner(c, &event) {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	name, err := url.PathUnescape(c.Params("name"))
+	if err != nil {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	if _, found := event.Accounts[name]; !found {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	passphrase := c.Get(headerPassphrase)
+	var bundle bytes.Buffer
+	if err = lctrld.WriteKeyBundle(&bundle, appSettings, &event, name, passphrase); err != nil {
+		if errors.Is(err, lctrld.ErrorNoKeys) {
+			return c.JSON(APIReplyErr(http.StatusBadRequest, err.Error()))
+		}
+		return c.JSON(APIReplyErr(http.StatusInternalServerError, err.Error()))
+	}
+	c.Set(fiber.HeaderContentType, "application/octet-stream")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", lctrld.KeyBundleName(&event, name, passphrase != "")))
+	return c.Send(bundle.Bytes())
+}
+
+// @Summary Retrieve the status, progress and logs of a job
+// @Description The job has the journal entries of the commands it has run so far, with their output.
+// @Tags event
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Event ID"
+// @Param jobID path string true "Job ID"
+// @Success 200 {object} Job
+// @Router /v1/events/{id}/jobs/{jobID} [get]
+func getEventJob(c *fiber.Ctx) error {
+	// TODO: workaround to handle log.Error in lib
+	defer handlePanic(c)
+
+	eventID := c.Params("eventID")
+	event, err := lctrld.GetEventByID(appSettings, eventID)
+	if err != nil {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	// if it is not owned than hide it
+	if !isCurrentEventOwner(c, &event) {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	job, err := jobsDb.Get(event.ID(), c.Params("jobID"))
+	if err != nil {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	// the progress of the steps is in the commands they run
+	journal, err := lctrld.EventJournal(appSettings, event.ID())
+	if err != nil {
+		return c.JSON(APIReplyErr(http.StatusInternalServerError, err.Error()))
+	}
+	return c.JSON(job.WithCommands(journal))
+}
+
+// @Summary Cancel a running job, the command in progress is stopped
+// @Tags event
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Event ID"
+// @Param jobID path string true "Job ID"
+// @Success 200 {object} APIReply "API Reply"
+// @Router /v1/events/{id}/jobs/{jobID} [delete]
+func cancelEventJob(c *fiber.Ctx) error {
+	// TODO: workaround to handle log.Error in lib
+	defer handlePanic(c)
+
+	eventID := c.Params("eventID")
+	event, err := lctrld.GetEventByID(appSettings, eventID)
+	if err != nil {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	// if it is not owned than hide it
+	if !isCurrentEventOwner(c, &event) {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	err = jobsDb.Cancel(event.ID(), c.Params("jobID"))
+	if err == ErrorJobNotFound {
+		return c.JSON(fiber.ErrNotFound)
+	}
+	if err != nil {
+		return c.JSON(APIReplyErr(http.StatusConflict, err.Error()))
+	}
+	return c.JSON(APIReplyOK("ok"))
 }
 
 // @Summary Destroy an event and associated resources
@@ -309,6 +578,7 @@ func eventDeploy(c *fiber.Ctx) error {
 // @Produce  json
 // @Param id path string true "Event ID"
 // @Success 200 {object} APIEvent
+// @Failure 409 {object} APIReply "a job of the event is in progress"
 // @Router /v1/events/{id} [delete]
 func deleteEvent(c *fiber.Ctx) error {
 	// TODO: workaround to handle log.Error in lib
@@ -323,8 +593,14 @@ func deleteEvent(c *fiber.Ctx) error {
 	if !isCurrentEventOwner(c, &event) {
 		return c.JSON(fiber.ErrNotFound)
 	}
+	// the background jobs of the event would keep running on its machines
+	release, err := jobsDb.Reserve(event.ID())
+	if err != nil {
+		return c.JSON(APIReplyErr(http.StatusConflict, err.Error()))
+	}
+	defer release()
 	// destroy
-	err = lctrld.DestroyEvent(appSettings, &event, cmdrunner.RunCommand)
+	err = lctrld.DestroyEvent(c.Context(), appSettings, &event, cmdrunner.NewRunner(appSettings))
 	if err != nil {
 		return c.JSON(fiber.ErrInternalServerError)
 	}
@@ -387,3 +663,17 @@ func listEvents(c *fiber.Ctx) error {
 	}
 	return c.JSON(userEvents)
 }
+
+// @Summary List the payloads of the catalog
+// @Description The payloads an event request can choose, by name
+// @Tags payload
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} APIPayload
+// @Router /v1/payloads [get]
+func listPayloads(c *fiber.Ctx) error {
+	// TODO: workaround to handle log.Error in lib
+	defer handlePanic(c)
+
+	return c.JSON(ToAPIPayloads(appSettings.CatalogPayloads(), appSettings.DefaultCatalogPayload()))
+}
@@ -1,11 +1,11 @@
 package utils
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -16,10 +16,12 @@ import (
 	"strings"
 
 	"github.com/apeunit/LaunchControlD/pkg/config"
-	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/blake2b"
 )
 
+// ErrorChecksumMismatch is returned when a file does not match its checksum
+var ErrorChecksumMismatch = errors.New("checksum mismatch")
+
 // BuildEnvVars generates a sane base for environment variables to run shell
 // commands with. It just includes $PATH
 func BuildEnvVars(settings *config.Schema) []string {
@@ -50,6 +52,32 @@ func DownloadFile(folder, url string) (filename string, err error) {
 	return
 }
 
+// SHA256File returns the hex encoded sha256 of a file
+func SHA256File(filePath string) (sum string, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifySHA256 checks a file against the hex encoded sha256 expected, it
+// returns the actual sha256 of the file
+func VerifySHA256(filePath, expected string) (sum string, err error) {
+	if sum, err = SHA256File(filePath); err != nil {
+		return
+	}
+	if !strings.EqualFold(sum, strings.TrimSpace(expected)) {
+		err = fmt.Errorf("%w: %s has sha256 %s, expected %s", ErrorChecksumMismatch, filePath, sum, expected)
+	}
+	return
+}
+
 // LoadJSON load json from file into struct
 func LoadJSON(filePath string, v interface{}) (err error) {
 	data, err := ioutil.ReadFile(filePath)
@@ -79,71 +107,6 @@ func FileExists(filePath string) bool {
 	return false
 }
 
-// DetectContentType detect the content type of a file
-func DetectContentType(filePath string) (ct string, err error) {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return
-	}
-	defer f.Close()
-	// Only the first 512 bytes are used to sniff the content type.
-	buffer := make([]byte, 512)
-	_, err = f.Read(buffer)
-	if err != nil {
-		return
-	}
-	ct = http.DetectContentType(buffer)
-	return
-}
-
-// ExtractGzip extract a gzip file
-func ExtractGzip(filePath, outFolder string) (err error) {
-	gzipStream, err := os.Open(filePath)
-	if err != nil {
-		return
-	}
-	uncompressedStream, err := gzip.NewReader(gzipStream)
-	if err != nil {
-		log.Error("ExtractTarGz: NewReader failed")
-	}
-
-	tarReader := tar.NewReader(uncompressedStream)
-
-	for {
-		header, err := tarReader.Next()
-
-		if err == io.EOF {
-			break
-		}
-
-		if err != nil {
-			log.Errorf("ExtractTarGz: Next() failed: %s", err.Error())
-		}
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.Mkdir(filepath.Join(outFolder, header.Name), 0755); err != nil {
-				log.Errorf("ExtractTarGz: Mkdir() failed: %s", err.Error())
-			}
-		case tar.TypeReg:
-			outFile, err := os.Create(filepath.Join(outFolder, header.Name))
-			if err != nil {
-				log.Errorf("ExtractTarGz: Create() failed: %s", err.Error())
-			}
-			defer outFile.Close()
-			if _, err := io.Copy(outFile, tarReader); err != nil {
-				log.Errorf("ExtractTarGz: Copy() failed: %s", err.Error())
-			}
-		default:
-			log.Errorf(
-				"ExtractTarGz: unknown type: %v in %s",
-				header.Typeflag,
-				header.Name)
-		}
-	}
-	return
-}
-
 // Hash calculate the hash of a string
 func Hash(data ...interface{}) string {
 	hash := blake2b.Sum256([]byte(fmt.Sprint(data...)))
@@ -156,25 +119,6 @@ func ShortHash(data ...string) string {
 	return hex.EncodeToString(hash[0:10])
 }
 
-// SearchAndMove search a file in a folder and move it to another path
-func SearchAndMove(root, file, targetPath string) (err error) {
-	found := false
-	err = filepath.Walk(root, func(subPath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if path.Base(subPath) == file {
-			found = true
-			return os.Rename(subPath, targetPath)
-		}
-		return err
-	})
-	if !found {
-		err = fmt.Errorf("file %s was not found in %s", file, root)
-	}
-	return
-}
-
 // GetPath build the path to a file
 func GetPath(pieces ...string) string {
 	return filepath.Join(pieces...)
@@ -2,14 +2,10 @@ alias lctrld='lctrld --config ~/source/work/LaunchControlD/config.yaml'
 alias quicknew='lctrld events new ~/source/work/LaunchControlD/eventsample1.yml --provider virtualbox'
 alias quicksetup='lctrld payload setup $EVTID'
 alias quickdeploy='lctrld payload deploy $EVTID'
+alias quickundeploy='lctrld payload undeploy $EVTID'
 alias quickteardown='lctrld events teardown $EVTID && VBoxManage unregistervm $EVTID-0'
 alias quickssh='docker-machine -s /tmp/workspace/evts/$EVTID/.docker/machine ssh $EVTID-0'
 
-function quickundeploy {
-    docker-machine -s /tmp/workspace/evts/$EVTID/.docker/machine ssh $EVTID-0 rm -rf /home/docker/nodeconfig
-    machines_to_rm=`docker-machine -s /tmp/workspace/evts/$EVTID/.docker/machine ssh $EVTID-0 "docker ps -aq"`
-    docker-machine -s /tmp/workspace/evts/$EVTID/.docker/machine ssh $EVTID-0 docker rm -f $machines_to_rm
-}
 
 function reenv() {
     export EVTID=$1